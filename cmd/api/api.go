@@ -16,12 +16,19 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/supremed3v/social-media/docs"
 	"github.com/supremed3v/social-media/internal/auth"
+	"github.com/supremed3v/social-media/internal/blob"
 	"github.com/supremed3v/social-media/internal/cloudinary"
 	"github.com/supremed3v/social-media/internal/env"
+	"github.com/supremed3v/social-media/internal/imaging"
 	"github.com/supremed3v/social-media/internal/mailer"
+	"github.com/supremed3v/social-media/internal/ranking"
 	"github.com/supremed3v/social-media/internal/ratelimiter"
 	"github.com/supremed3v/social-media/internal/store"
 	"github.com/supremed3v/social-media/internal/store/cache"
+	"github.com/supremed3v/social-media/internal/stream"
+	"github.com/supremed3v/social-media/internal/transcode"
+	"github.com/supremed3v/social-media/internal/unfurl"
+	"github.com/supremed3v/social-media/internal/upload"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"go.uber.org/zap"
 )
@@ -34,21 +41,164 @@ type application struct {
 	mailer        mailer.Client
 	authenticator auth.Authenticator
 	rateLimiter   ratelimiter.Limiter
-	cloudinary    cloudinary.CloudinaryService
+	blob          blob.Storage
+	uploadDir     *upload.Dir
+	transcoder    *transcode.Transcoder
+	unfurler      *unfurl.Unfurler
+	broker        stream.Broker
 }
 
 type config struct {
-	addr            string
-	db              dbConfig
-	env             string
-	apiURL          string
-	mail            mailConfig
-	frontendURL     string
-	auth            authConfig
-	redisCfg        redisConfig
-	rateLimiter     ratelimiter.Config
-	cloudinary      cloudinary.CloudinaryConfig
-	maxMultipartMem int64
+	addr          string
+	db            dbConfig
+	env           string
+	apiURL        string
+	mail          mailConfig
+	frontendURL   string
+	auth          authConfig
+	redisCfg      redisConfig
+	rateLimiter   ratelimiter.Config
+	cloudinary    cloudinary.CloudinaryConfig
+	blob          blobConfig
+	images        imagesConfig
+	uploads       uploadsConfig
+	mediaGC       mediaGCConfig
+	video         videoConfig
+	linkPreviews  linkPreviewsConfig
+	timelines     timelinesConfig
+	ranking       rankingConfig
+	explore       exploreConfig
+	syndication   syndicationConfig
+	stream        streamConfig
+	maxPostImages int
+	trash         trashConfig
+	scheduler     schedulerConfig
+}
+
+type schedulerConfig struct {
+	interval time.Duration
+}
+
+type trashConfig struct {
+	retention      time.Duration
+	purgeInterval  time.Duration
+	purgeBatchSize int
+}
+
+type uploadsConfig struct {
+	// maxRequestSize caps a whole upload request, form fields included
+	maxRequestSize int64
+	maxImageSize   int64
+	maxVideoSize   int64
+	// An upload request has timeout plus the time its body takes to arrive
+	// at minRate bytes a second to be received and stored, in place of the
+	// server's read and write timeouts. Videos get far longer than images.
+	timeout  time.Duration
+	minRate  int64
+	sessions uploadSessionsConfig
+}
+
+// uploadSessionsConfig covers resumable uploads. Sessions expire once no
+// chunk has arrived for ttl.
+type uploadSessionsConfig struct {
+	dir             string
+	ttl             time.Duration
+	cleanupInterval time.Duration
+}
+
+// mediaGCConfig controls the collection of images nothing uses. Unused
+// images are kept for gracePeriod, so fresh uploads can still be attached.
+type mediaGCConfig struct {
+	interval    time.Duration
+	gracePeriod time.Duration
+	batchSize   int
+}
+
+// linkPreviewsConfig covers fetching link previews for posts in the
+// background.
+type linkPreviewsConfig struct {
+	fetch        unfurl.Config
+	workers      int
+	pollInterval time.Duration
+	retryDelay   time.Duration
+	maxAttempts  int
+	// cacheTTL is how long a fetched preview is reused before the page is
+	// fetched again
+	cacheTTL time.Duration
+}
+
+// timelinesConfig covers the home timelines cached in Redis, which a pool
+// of background workers pushes new posts into.
+type timelinesConfig struct {
+	// fanoutMaxFollowers is the follower count from which an author's
+	// posts are merged into timelines when read rather than pushed
+	fanoutMaxFollowers int
+	workers            int
+	pollInterval       time.Duration
+	jobTimeout         time.Duration
+	retryDelay         time.Duration
+	maxAttempts        int
+}
+
+// rankingConfig covers the ranked "for you" feed. Candidates are the
+// newest posts from the last window, up to maxCandidates of them.
+type rankingConfig struct {
+	weights           ranking.Weights
+	window            time.Duration
+	maxCandidates     int
+	interactionWindow time.Duration
+}
+
+// exploreConfig covers the explore feed of popular posts created in the
+// last window. The higher gravity, the faster posts fall down it with age.
+type exploreConfig struct {
+	window  time.Duration
+	gravity float64
+}
+
+// syndicationConfig covers the RSS, Atom and JSON feeds of users' posts,
+// which feed readers may cache for maxAge.
+type syndicationConfig struct {
+	maxItems int
+	maxAge   time.Duration
+	// baseURL is the scheme and host the API is reached at from outside,
+	// which feeds link back to themselves with
+	baseURL string
+}
+
+// streamConfig covers the real-time event streams. Connections get a
+// heartbeat every heartbeat and are dropped when a write takes longer than
+// writeTimeout; each buffers up to buffer events.
+type streamConfig struct {
+	heartbeat    time.Duration
+	writeTimeout time.Duration
+	// retry is how long SSE clients wait before reconnecting
+	retry  time.Duration
+	buffer int
+}
+
+// videoConfig covers video and animated GIF uploads, which are transcoded
+// by a pool of background workers using ffmpeg.
+type videoConfig struct {
+	ffmpegPath   string
+	ffprobePath  string
+	maxDuration  time.Duration
+	maxSide      int
+	workers      int
+	pollInterval time.Duration
+	jobTimeout   time.Duration
+	retryDelay   time.Duration
+	maxAttempts  int
+}
+
+type imagesConfig struct {
+	limits imaging.Limits
+}
+
+type blobConfig struct {
+	driver string
+	local  blob.LocalConfig
+	s3     blob.S3Config
 }
 
 type redisConfig struct {
@@ -100,15 +250,16 @@ func (app *application) mount() http.Handler {
 
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(streamTokenMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://localhost:5173"), "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset"},
+		ExposedHeaders:   []string{"Link", "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Length", "Upload-Offset", "Upload-Expires"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
@@ -117,14 +268,34 @@ func (app *application) mount() http.Handler {
 	// Set a timeout value on the request context (ctx), that will signal
 	// through ctx.Done() that the request has timed out and further
 	// processing should be stopped.
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(timeoutMiddleware(60*time.Second, isLongRunning))
 
 	r.Route("/v1", func(r chi.Router) {
 		r.Route("/uploads", func(r chi.Router) {
-			r.Use(app.FileUploadMiddleware)
-			r.Post("/", app.uploadImageHandler)
+			r.With(app.AuthTokenMiddleware, app.UploadDeadlineMiddleware, app.FileUploadMiddleware).Post("/", app.uploadImageHandler)
+			r.With(app.AuthTokenMiddleware).Get("/{mediaID}", app.getMediaHandler)
+
+			r.Route("/sessions", func(r chi.Router) {
+				r.Use(app.tusMiddleware)
+				r.Options("/", app.uploadOptionsHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.AuthTokenMiddleware)
+					r.Post("/", app.createUploadSessionHandler)
+
+					r.Route("/{uploadID}", func(r chi.Router) {
+						r.Use(app.uploadSessionContextMiddleware)
+						r.Head("/", app.headUploadSessionHandler)
+						r.Get("/", app.getUploadSessionHandler)
+						r.With(app.UploadDeadlineMiddleware).Patch("/", app.patchUploadSessionHandler)
+						r.Delete("/", app.deleteUploadSessionHandler)
+					})
+				})
+			})
 		})
 
+		r.Get("/media/*", app.serveMediaHandler)
+
 		r.With(app.BasicAuthMiddleware()).Get("/health", app.healthCheckHandler)
 		r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
 		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
@@ -133,28 +304,87 @@ func (app *application) mount() http.Handler {
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
 			r.Post("/", app.createPostHandler)
+			r.Get("/drafts", app.getDraftsHandler)
+			r.Get("/explore", app.getExploreHandler)
+			r.Route("/trash", func(r chi.Router) {
+				r.Get("/", app.getTrashHandler)
+				r.Post("/{postId}/restore", app.restorePostHandler)
+			})
 			r.Route("/{postId}", func(r chi.Router) {
 				r.Use(app.postsContextMiddleware)
 				r.Get("/", app.getPostHandler)
 				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
 				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
+				r.Post("/publish", app.publishPostHandler)
+				r.Delete("/schedule", app.unschedulePostHandler)
+				r.Route("/revisions", func(r chi.Router) {
+					r.Get("/", app.getPostRevisionsHandler)
+					r.Get("/diff", app.diffPostRevisionsHandler)
+					r.Post("/{version}/restore", app.checkPostOwnership("moderator", app.restorePostRevisionHandler))
+				})
+				r.Put("/reaction", app.reactToPostHandler)
+				r.Delete("/reaction", app.unreactToPostHandler)
 				r.Route("/comments", func(r chi.Router) {
 					r.Use(app.postsContextMiddleware)
 					r.Post("/", app.createCommentHandler)
 				})
 			})
 		})
+		r.Route("/tags", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/trending", app.getTrendingTagsHandler)
+			r.Route("/{tag}", func(r chi.Router) {
+				r.Get("/", app.getTagHandler)
+				r.Get("/posts", app.getTagPostsHandler)
+				r.Put("/follow", app.followTagHandler)
+				r.Put("/unfollow", app.unfollowTagHandler)
+			})
+		})
+
+		r.Route("/notifications", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/", app.getNotificationsHandler)
+			r.Get("/unread-count", app.getUnreadNotificationsCountHandler)
+			r.Post("/read-all", app.markAllNotificationsReadHandler)
+			r.Post("/{notificationID}/read", app.markNotificationReadHandler)
+		})
+
+		r.Route("/search", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/posts", app.searchPostsHandler)
+			r.Get("/comments", app.searchCommentsHandler)
+			r.Get("/users", app.searchUsersHandler)
+			r.Get("/autocomplete", app.autocompleteHandler)
+		})
+
+		r.Get("/feeds/users/{userID}/{format}", app.getSyndicationFeedHandler)
+
+		r.Route("/stream", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Get("/", app.streamEventsHandler)
+			r.Get("/ws", app.streamWebSocketHandler)
+		})
+
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
 			r.Route("/{userID}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 				r.Get("/", app.getUserHandler)
+				r.Get("/posts", app.getUserPostsHandler)
 				r.Put("/follow", app.followUserHandler)
 				r.Put("/unfollow", app.unfollowUserHandler)
+				r.Put("/block", app.blockUserHandler)
+				r.Put("/unblock", app.unblockUserHandler)
 			})
 			r.Group(func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 				r.Get("/feed", app.getUserFeedHandler)
+				r.Get("/feed/for-you", app.getForYouFeedHandler)
+				r.Get("/mentions", app.getMentionsHandler)
+				r.Put("/feeds", app.setFeedsEnabledHandler)
+				r.Put("/display-name", app.setDisplayNameHandler)
+				r.Put("/avatar", app.setAvatarHandler)
+				r.Delete("/avatar", app.deleteAvatarHandler)
 			})
 
 			// Public routes
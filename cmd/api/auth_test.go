@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestRegisterUserPayloadUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		valid    bool
+	}{
+		{username: "alice", valid: true},
+		{username: "josé", valid: true},
+		{username: "john.doe", valid: true},
+		{username: "", valid: false},
+		{username: "john-doe", valid: false},
+		{username: "john doe", valid: false},
+		{username: "john.", valid: false},
+		{username: "bob@example.com", valid: false},
+	}
+
+	for _, tt := range tests {
+		payload := RegisterUserPayload{Username: tt.username, Email: "a@example.com", Password: "secret"}
+		if err := Validate.Struct(payload); (err == nil) != tt.valid {
+			t.Errorf("username %q: Validate.Struct() = %v, want valid %v", tt.username, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+type PublishPostPayload struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	drafts, err := app.store.Posts.GetDrafts(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, drafts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// publishPostHandler publishes a draft right away, or schedules it when the
+// payload carries a publish_at time.
+func (app *application) publishPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	if post.UserID != user.ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	var payload PublishPostPayload
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &payload); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	var err error
+	if payload.PublishAt != nil {
+		if !payload.PublishAt.After(time.Now()) {
+			app.badRequestError(w, r, errors.New("publish_at must be in the future"))
+			return
+		}
+		err = app.store.Posts.Schedule(ctx, post, *payload.PublishAt)
+	} else {
+		err = app.store.Posts.Publish(ctx, post)
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.conflictError(w, r, errors.New("post is already published"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) unschedulePostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	if post.UserID != user.ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	if err := app.store.Posts.Unschedule(r.Context(), post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.conflictError(w, r, errors.New("post is not scheduled"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) publishScheduledPosts(ctx context.Context) error {
+	published, err := app.store.Posts.PublishScheduled(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range published {
+		app.logger.Infow("published scheduled post", "post_id", post.ID, "user_id", post.UserID)
+	}
+
+	return nil
+}
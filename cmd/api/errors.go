@@ -25,7 +25,7 @@ func (app *application) notFoundError(w http.ResponseWriter, r *http.Request, er
 func (app *application) conflictError(w http.ResponseWriter, r *http.Request, err error) {
 
 	app.logger.Errorf("conflict response", "method", r.Method, "path", r.URL.Path, "error", err.Error())
-	writeJSONError(w, http.StatusConflict, "resource not found")
+	writeJSONError(w, http.StatusConflict, "resource conflict")
 }
 
 func (app *application) unAuthorizedErr(w http.ResponseWriter, r *http.Request, err error) {
@@ -52,3 +52,18 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	w.Header().Set("Retry-After", retryAfter)
 	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry after: "+retryAfter)
 }
+
+func (app *application) payloadTooLargeError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("payload too large", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+func (app *application) unsupportedMediaTypeError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("unsupported media type", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
+
+func (app *application) lockedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("resource locked", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+	writeJSONError(w, http.StatusLocked, err.Error())
+}
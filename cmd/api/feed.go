@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/supremed3v/social-media/internal/store"
 )
 
@@ -26,14 +29,123 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 
 	}
 
+	user := getUserFromContext(r)
+
+	ctx := r.Context()
+	feed, page, err := app.getTimeline(ctx, user.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadFeedAttachments(ctx, feed); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, feed, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getUserPostsHandler lists a user's published posts that the current
+// user is allowed to see.
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	authorID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err = fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if _, err := app.getUser(ctx, authorID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	posts, page, err := app.store.Posts.GetByUser(ctx, user.ID, authorID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadFeedAttachments(ctx, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, posts, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getExploreHandler lists popular recent public posts from everyone. It
+// takes the filters of the other feeds but pages by offset, since posts
+// move around as their popularity changes.
+func (app *application) getExploreHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if fq.Cursor != nil {
+		app.badRequestError(w, r, errors.New("explore is paged by offset, not cursor"))
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
 	ctx := r.Context()
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(82), fq)
+
+	cfg := app.config.explore
+	posts, err := app.store.Posts.GetExplore(ctx, user.ID, cfg.window, cfg.gravity, app.config.ranking.weights.CommentWeight, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	if err := app.loadFeedAttachments(ctx, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
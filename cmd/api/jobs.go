@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// startBackgroundJobs launches the periodic maintenance jobs. They stop
+// when ctx is cancelled.
+func (app *application) startBackgroundJobs(ctx context.Context) {
+	go app.runPeriodically(ctx, "purge trash", app.config.trash.purgeInterval, app.purgeTrash)
+	go app.runPeriodically(ctx, "publish scheduled posts", app.config.scheduler.interval, app.publishScheduledPosts)
+	go app.runPeriodically(ctx, "expire upload sessions", app.config.uploads.sessions.cleanupInterval, app.expireUploadSessions)
+	go app.runPeriodically(ctx, "collect unused media", app.config.mediaGC.interval, app.collectMediaGarbage)
+
+	for i := 0; i < app.config.linkPreviews.workers; i++ {
+		go app.runPeriodically(ctx, "fetch link previews", app.config.linkPreviews.pollInterval, app.fetchPendingLinkPreviews)
+	}
+
+	for i := 0; i < app.config.timelines.workers; i++ {
+		go app.runPeriodically(ctx, "fan out posts", app.config.timelines.pollInterval, app.fanOutPosts)
+	}
+
+	if app.transcoder != nil {
+		for i := 0; i < app.config.video.workers; i++ {
+			go app.runPeriodically(ctx, "transcode media", app.config.video.pollInterval, app.transcodePendingMedia)
+		}
+	}
+}
+
+// runPeriodically calls fn every interval until ctx is cancelled. Failures
+// are logged and retried on the next tick.
+func (app *application) runPeriodically(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := fn(ctx); err != nil {
+			app.logger.Errorw("background job failed", "job", name, "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) purgeTrash(ctx context.Context) error {
+	purged, err := app.store.Posts.Purge(ctx, app.config.trash.retention, app.config.trash.purgeBatchSize)
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		app.logger.Infow("purged deleted posts", "count", purged)
+	}
+
+	return nil
+}
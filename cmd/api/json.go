@@ -3,16 +3,23 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/supremed3v/social-media/internal/mention"
+	"github.com/supremed3v/social-media/internal/store"
 )
 
 var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// usernames have to be mentionable as a whole
+	Validate.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return mention.ValidUsername(fl.Field().String())
+	})
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
@@ -32,37 +39,6 @@ func readJSON(w http.ResponseWriter, r *http.Request, data any) error {
 	return decoder.Decode(data)
 }
 
-func readFile(r *http.Request, fieldName string, maxBytes int64) ([]byte, string, string, error) {
-	// Parse the multipart form with the specified memory limit
-	err := r.ParseMultipartForm(maxBytes)
-	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to parse multipart form: %w", err)
-	}
-
-	// Retrieve the file from the form field
-	file, header, err := r.FormFile(fieldName)
-	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to retrieve file: %w", err)
-	}
-	defer file.Close()
-
-	// Check file size
-	if header.Size > maxBytes {
-		return nil, "", "", fmt.Errorf("file size exceeds the limit of %d bytes", maxBytes)
-	}
-
-	// Read the file bytes
-	fileBytes, err := io.ReadAll(file)
-	if err != nil {
-		return nil, "", "", fmt.Errorf("failed to read file: %w", err)
-	}
-
-	// Detect the file's content type
-	fileType := http.DetectContentType(fileBytes)
-
-	return fileBytes, header.Filename, fileType, nil
-}
-
 func writeJSONError(w http.ResponseWriter, status int, message string) error {
 	type envelope struct {
 		Error string `json:"error"`
@@ -79,3 +55,31 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 
 	return writeJSON(w, status, &envelope{Data: data})
 }
+
+// paginatedResponse is jsonResponse for one page of a list. The cursors of
+// the pages around it go both in the envelope and in a Link header, as
+// links to this same request with the cursor swapped in.
+func (app *application) paginatedResponse(w http.ResponseWriter, r *http.Request, status int, data any, page store.PageInfo) error {
+	type envelope struct {
+		Data any    `json:"data"`
+		Next string `json:"next,omitempty"`
+		Prev string `json:"prev,omitempty"`
+	}
+
+	var links []string
+	for _, l := range []struct{ rel, cursor string }{{"next", page.Next}, {"prev", page.Prev}} {
+		if l.cursor == "" {
+			continue
+		}
+
+		qs := r.URL.Query()
+		qs.Del("offset")
+		qs.Set("cursor", l.cursor)
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, qs.Encode(), l.rel))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	return writeJSON(w, status, &envelope{Data: data, Next: page.Next, Prev: page.Prev})
+}
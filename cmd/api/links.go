@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/unfurl"
+)
+
+// fetchPendingLinkPreviews works through the links waiting for a preview
+// until there are none left. Leases in the database keep the workers from
+// fetching the same link.
+func (app *application) fetchPendingLinkPreviews(ctx context.Context) error {
+	cfg := app.config.linkPreviews
+
+	for ctx.Err() == nil {
+		// the lease outlasts the fetch's own timeout
+		lease := 2 * cfg.fetch.Timeout
+		preview, err := app.store.LinkPreviews.ClaimPending(ctx, lease, cfg.maxAttempts)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		p, err := app.unfurler.Unfurl(ctx, preview.URL)
+		if err != nil {
+			app.logger.Infow("failed to fetch link preview", "url", preview.URL, "error", err.Error())
+
+			err := app.store.LinkPreviews.Fail(ctx, preview, err.Error(), unfurl.Permanent(err), cfg.retryDelay, cfg.maxAttempts, cfg.cacheTTL)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+			continue
+		}
+
+		preview.Title = p.Title
+		preview.Description = p.Description
+		preview.ImageURL = p.ImageURL
+		preview.SiteName = p.SiteName
+		preview.Type = p.Type
+
+		if err := app.store.LinkPreviews.Finish(ctx, preview, cfg.cacheTTL); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/supremed3v/social-media/internal/blob"
+	"github.com/supremed3v/social-media/internal/cloudinary"
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+func newBlobStorage(cfg config) (blob.Storage, error) {
+	switch cfg.blob.driver {
+	case "local":
+		return blob.NewLocal(cfg.blob.local)
+	case "s3":
+		return blob.NewS3(cfg.blob.s3)
+	case "cloudinary":
+		return cloudinary.NewCloudinary(cfg.cloudinary)
+	default:
+		return nil, fmt.Errorf("unknown blob storage driver: %q", cfg.blob.driver)
+	}
+}
+
+// serveMediaHandler serves files kept by the local blob driver. Access is
+// granted by the signature in the URL rather than a bearer token, so the
+// links work in plain <img> tags.
+func (app *application) serveMediaHandler(w http.ResponseWriter, r *http.Request) {
+	local, ok := app.blob.(*blob.Local)
+	if !ok {
+		app.notFoundError(w, r, errors.New("media is not served by the api"))
+		return
+	}
+
+	key, err := url.PathUnescape(chi.URLParam(r, "*"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	qs := r.URL.Query()
+	f, err := local.Open(key, qs.Get("expires"), qs.Get("signature"))
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrInvalidSignature):
+			app.forbiddenResponse(w, r)
+		case errors.Is(err, blob.ErrNotFound), errors.Is(err, blob.ErrInvalidKey):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, path.Base(key), info.ModTime(), f)
+}
+
+// resolveImageURLs fills in download URLs for images kept in blob storage.
+// Images uploaded before blob storage keep the URL stored with them.
+func (app *application) resolveImageURLs(images []store.Image) {
+	for i := range images {
+		if images[i].StorageKey == "" {
+			continue
+		}
+
+		u, err := app.blob.URL(images[i].StorageKey)
+		if err != nil {
+			app.logger.Errorw("failed to build image url", "image_id", images[i].ID, "error", err.Error())
+			continue
+		}
+		images[i].ImageURL = u
+
+		for n, v := range images[i].Variants {
+			u, err := app.blob.URL(v.StorageKey)
+			if err != nil {
+				app.logger.Errorw("failed to build image url", "image_id", images[i].ID, "variant", v.Name, "error", err.Error())
+				continue
+			}
+			images[i].Variants[n].URL = u
+		}
+	}
+}
+
+// collectMediaGarbage deletes images no post or avatar has used within the
+// grace period, then removes their files from blob storage. Files that fail
+// to delete stay queued and are retried on the next run.
+func (app *application) collectMediaGarbage(ctx context.Context) error {
+	collected, err := app.store.Images.CollectGarbage(ctx, app.config.mediaGC.gracePeriod, app.config.mediaGC.batchSize)
+	if err != nil {
+		return err
+	}
+
+	keys, err := app.store.Images.PendingBlobDeletions(ctx, app.config.mediaGC.batchSize)
+	if err != nil {
+		return err
+	}
+
+	deleted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if err := app.blob.Delete(ctx, key); err != nil {
+			app.logger.Errorw("failed to delete media file", "key", key, "error", err.Error())
+			continue
+		}
+		deleted = append(deleted, key)
+	}
+
+	if len(deleted) > 0 {
+		if err := app.store.Images.ClearBlobDeletions(ctx, deleted); err != nil {
+			return err
+		}
+	}
+
+	if collected > 0 || len(deleted) > 0 {
+		app.logger.Infow("collected unused media", "images", collected, "files", len(deleted))
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/supremed3v/social-media/internal/mention"
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+// getMentionsHandler lists the posts mentioning the current user, in the post
+// or in one of its comments.
+func (app *application) getMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	posts, page, err := app.store.Posts.GetMentioning(ctx, user.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadFeedAttachments(ctx, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, posts, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// loadPostMentions sets the mention entities of the posts from the users
+// recorded as mentioned when they were last saved.
+func (app *application) loadPostMentions(ctx context.Context, posts ...*store.Post) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	mentions, err := app.store.Mentions.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Mentions = mention.Resolve(p.Content, mentions[p.ID])
+	}
+
+	return nil
+}
+
+// loadCommentMentions is loadPostMentions for comments.
+func (app *application) loadCommentMentions(ctx context.Context, comments []store.Comment) error {
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+
+	mentions, err := app.store.Mentions.GetByCommentIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range comments {
+		comments[i].Mentions = mention.Resolve(comments[i].Content, mentions[comments[i].ID])
+	}
+
+	return nil
+}
+
+// mentionedViewers returns the users among mentions who are allowed to see
+// the post, other than those in skip.
+func (app *application) mentionedViewers(ctx context.Context, post *store.Post, mentions []mention.Mention, skip ...int64) ([]int64, error) {
+	var ids []int64
+	for _, m := range mentions {
+		if m.UserID == 0 || slices.Contains(skip, m.UserID) || slices.Contains(ids, m.UserID) {
+			continue
+		}
+
+		visible, err := app.store.Posts.CanView(ctx, post, m.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if visible {
+			ids = append(ids, m.UserID)
+		}
+	}
+
+	return ids, nil
+}
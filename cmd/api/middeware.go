@@ -3,14 +3,16 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/upload"
 )
 
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
@@ -172,55 +174,53 @@ func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// FileUploadMiddleware only lets multipart bodies through and caps their
+// size. The body itself is streamed by the handlers, never buffered here.
 func (app *application) FileUploadMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Parse the multipart form with a memory limit
-		if err := r.ParseMultipartForm(app.config.maxMultipartMem); err != nil {
-			app.badRequestError(w, r, fmt.Errorf("failed to parse multipart form: %w", err))
+		if !upload.IsMultipart(r) {
+			app.badRequestError(w, r, fmt.Errorf("expected a multipart/form-data upload"))
 			return
 		}
 
-		// Retrieve the file from the form
-		file, header, err := r.FormFile("file")
-		if err != nil {
-			app.badRequestError(w, r, fmt.Errorf("failed to retrieve file: %w", err))
-			return
-		}
-		defer file.Close()
+		r.Body = http.MaxBytesReader(w, r.Body, app.config.uploads.maxRequestSize)
 
-		// Check file size
-		if header.Size > app.config.maxMultipartMem {
-			app.badRequestError(w, r, fmt.Errorf("file size exceeds the limit of %d bytes", app.config.maxMultipartMem))
-			return
-		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		// Read file bytes
-		fileBytes, err := io.ReadAll(file)
-		if err != nil {
-			app.badRequestError(w, r, fmt.Errorf("failed to read file: %w", err))
+// UploadDeadlineMiddleware gives uploads time to arrive and be stored in
+// proportion to their size, where the server's read and write timeouts
+// would cut them off. Upload routes are exempt from timeoutMiddleware, so
+// this deadline also bounds the request context.
+func (app *application) UploadDeadlineMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline := time.Now().Add(app.uploadTimeout(r.ContentLength))
+
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			app.internalServerError(w, r, err)
 			return
 		}
-
-		// Check file type
-		fileType := http.DetectContentType(fileBytes)
-		if !strings.HasPrefix(fileType, "image") {
-			app.badRequestError(w, r, fmt.Errorf("uploaded file is not an image, detected type: %s", fileType))
+		if err := rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			app.internalServerError(w, r, err)
 			return
 		}
 
-		// Use unique context key types
-		type contextKey string
-		const (
-			fileKey     contextKey = "file"
-			fileNameKey contextKey = "fileName"
-		)
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
 
-		// Add file data to the request context
-		ctx := context.WithValue(r.Context(), fileKey, fileBytes)
-		ctx = context.WithValue(ctx, fileNameKey, header.Filename)
-		r = r.WithContext(ctx)
-
-		// Pass the request to the next handler
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// uploadTimeout is how long an upload of size bytes may take. Bodies of
+// unknown size are given the time the largest upload allowed would take.
+func (app *application) uploadTimeout(size int64) time.Duration {
+	cfg := app.config.uploads
+	if size < 0 || size > cfg.maxRequestSize {
+		size = cfg.maxRequestSize
+	}
+
+	return cfg.timeout + time.Duration(size/max(cfg.minRate, 1))*time.Second
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/stream"
+)
+
+// notificationEvent is what connected clients are sent when a notification
+// comes in or grows.
+type notificationEvent struct {
+	Notification *store.Notification `json:"notification"`
+	UnreadCount  int                 `json:"unread_count"`
+}
+
+// notify records a notification and streams it to the user. Failures are
+// only logged; whatever the notification is about already happened.
+func (app *application) notify(ctx context.Context, e store.NotificationEvent) {
+	if err := app.sendNotification(ctx, e); err != nil {
+		app.logger.Warnw("failed to notify user", "user_id", e.UserID, "type", e.Type, "error", err.Error())
+	}
+}
+
+func (app *application) sendNotification(ctx context.Context, e store.NotificationEvent) error {
+	n, err := app.store.Notifications.Add(ctx, e)
+	if err != nil || n == nil {
+		return err
+	}
+
+	unread, err := app.store.Notifications.UnreadCount(ctx, e.UserID)
+	if err != nil {
+		return err
+	}
+
+	se, err := stream.NewEvent(stream.EventNotification, notificationEvent{Notification: n, UnreadCount: unread})
+	if err != nil {
+		return err
+	}
+
+	return app.broker.Publish(ctx, se, e.UserID)
+}
+
+// retractNotification takes back an event that was undone, such as an
+// unfollow. Failures are only logged.
+func (app *application) retractNotification(ctx context.Context, e store.NotificationEvent) {
+	if err := app.store.Notifications.Retract(ctx, e); err != nil {
+		app.logger.Warnw("failed to retract notification", "user_id", e.UserID, "type", e.Type, "error", err.Error())
+	}
+}
+
+// getNotificationsHandler lists the current user's notifications, the most
+// recently active first, paged forwards by cursor. ?unread=true leaves out
+// those already read.
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if fq.Offset != 0 || fq.Sort != "desc" || (fq.Cursor != nil && fq.Cursor.Prev) {
+		app.badRequestError(w, r, errors.New("notifications are only paged forwards by cursor"))
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	unreadOnly := false
+	if v := r.URL.Query().Get("unread"); v != "" {
+		u, err := strconv.ParseBool(v)
+		if err != nil {
+			app.badRequestError(w, r, errors.New("unread must be true or false"))
+			return
+		}
+		unreadOnly = u
+	}
+
+	user := getUserFromContext(r)
+
+	notifications, page, err := app.store.Notifications.List(r.Context(), user.ID, unreadOnly, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, notifications, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getUnreadNotificationsCountHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	count, err := app.store.Notifications.UnreadCount(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]int{"unread_count": count}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Notifications.MarkRead(r.Context(), user.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	marked, err := app.store.Notifications.MarkAllRead(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]int64{"marked": marked}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -1,14 +1,13 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/supremed3v/social-media/internal/store"
@@ -19,9 +18,13 @@ type postKey string
 const postCtx postKey = "post"
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Title      string     `json:"title" validate:"required,max=100"`
+	Content    string     `json:"content" validate:"required,max=1000"`
+	Tags       []string   `json:"tags" validate:"max=10"`
+	Status     string     `json:"status" validate:"omitempty,oneof=draft published"`
+	PublishAt  *time.Time `json:"publish_at"`
+	Visibility string     `json:"visibility" validate:"omitempty,oneof=public followers mentioned"`
+	ImageIDs   []int64    `json:"image_ids" validate:"omitempty,unique"`
 }
 
 type CreateImagePayload struct {
@@ -46,18 +49,56 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if len(payload.ImageIDs) > app.config.maxPostImages {
+		app.badRequestError(w, r, fmt.Errorf("a post can have at most %d images", app.config.maxPostImages))
+		return
+	}
+
+	tags, err := normalizeTags(payload.Tags)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
 	user := getUserFromContext(r)
 
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  user.ID,
+		Title:      payload.Title,
+		Content:    payload.Content,
+		Tags:       tags,
+		UserID:     user.ID,
+		Status:     payload.Status,
+		Visibility: payload.Visibility,
+	}
+
+	for _, id := range payload.ImageIDs {
+		post.Images = append(post.Images, store.Image{ID: id})
+	}
+
+	// a publish time always means the post waits for the scheduler
+	if payload.PublishAt != nil {
+		if !payload.PublishAt.After(time.Now()) {
+			app.badRequestError(w, r, errors.New("publish_at must be in the future"))
+			return
+		}
+		publishAt := payload.PublishAt.UTC().Format(time.RFC3339)
+		post.Status = store.PostStatusScheduled
+		post.PublishAt = &publishAt
 	}
 
 	ctx := r.Context()
 
 	if err := app.store.Posts.Create(ctx, post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrImageNotOwned):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.loadPostAttachments(ctx, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -79,6 +120,16 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	post.Comments = comments
+
+	if err := app.loadPostAttachments(r.Context(), post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadCommentMentions(r.Context(), post.Comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 	if err := app.jsonResponse(w, http.StatusFound, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -87,14 +138,12 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "postId")
-	id, err := strconv.ParseInt(idParam, 10, 64)
-	if err != nil {
-		app.internalServerError(w, r, err)
-	}
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
 	ctx := r.Context()
 
-	err = app.store.Posts.Delete(ctx, id)
+	err := app.store.Posts.Delete(ctx, post.ID, user.ID)
 
 	if err != nil {
 		switch {
@@ -111,8 +160,10 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title      *string   `json:"title" validate:"omitempty,max=100"`
+	Content    *string   `json:"content" validate:"omitempty,max=1000"`
+	Visibility *string   `json:"visibility" validate:"omitempty,oneof=public followers mentioned"`
+	Tags       *[]string `json:"tags" validate:"omitempty,max=10"`
 }
 
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -137,7 +188,34 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+
+	if payload.Visibility != nil {
+		post.Visibility = *payload.Visibility
+	}
+
+	if payload.Tags != nil {
+		tags, err := normalizeTags(*payload.Tags)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		post.Tags = tags
+	}
+	user := getUserFromContext(r)
+
+	if err := app.store.Posts.Update(r.Context(), post, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.loadPostAttachments(r.Context(), post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -171,6 +249,25 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// drafts and scheduled posts only exist for their author, and posts
+		// outside the user's audience are reported as missing rather than
+		// forbidden so their existence isn't leaked
+		user := getUserFromContext(r)
+		if post.Status != store.PostStatusPublished && user.ID != post.UserID {
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
+		visible, err := app.store.Posts.CanView(ctx, post, user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !visible {
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -203,10 +300,14 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	user := getUserFromContext(r)
+
+	// mentions are filtered by who is writing, so the comment has to be
+	// attributed to its real author
 	comment := &store.Comment{
 		Content: payload.Content,
 		PostID:  post.ID,
-		UserID:  post.UserID, // Replace with actual user ID after authentication
+		UserID:  user.ID,
 	}
 
 	ctx := r.Context()
@@ -215,49 +316,54 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	comments := []store.Comment{*comment}
+	if err := app.loadCommentMentions(ctx, comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	comment = &comments[0]
+
+	app.announceComment(ctx, post, comment)
+
 	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
-type ImagePayload struct {
-	Image string `json:"image"`
-}
+// loadFeedAttachments is loadPostAttachments for a page of posts.
+func (app *application) loadFeedAttachments(ctx context.Context, feed []store.PostWithMetadata) error {
+	posts := make([]*store.Post, len(feed))
+	for i := range feed {
+		posts[i] = &feed[i].Post
+	}
 
-func (app *application) uploadImageHandler(w http.ResponseWriter, r *http.Request) {
-	// Maximum file size: 10 MB
-	const maxFileSize = 10 * 1024 * 1024
+	return app.loadPostAttachments(ctx, posts...)
+}
 
-	// Read the file from the request
-	fileBytes, fileName, fileType, err := readFile(r, "file", maxFileSize)
-	if err != nil {
-		app.badRequestError(w, r, fmt.Errorf("file upload error: %w", err))
-		return
+// loadPostAttachments fills in everything shown with a post besides its
+// own columns: images, mention entities and link previews.
+func (app *application) loadPostAttachments(ctx context.Context, posts ...*store.Post) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
 	}
 
-	// Validate file type
-	if !strings.HasPrefix(fileType, "image") {
-		app.badRequestError(w, r, fmt.Errorf("invalid file type: %s", fileType))
-		return
+	images, err := app.store.Images.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
 	}
 
-	// Upload the file to Cloudinary
-	secureURL, err := app.cloudinary.UploadImageFromReader(r.Context(), bytes.NewReader(fileBytes), fileName)
+	links, err := app.store.LinkPreviews.GetByPostIDs(ctx, ids)
 	if err != nil {
-		app.internalServerError(w, r, fmt.Errorf("failed to upload image: %w", err))
-		return
+		return err
 	}
 
-	// Save the image URL in the database (if needed)
-	image := &store.Image{ImageURL: secureURL}
-	if err := app.store.Posts.PostImage(r.Context(), image.ImageURL); err != nil {
-		app.internalServerError(w, r, fmt.Errorf("failed to save image in the database: %w", err))
-		return
+	for _, p := range posts {
+		p.Images = images[p.ID]
+		app.resolveImageURLs(p.Images)
+		p.Links = links[p.ID]
 	}
 
-	// Respond with the uploaded image URL
-	if err := app.jsonResponse(w, http.StatusCreated, image); err != nil {
-		app.internalServerError(w, r, err)
-	}
+	return app.loadPostMentions(ctx, posts...)
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/supremed3v/social-media/internal/ranking"
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+type ReactToPostPayload struct {
+	Reaction string `json:"reaction" validate:"required,oneof=like love laugh insightful"`
+}
+
+// rankedPost is a post in the "for you" feed. Ranking explains its score
+// when the feed is requested with ?debug=true.
+type rankedPost struct {
+	store.PostWithMetadata
+	ReactionsCount int                  `json:"reactions_count"`
+	Ranking        *ranking.Explanation `json:"ranking,omitempty"`
+}
+
+// getForYouFeedHandler ranks recent posts from the user's follows, followed
+// tags and the accounts their follows follow. Unlike the chronological feed
+// it is paged by ?limit and ?offset only.
+func (app *application) getForYouFeedHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := app.config.ranking
+	qs := r.URL.Query()
+
+	limit := 20
+	if v := qs.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > 20 {
+			app.badRequestError(w, r, errors.New("limit must be between 1 and 20"))
+			return
+		}
+		limit = l
+	}
+
+	offset := 0
+	if v := qs.Get("offset"); v != "" {
+		o, err := strconv.Atoi(v)
+		if err != nil || o < 0 {
+			app.badRequestError(w, r, errors.New("offset must be a positive number"))
+			return
+		}
+		offset = o
+	}
+
+	debug := false
+	if v := qs.Get("debug"); v != "" {
+		d, err := strconv.ParseBool(v)
+		if err != nil {
+			app.badRequestError(w, r, errors.New("debug must be true or false"))
+			return
+		}
+		debug = d
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+	now := time.Now()
+
+	candidates, err := app.store.Posts.GetRankingCandidates(ctx, user.ID, now.Add(-cfg.window), now.Add(-cfg.interactionWindow), cfg.maxCandidates)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	signals := make([]ranking.Signals, len(candidates))
+	for i, c := range candidates {
+		createdAt, err := time.Parse(time.RFC3339Nano, c.CreatedAt)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		signals[i] = ranking.Signals{
+			AuthorID:     c.UserID,
+			CreatedAt:    createdAt,
+			Comments:     c.CommentsCount,
+			Reactions:    c.ReactionsCount,
+			Interactions: c.Interactions,
+			Source:       c.Source,
+		}
+	}
+
+	ranked := ranking.Rank(signals, cfg.weights, now)
+	if offset > len(ranked) {
+		offset = len(ranked)
+	}
+	ranked = ranked[offset:min(offset+limit, len(ranked))]
+
+	feed := make([]store.PostWithMetadata, len(ranked))
+	for i, rk := range ranked {
+		feed[i] = candidates[rk.Index].PostWithMetadata
+	}
+
+	if err := app.loadFeedAttachments(ctx, feed); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts := make([]rankedPost, len(ranked))
+	for i, rk := range ranked {
+		posts[i] = rankedPost{
+			PostWithMetadata: feed[i],
+			ReactionsCount:   candidates[rk.Index].ReactionsCount,
+		}
+		if debug {
+			posts[i].Ranking = &rk.Explanation
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// reactToPostHandler sets the user's reaction to the post, replacing any
+// earlier one.
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	var payload ReactToPostPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if post.Status != store.PostStatusPublished {
+		app.badRequestError(w, r, errors.New("only published posts can be reacted to"))
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	ctx := r.Context()
+
+	if err := app.store.Reactions.Set(ctx, post.ID, user.ID, payload.Reaction); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.notify(ctx, store.NotificationEvent{
+		Type:    store.NotificationReaction,
+		UserID:  post.UserID,
+		ActorID: user.ID,
+		PostID:  &post.ID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unreactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	ctx := r.Context()
+
+	if err := app.store.Reactions.Remove(ctx, post.ID, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.retractNotification(ctx, store.NotificationEvent{
+		Type:    store.NotificationReaction,
+		UserID:  post.UserID,
+		ActorID: user.ID,
+		PostID:  &post.ID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/upload"
+)
+
+// Resumable uploads follow the tus 1.0.0 protocol (https://tus.io) with the
+// creation, expiration and termination extensions, so off-the-shelf tus
+// clients work against /v1/uploads/sessions. Once the last chunk arrives
+// the upload goes through the same processing as a multipart upload and
+// the resulting image is linked to the session.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+
+	offsetContentType = "application/offset+octet-stream"
+)
+
+type uploadSessionKey string
+
+const uploadSessionCtx uploadSessionKey = "uploadSession"
+
+// tusMiddleware advertises the protocol version and turns away clients
+// speaking another one. Clients that don't send the header are served too.
+func (app *application) tusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+
+		if v := r.Header.Get("Tus-Resumable"); r.Method != http.MethodOptions && v != "" && v != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			writeJSONError(w, http.StatusPreconditionFailed, "unsupported tus version: "+v)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *application) uploadOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(app.maxUploadSize(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createUploadSessionHandler starts a resumable upload. The total size is
+// given in Upload-Length and may not change later; Upload-Metadata can
+// carry "filename" and "alt_text".
+func (app *application) createUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		app.badRequestError(w, r, errors.New("uploads of unknown length are not supported"))
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		app.badRequestError(w, r, errors.New("Upload-Length must be a positive integer"))
+		return
+	}
+	if length > app.maxUploadSize() {
+		app.payloadTooLargeError(w, r, fmt.Errorf("%w of %d bytes", upload.ErrTooLarge, app.maxUploadSize()))
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+	if len(metadata["alt_text"]) > maxAltTextLength {
+		app.badRequestError(w, r, fmt.Errorf("alt_text exceeds %d characters", maxAltTextLength))
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	session := &store.UploadSession{
+		ID:       uuid.New().String(),
+		UserID:   user.ID,
+		Length:   length,
+		Filename: metadata["filename"],
+		AltText:  metadata["alt_text"],
+	}
+
+	if err := app.store.UploadSessions.Create(r.Context(), session, app.config.uploads.sessions.ttl); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", path.Join(r.URL.Path, session.ID))
+	setUploadHeaders(w, session)
+
+	if err := app.jsonResponse(w, http.StatusCreated, session); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// headUploadSessionHandler tells a client where to resume from.
+func (app *application) headUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session := getUploadSessionFromCtx(r)
+
+	setUploadHeaders(w, session)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (app *application) getUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session := getUploadSessionFromCtx(r)
+
+	if session.ImageID != nil {
+		img, err := app.store.Images.GetByID(r.Context(), *session.ImageID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		images := []store.Image{*img}
+		app.resolveImageURLs(images)
+		session.Image = &images[0]
+	}
+
+	setUploadHeaders(w, session)
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := app.jsonResponse(w, http.StatusOK, session); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// patchUploadSessionHandler appends a chunk at the offset the client says
+// it is at, which has to match ours. Whatever arrives is kept even when
+// the connection drops part way, so the client can resume from there. An
+// empty chunk at the end retries an assembly that failed on our side.
+func (app *application) patchUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session := getUploadSessionFromCtx(r)
+
+	if ct := r.Header.Get("Content-Type"); ct != offsetContentType {
+		app.unsupportedMediaTypeError(w, r, fmt.Errorf("chunks must be sent as %s", offsetContentType))
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		app.badRequestError(w, r, errors.New("Upload-Offset must be a non-negative integer"))
+		return
+	}
+	if offset != session.Offset || session.ImageID != nil {
+		app.conflictError(w, r, fmt.Errorf("upload %s is at offset %d, got %d", session.ID, session.Offset, offset))
+		return
+	}
+
+	unlock, err := app.uploadDir.Lock(session.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, upload.ErrBusy):
+			app.lockedResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer unlock()
+
+	ctx := r.Context()
+
+	// the session was loaded before we held the lock, so check the offset again
+	current, err := app.store.UploadSessions.GetByID(ctx, session.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if current.Offset != offset || current.ImageID != nil {
+		app.conflictError(w, r, fmt.Errorf("upload %s is at offset %d, got %d", session.ID, current.Offset, offset))
+		return
+	}
+
+	n, appendErr := app.uploadDir.Append(session.ID, offset, r.Body, session.Length-offset)
+	if n > 0 {
+		if err := app.store.UploadSessions.Advance(ctx, session, offset+n, app.config.uploads.sessions.ttl); err != nil {
+			switch {
+			case errors.Is(err, store.ErrConflict):
+				app.conflictError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+	if appendErr != nil {
+		switch {
+		case errors.Is(appendErr, upload.ErrTooLarge):
+			app.payloadTooLargeError(w, r, appendErr)
+		case errors.Is(appendErr, upload.ErrMissingData):
+			// the upload can't be resumed, so the client has to start over
+			app.discardUploadSession(session.ID)
+			app.conflictError(w, r, appendErr)
+		default:
+			// most likely the client went away; what arrived is saved
+			app.badRequestError(w, r, fmt.Errorf("failed to read chunk: %w", appendErr))
+		}
+		return
+	}
+
+	if session.Complete() {
+		if err := app.completeUploadSession(ctx, session); err != nil {
+			app.uploadError(w, r, err)
+			return
+		}
+	}
+
+	setUploadHeaders(w, session)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUploadSessionHandler lets a client abandon an upload.
+func (app *application) deleteUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session := getUploadSessionFromCtx(r)
+
+	unlock, err := app.uploadDir.Lock(session.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, upload.ErrBusy):
+			app.lockedResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer unlock()
+
+	if err := app.store.UploadSessions.Delete(r.Context(), session.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.uploadDir.Remove(session.ID); err != nil {
+		app.logger.Errorw("failed to remove upload data", "upload_id", session.ID, "error", err.Error())
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// completeUploadSession turns a finished upload into media the same way a
+// multipart upload is. Uploads that turn out to be unusable are dropped,
+// since resuming them can't fix that.
+func (app *application) completeUploadSession(ctx context.Context, session *store.UploadSession) error {
+	f, err := app.uploadDir.Open(session.ID)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// sniff and hash the assembled file the same way a multipart upload is
+	file, err := upload.NewReader(f, session.Length)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, file); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	img, _, err := app.saveUpload(ctx, session.UserID, uploadedFile{
+		file:        f,
+		contentType: file.ContentType(),
+		sha256:      file.SHA256(),
+		size:        file.Size(),
+		altText:     session.AltText,
+	})
+	if err != nil {
+		if isInvalidMedia(err) {
+			app.discardUploadSession(session.ID)
+		}
+		return err
+	}
+
+	if err := app.store.UploadSessions.Complete(ctx, session, img); err != nil {
+		return err
+	}
+
+	if err := app.uploadDir.Remove(session.ID); err != nil {
+		app.logger.Errorw("failed to remove upload data", "upload_id", session.ID, "error", err.Error())
+	}
+
+	return nil
+}
+
+// discardUploadSession drops an upload that can't be completed. It runs
+// detached from the request, which may already be cancelled.
+func (app *application) discardUploadSession(id string) {
+	if err := app.store.UploadSessions.Delete(context.Background(), id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.logger.Errorw("failed to delete upload session", "upload_id", id, "error", err.Error())
+	}
+	if err := app.uploadDir.Remove(id); err != nil {
+		app.logger.Errorw("failed to remove upload data", "upload_id", id, "error", err.Error())
+	}
+}
+
+// expireUploadSessions removes sessions nobody has written to within the
+// expiry, along with their data. Data whose session is gone for another
+// reason is caught by its age.
+func (app *application) expireUploadSessions(ctx context.Context) error {
+	ids, err := app.store.UploadSessions.DeleteExpired(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := app.uploadDir.Remove(id); err != nil {
+			app.logger.Errorw("failed to remove upload data", "upload_id", id, "error", err.Error())
+		}
+	}
+
+	pruned, err := app.uploadDir.Prune(app.config.uploads.sessions.ttl)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) > 0 || pruned > 0 {
+		app.logger.Infow("expired upload sessions", "count", len(ids), "pruned_files", pruned)
+	}
+
+	return nil
+}
+
+func (app *application) uploadSessionContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(chi.URLParam(r, "uploadID"))
+		if err != nil {
+			app.notFoundError(w, r, err)
+			return
+		}
+
+		session, err := app.store.UploadSessions.GetByID(r.Context(), id.String())
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		// other users' uploads don't exist as far as the caller can tell
+		user := getUserFromContext(r)
+		if session.UserID != user.ID {
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), uploadSessionCtx, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getUploadSessionFromCtx(r *http.Request) *store.UploadSession {
+	session, _ := r.Context().Value(uploadSessionCtx).(*store.UploadSession)
+	return session
+}
+
+func setUploadHeaders(w http.ResponseWriter, session *store.UploadSession) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+
+	if expires, err := time.Parse(time.RFC3339Nano, session.ExpiresAt); err == nil {
+		w.Header().Set("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma separated
+// pairs of a key and its base64 encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata header")
+		}
+
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %q", key)
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
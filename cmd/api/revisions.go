@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/supremed3v/social-media/internal/diff"
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+type PostDiff struct {
+	PostID  int64       `json:"post_id"`
+	From    int         `json:"from"`
+	To      int         `json:"to"`
+	Title   []diff.Line `json:"title"`
+	Content []diff.Line `json:"content"`
+}
+
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	revisions, err := app.store.Revisions.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) diffPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	qs := r.URL.Query()
+
+	from, err := strconv.Atoi(qs.Get("from"))
+	if err != nil {
+		app.badRequestError(w, r, errors.New("from must be a post version"))
+		return
+	}
+
+	// to defaults to the current version of the post
+	to := post.Version
+	if v := qs.Get("to"); v != "" {
+		to, err = strconv.Atoi(v)
+		if err != nil {
+			app.badRequestError(w, r, errors.New("to must be a post version"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	older, err := app.getPostVersion(ctx, post, from)
+	if err != nil {
+		app.revisionError(w, r, err)
+		return
+	}
+
+	newer, err := app.getPostVersion(ctx, post, to)
+	if err != nil {
+		app.revisionError(w, r, err)
+		return
+	}
+
+	d := PostDiff{
+		PostID:  post.ID,
+		From:    from,
+		To:      to,
+		Title:   diff.Lines(older.Title, newer.Title),
+		Content: diff.Lines(older.Content, newer.Content),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, d); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) restorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	rev, err := app.store.Revisions.GetByVersion(ctx, post.ID, version)
+	if err != nil {
+		app.revisionError(w, r, err)
+		return
+	}
+
+	post.Title = rev.Title
+	post.Content = rev.Content
+
+	if err := app.store.Posts.Update(ctx, post, user.ID); err != nil {
+		app.revisionError(w, r, err)
+		return
+	}
+
+	if err := app.loadPostAttachments(ctx, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getPostVersion returns the stored revision for version, or the post itself
+// when version is the current one.
+func (app *application) getPostVersion(ctx context.Context, post *store.Post, version int) (*store.PostRevision, error) {
+	if version == post.Version {
+		return &store.PostRevision{
+			PostID:  post.ID,
+			Version: post.Version,
+			Title:   post.Title,
+			Content: post.Content,
+		}, nil
+	}
+
+	return app.store.Revisions.GetByVersion(ctx, post.ID, version)
+}
+
+func (app *application) revisionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFoundError(w, r, err)
+	case errors.Is(err, store.ErrConflict):
+		app.conflictError(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
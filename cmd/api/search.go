@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/supremed3v/social-media/internal/hashtag"
+	"github.com/supremed3v/social-media/internal/search"
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+// maxUserSearchLength bounds the names users are searched by.
+const maxUserSearchLength = 100
+
+// Autocomplete takes up to maxAutocompleteLength characters and returns
+// defaultSuggestions of each kind unless ?limit asks for up to
+// maxSuggestions.
+const (
+	maxAutocompleteLength = 50
+	defaultSuggestions    = 8
+	maxSuggestions        = 20
+)
+
+// parseSearchQuery reads a full-text search from ?q and the filters of the
+// feeds, plus ?author_id and ?order (relevance or recent). Results are
+// paged by offset.
+func parseSearchQuery(r *http.Request) (store.SearchQuery, error) {
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		return store.SearchQuery{}, err
+	}
+
+	if fq.Cursor != nil {
+		return store.SearchQuery{}, errors.New("search is paged by offset, not cursor")
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		return store.SearchQuery{}, err
+	}
+
+	qs := r.URL.Query()
+	sq := store.SearchQuery{PaginatedFeedQuery: fq}
+
+	sq.Query, err = search.Parse(qs.Get("q"))
+	if err != nil {
+		return sq, err
+	}
+
+	if v := qs.Get("author_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return sq, fmt.Errorf("invalid author_id: %q is not a user id", v)
+		}
+		sq.AuthorID = &id
+	}
+
+	switch order := qs.Get("order"); order {
+	case "", "relevance":
+	case "recent":
+		sq.Recent = true
+	default:
+		return sq, fmt.Errorf("invalid order: %q is neither relevance nor recent", order)
+	}
+
+	return sq, nil
+}
+
+// searchPostsHandler searches the posts the current user can see. Each
+// result has HTML snippets of its title and content with the matches
+// highlighted.
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+	sq, err := parseSearchQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	results, err := app.store.Search.Posts(ctx, user.ID, sq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	feed := make([]store.PostWithMetadata, len(results))
+	for i := range results {
+		feed[i] = results[i].PostWithMetadata
+	}
+
+	if err := app.loadFeedAttachments(ctx, feed); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	for i := range results {
+		results[i].PostWithMetadata = feed[i]
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// searchCommentsHandler searches the comments on posts the current user
+// can see.
+func (app *application) searchCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	sq, err := parseSearchQuery(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	results, err := app.store.Search.Comments(ctx, user.ID, sq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	comments := make([]store.Comment, len(results))
+	for i := range results {
+		comments[i] = results[i].Comment
+	}
+
+	if err := app.loadCommentMentions(ctx, comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	for i := range results {
+		results[i].Comment = comments[i]
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// searchUsersHandler finds users by a username or display name similar to
+// ?q, which may start with an @.
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@")
+	if name == "" {
+		app.badRequestError(w, r, errors.New("q is required"))
+		return
+	}
+	if utf8.RuneCountInString(name) > maxUserSearchLength {
+		app.badRequestError(w, r, fmt.Errorf("q must be at most %d characters", maxUserSearchLength))
+		return
+	}
+
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	users, err := app.store.Search.Users(r.Context(), user.ID, name, fq.Limit, fq.Offset)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// autocompleteHandler suggests completions for what the user is typing:
+// usernames after an @, tags after a #, and both for text with neither.
+func (app *application) autocompleteHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	q := strings.TrimSpace(qs.Get("q"))
+	users, tags := true, true
+	switch {
+	case strings.HasPrefix(q, "@"):
+		q, tags = q[1:], false
+	case strings.HasPrefix(q, "#"):
+		q, users = q[1:], false
+	}
+
+	if q == "" {
+		app.badRequestError(w, r, errors.New("q needs at least one character after any @ or #"))
+		return
+	}
+	if utf8.RuneCountInString(q) > maxAutocompleteLength {
+		app.badRequestError(w, r, fmt.Errorf("q must be at most %d characters", maxAutocompleteLength))
+		return
+	}
+
+	limit := defaultSuggestions
+	if v := qs.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > maxSuggestions {
+			app.badRequestError(w, r, fmt.Errorf("limit must be between 1 and %d", maxSuggestions))
+			return
+		}
+		limit = l
+	}
+
+	user := getUserFromContext(r)
+
+	sg, err := app.getSuggestions(r.Context(), user.ID, q, users, tags, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, sg); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getSuggestions looks suggestions up in the cache when Redis is enabled,
+// falling back to the database when it can't be read.
+func (app *application) getSuggestions(ctx context.Context, userID int64, prefix string, users, tags bool, limit int) (*store.Suggestions, error) {
+	// the key covers which kinds were asked for
+	key := strings.ToLower(prefix)
+	switch {
+	case !tags:
+		key = "@" + key
+	case !users:
+		key = "#" + key
+	}
+
+	if app.config.redisCfg.enabled {
+		sg, err := app.cacheStorage.Autocomplete.Get(ctx, userID, key, limit)
+		if err != nil {
+			app.logger.Warnw("failed to read cached suggestions", "user_id", userID, "error", err.Error())
+		} else if sg != nil {
+			return sg, nil
+		}
+	}
+
+	sg := &store.Suggestions{
+		Users: []store.UserSuggestion{},
+		Tags:  []store.TagSuggestion{},
+	}
+
+	if users {
+		var err error
+		sg.Users, err = app.store.Search.SuggestUsers(ctx, userID, prefix, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// text that can't start a tag gets no tag suggestions
+	if name, ok := hashtag.NormalizePrefix(prefix); tags && ok {
+		var err error
+		sg.Tags, err = app.store.Search.SuggestTags(ctx, userID, name, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if app.config.redisCfg.enabled {
+		if err := app.cacheStorage.Autocomplete.Set(ctx, userID, key, limit, sg); err != nil {
+			app.logger.Warnw("failed to cache suggestions", "user_id", userID, "error", err.Error())
+		}
+	}
+
+	return sg, nil
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/stream"
+	"golang.org/x/net/websocket"
+)
+
+// streamPathPrefix is where the long-lived streaming endpoints live.
+const streamPathPrefix = "/v1/stream"
+
+// timeoutMiddleware is middleware.Timeout for every request except those
+// exempt reports, which handle their own deadlines.
+func timeoutMiddleware(timeout time.Duration, exempt func(*http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withTimeout := middleware.Timeout(timeout)(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			withTimeout.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isLongRunning reports whether the request may outlast the server's
+// timeouts: streams stay open for as long as the client listens, and
+// uploads get UploadDeadlineMiddleware's deadline instead.
+func isLongRunning(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, streamPathPrefix) {
+		return true
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPost:
+		return path == uploadsPath
+	case http.MethodPatch:
+		return strings.HasPrefix(path, uploadSessionsPath+"/")
+	default:
+		return false
+	}
+}
+
+// streamTokenMiddleware lets the bearer token of a stream request be passed
+// as ?access_token, since browsers can't set headers on EventSource and
+// WebSocket requests. The token is moved into the Authorization header and
+// taken out of the URL, so it doesn't end up in the request log. It goes
+// before middleware.Logger, which records the request line as it arrives.
+func streamTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, streamPathPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		qs := r.URL.Query()
+		if !qs.Has("access_token") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := qs.Get("access_token")
+		qs.Del("access_token")
+
+		r = r.Clone(r.Context())
+		if token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.URL.RawQuery = qs.Encode()
+		r.RequestURI = r.URL.RequestURI()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// subscribe opens a subscription to the user's events and the posts of
+// the large accounts they follow, which aren't addressed to each follower.
+// Accounts followed later are picked up when the user reconnects.
+func (app *application) subscribe(ctx context.Context, userID int64) (*stream.Subscription, error) {
+	authors, err := app.store.Timelines.GetLargeAccountsFollowed(ctx, userID, app.config.timelines.fanoutMaxFollowers)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make([]string, len(authors))
+	for i, id := range authors {
+		topics[i] = stream.AuthorTopic(id)
+	}
+
+	return app.broker.Subscribe(ctx, userID, topics...)
+}
+
+// streamEventsHandler streams the current user's events as Server-Sent
+// Events. Comments are sent as a heartbeat so proxies keep the connection
+// open.
+func (app *application) streamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := app.config.stream
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	sub, err := app.subscribe(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	// the server's read timeout would cut the stream off, and with it the
+	// request context
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(format string, args ...any) error {
+		// each write gets its own deadline in place of the server's
+		if err := rc.SetWriteDeadline(time.Now().Add(cfg.writeTimeout)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if err := send("retry: %d\n\n", cfg.retry.Milliseconds()); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(cfg.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if err := send(": ping\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if err := send("event: %s\ndata: %s\n\n", e.Type, e.Data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamWebSocketHandler streams the current user's events over a
+// WebSocket as JSON messages of the form {"type": ..., "data": ...}, with
+// {"type": "ping"} as the heartbeat. Messages from the client are ignored.
+func (app *application) streamWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	server := websocket.Server{
+		// connections are authenticated by token rather than cookies, so
+		// other origins can't ride on the user's session
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			app.serveWebSocket(r.Context(), ws, user)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func (app *application) serveWebSocket(ctx context.Context, ws *websocket.Conn, user *store.User) {
+	cfg := app.config.stream
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sub, err := app.subscribe(ctx, user.ID)
+	if err != nil {
+		app.logger.Errorw("failed to subscribe to stream", "user_id", user.ID, "error", err.Error())
+		return
+	}
+	defer sub.Close()
+
+	// reading is what notices the client going away
+	if err := ws.SetReadDeadline(time.Time{}); err != nil {
+		return
+	}
+	go func() {
+		defer cancel()
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	send := func(e stream.Event) error {
+		if err := ws.SetWriteDeadline(time.Now().Add(cfg.writeTimeout)); err != nil {
+			return err
+		}
+		return websocket.JSON.Send(ws, e)
+	}
+
+	heartbeat := time.NewTicker(cfg.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if err := send(stream.Event{Type: "ping"}); err != nil {
+				return
+			}
+		case e, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if err := send(e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// announcePost streams a newly published post to the recipients it was
+// fanned out to, other than its author, and tells the users it mentions.
+// Posts of large accounts that all their followers can see go out on the
+// author's topic instead of to each follower.
+func (app *application) announcePost(ctx context.Context, job *store.FanoutJob, recipients []int64) error {
+	post, err := app.store.Posts.GetByID(ctx, job.PostID)
+	if err != nil {
+		return err
+	}
+
+	if err := app.loadPostAttachments(ctx, post); err != nil {
+		return err
+	}
+
+	e, err := stream.NewEvent(stream.EventPost, post)
+	if err != nil {
+		return err
+	}
+
+	followers := make([]int64, 0, len(recipients))
+	for _, id := range recipients {
+		if id != post.UserID {
+			followers = append(followers, id)
+		}
+	}
+
+	if err := app.broker.Publish(ctx, e, followers...); err != nil {
+		return err
+	}
+
+	if job.LargeAccount(app.config.timelines.fanoutMaxFollowers) && post.Visibility != store.VisibilityMentioned {
+		if err := app.broker.PublishTopic(ctx, e, stream.AuthorTopic(post.UserID)); err != nil {
+			return err
+		}
+	}
+
+	mentioned, err := app.mentionedViewers(ctx, post, post.Mentions, post.UserID)
+	if err != nil || len(mentioned) == 0 {
+		return err
+	}
+
+	e, err = stream.NewEvent(stream.EventMention, post)
+	if err != nil {
+		return err
+	}
+
+	if err := app.broker.Publish(ctx, e, mentioned...); err != nil {
+		return err
+	}
+
+	for _, id := range mentioned {
+		app.notify(ctx, store.NotificationEvent{
+			Type:    store.NotificationMention,
+			UserID:  id,
+			ActorID: post.UserID,
+			PostID:  &post.ID,
+		})
+	}
+
+	return nil
+}
+
+// announceComment streams a new comment to the author of the post and the
+// users it mentions, and notifies them. Failures are only logged.
+func (app *application) announceComment(ctx context.Context, post *store.Post, comment *store.Comment) {
+	send := func(typ string, userIDs ...int64) {
+		e, err := stream.NewEvent(typ, comment)
+		if err == nil {
+			err = app.broker.Publish(ctx, e, userIDs...)
+		}
+		if err != nil {
+			app.logger.Warnw("failed to stream comment", "comment_id", comment.ID, "error", err.Error())
+		}
+	}
+
+	if post.UserID != comment.UserID {
+		send(stream.EventComment, post.UserID)
+		app.notify(ctx, store.NotificationEvent{
+			Type:      store.NotificationComment,
+			UserID:    post.UserID,
+			ActorID:   comment.UserID,
+			PostID:    &post.ID,
+			CommentID: &comment.ID,
+		})
+	}
+
+	// the post author already heard about the comment
+	mentioned, err := app.mentionedViewers(ctx, post, comment.Mentions, comment.UserID, post.UserID)
+	if err != nil {
+		app.logger.Warnw("failed to stream comment", "comment_id", comment.ID, "error", err.Error())
+		return
+	}
+	if len(mentioned) == 0 {
+		return
+	}
+
+	send(stream.EventMention, mentioned...)
+	for _, id := range mentioned {
+		app.notify(ctx, store.NotificationEvent{
+			Type:      store.NotificationMention,
+			UserID:    id,
+			ActorID:   comment.UserID,
+			PostID:    &post.ID,
+			CommentID: &comment.ID,
+		})
+	}
+}
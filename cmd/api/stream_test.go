@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/stream"
+	"go.uber.org/zap"
+)
+
+func TestStreamTokenMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		header     string
+		wantAuth   string
+		wantTarget string
+	}{
+		{
+			name:       "token moved to header",
+			target:     "/v1/stream/?access_token=secret&x=1",
+			wantAuth:   "Bearer secret",
+			wantTarget: "/v1/stream/?x=1",
+		},
+		{
+			name:       "header takes precedence",
+			target:     "/v1/stream/ws?access_token=secret",
+			header:     "Bearer other",
+			wantAuth:   "Bearer other",
+			wantTarget: "/v1/stream/ws",
+		},
+		{
+			name:       "empty token dropped",
+			target:     "/v1/stream/?access_token=",
+			wantTarget: "/v1/stream/",
+		},
+		{
+			name:       "other paths left alone",
+			target:     "/v1/posts?access_token=secret",
+			wantTarget: "/v1/posts?access_token=secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged bytes.Buffer
+			logger := middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.New(&logged, "", 0), NoColor: true})
+
+			var gotAuth, gotTarget string
+			h := streamTokenMiddleware(logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth = r.Header.Get("Authorization")
+				gotTarget = r.RequestURI
+			})))
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if gotAuth != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", gotAuth, tt.wantAuth)
+			}
+			if gotTarget != tt.wantTarget {
+				t.Errorf("RequestURI = %q, want %q", gotTarget, tt.wantTarget)
+			}
+			if strings.HasPrefix(tt.target, streamPathPrefix) && strings.Contains(logged.String(), "secret") {
+				t.Errorf("token logged: %s", logged.String())
+			}
+		})
+	}
+}
+
+// followedTimelines is a timeline store that only knows which large
+// accounts the user follows.
+type followedTimelines struct {
+	authors []int64
+}
+
+func (s followedTimelines) GetEntries(context.Context, int64, int, int) ([]store.TimelineEntry, error) {
+	return nil, nil
+}
+
+func (s followedTimelines) GetLargeAccountEntries(context.Context, int64, int, *time.Time, store.PaginatedFeedQuery) ([]store.TimelineEntry, error) {
+	return nil, nil
+}
+
+func (s followedTimelines) GetLargeAccountsFollowed(context.Context, int64, int) ([]int64, error) {
+	return s.authors, nil
+}
+
+func (s followedTimelines) ClaimFanout(context.Context, time.Duration, int) (*store.FanoutJob, error) {
+	return nil, store.ErrNotFound
+}
+
+func (s followedTimelines) Recipients(context.Context, *store.FanoutJob, int) ([]int64, error) {
+	return nil, nil
+}
+
+func (s followedTimelines) FinishFanout(context.Context, *store.FanoutJob) error {
+	return nil
+}
+
+func (s followedTimelines) FailFanout(context.Context, *store.FanoutJob, string, time.Duration) error {
+	return nil
+}
+
+func TestStreamEventsOutlastsReadTimeout(t *testing.T) {
+	const readTimeout = 50 * time.Millisecond
+
+	broker := stream.NewLocalBroker(8)
+	app := &application{
+		config: config{stream: streamConfig{
+			heartbeat:    10 * time.Millisecond,
+			writeTimeout: time.Second,
+			retry:        time.Second,
+			buffer:       8,
+		}},
+		store:  store.Storage{Timelines: followedTimelines{authors: []int64{2}}},
+		logger: zap.NewNop().Sugar(),
+		broker: broker,
+	}
+	user := &store.User{ID: 1}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), userCtx, user)
+		app.streamEventsHandler(w, r.WithContext(ctx))
+	}))
+	srv.Config.ReadTimeout = readTimeout
+	srv.Start()
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		sc := bufio.NewScanner(res.Body)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+
+	// wait for the heartbeats to carry on well past the read timeout
+	deadline := time.After(10 * readTimeout)
+	for waiting := true; waiting; {
+		select {
+		case _, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed before the events were sent")
+			}
+		case <-deadline:
+			waiting = false
+		}
+	}
+
+	// one event addressed to the user, one on the topic of an author they
+	// follow
+	e, err := stream.NewEvent(stream.EventNotification, map[string]int{"id": 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Publish(context.Background(), e, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err = stream.NewEvent(stream.EventPost, map[string]int{"id": 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.PublishTopic(context.Background(), e, stream.AuthorTopic(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{"event: notification": true, "event: post": true}
+	timeout := time.After(time.Second)
+	for len(want) > 0 {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.Fatal("stream closed before the events were sent")
+			}
+			delete(want, line)
+		case <-timeout:
+			t.Fatalf("events not received: %v", want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/syndication"
+)
+
+// syndicationFormats maps the formats users' posts are exported in to how
+// they are written.
+var syndicationFormats = map[string]struct {
+	contentType string
+	write       func(io.Writer, *syndication.Feed) error
+}{
+	"rss":  {syndication.ContentTypeRSS, syndication.RSS},
+	"atom": {syndication.ContentTypeAtom, syndication.Atom},
+	"json": {syndication.ContentTypeJSON, syndication.JSONFeed},
+}
+
+type SetFeedsEnabledPayload struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+// getSyndicationFeedHandler exports a user's public posts for feed readers
+// as RSS, Atom or JSON Feed. It needs no authentication, so only posts
+// anyone can see are included, and nothing for users who haven't turned
+// their feeds on. Readers polling with If-None-Match or If-Modified-Since get a
+// 304 when nothing changed.
+func (app *application) getSyndicationFeedHandler(w http.ResponseWriter, r *http.Request) {
+	format, ok := syndicationFormats[chi.URLParam(r, "format")]
+	if !ok {
+		app.notFoundError(w, r, errors.New("unknown feed format"))
+		return
+	}
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	data, err := app.store.Syndication.GetFeed(r.Context(), userID, app.config.syndication.maxItems)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	feed, err := app.syndicationFeed(r, data)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	var body bytes.Buffer
+	if err := format.write(&body, feed); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(app.config.syndication.maxAge.Seconds())))
+
+	http.ServeContent(w, r, "", feed.Updated, bytes.NewReader(body.Bytes()))
+}
+
+func (app *application) syndicationFeed(r *http.Request, data *store.SyndicatedFeed) (*syndication.Feed, error) {
+	joined, err := time.Parse(time.RFC3339Nano, data.JoinedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &syndication.Feed{
+		Title:       fmt.Sprintf("Posts by %s", data.Username),
+		Description: fmt.Sprintf("The latest public posts by %s", data.Username),
+		HomeURL:     fmt.Sprintf("%s/users/%d", app.config.frontendURL, data.UserID),
+		FeedURL:     app.config.syndication.baseURL + r.URL.RequestURI(),
+		Author:      data.Username,
+		Updated:     joined,
+	}
+
+	for _, p := range data.Posts {
+		published, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := time.Parse(time.RFC3339Nano, p.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if updated.Before(published) {
+			updated = published
+		}
+		if updated.After(feed.Updated) {
+			feed.Updated = updated
+		}
+
+		postURL := fmt.Sprintf("%s/posts/%d", app.config.frontendURL, p.ID)
+		feed.Items = append(feed.Items, syndication.Item{
+			ID:        postURL,
+			URL:       postURL,
+			Title:     p.Title,
+			Content:   p.Content,
+			Tags:      p.Tags,
+			Published: published,
+			Updated:   updated,
+		})
+	}
+
+	return feed, nil
+}
+
+// setFeedsEnabledHandler turns the current user's RSS, Atom and JSON feeds
+// on or off.
+func (app *application) setFeedsEnabledHandler(w http.ResponseWriter, r *http.Request) {
+	var payload SetFeedsEnabledPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Syndication.SetEnabled(r.Context(), user.ID, *payload.Enabled); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/supremed3v/social-media/internal/hashtag"
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+// trendingWindows are the periods trending tags can be computed over.
+var trendingWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// normalizeTags checks the tags given explicitly with a post and returns
+// them in their stored form.
+func normalizeTags(tags []string) ([]string, error) {
+	for _, t := range tags {
+		if _, ok := hashtag.Normalize(t); !ok {
+			return nil, fmt.Errorf("invalid tag %q: tags are up to %d letters, digits and underscores", t, hashtag.MaxLength)
+		}
+	}
+	return hashtag.Merge(tags), nil
+}
+
+func tagFromURL(r *http.Request) (string, error) {
+	tag, ok := hashtag.Normalize(chi.URLParam(r, "tag"))
+	if !ok {
+		return "", errors.New("invalid tag")
+	}
+	return tag, nil
+}
+
+func (app *application) getTagHandler(w http.ResponseWriter, r *http.Request) {
+	name, err := tagFromURL(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	tag, err := app.store.Tags.GetByName(r.Context(), name, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tag); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getTagPostsHandler lists the posts carrying a tag, whether it was given
+// explicitly or used as a hashtag in the content.
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := tagFromURL(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+
+	fq, err = fq.Parse(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	posts, page, err := app.store.Posts.GetByTag(ctx, user.ID, tag, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadFeedAttachments(ctx, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.paginatedResponse(w, r, http.StatusOK, posts, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := tagFromURL(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Tags.Follow(r.Context(), user.ID, tag); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateTimeline(r.Context(), user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, err := tagFromURL(r)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	if err := app.store.Tags.Unfollow(r.Context(), user.ID, tag); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.invalidateTimeline(r.Context(), user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getTrendingTagsHandler ranks tags by how much more they are used in the
+// chosen window (?window=1h, 24h or 7d) than in the one before it.
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	window := trendingWindows["24h"]
+	if v := qs.Get("window"); v != "" {
+		d, ok := trendingWindows[v]
+		if !ok {
+			app.badRequestError(w, r, fmt.Errorf("invalid window %q: use 1h, 24h or 7d", v))
+			return
+		}
+		window = d
+	}
+
+	limit := 10
+	if v := qs.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > 50 {
+			app.badRequestError(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+		limit = l
+	}
+
+	tags, err := app.store.Tags.Trending(r.Context(), window, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/store/cache"
+)
+
+// fanOutPosts pushes newly published posts into the cached timelines of
+// their readers, streams them to those connected and notifies the users
+// they mention, until there are none left. Leases in the database keep the
+// workers from fanning out the same post.
+func (app *application) fanOutPosts(ctx context.Context) error {
+	cfg := app.config.timelines
+
+	for ctx.Err() == nil {
+		job, err := app.store.Timelines.ClaimFanout(ctx, cfg.jobTimeout, cfg.maxAttempts)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := app.fanOut(ctx, job); err != nil {
+			app.logger.Infow("failed to fan out post", "post_id", job.PostID, "error", err.Error())
+
+			if err := app.store.Timelines.FailFanout(ctx, job, err.Error(), cfg.retryDelay); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := app.store.Timelines.FinishFanout(ctx, job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (app *application) fanOut(ctx context.Context, job *store.FanoutJob) error {
+	ctx, cancel := context.WithTimeout(ctx, app.config.timelines.jobTimeout)
+	defer cancel()
+
+	recipients, err := app.store.Timelines.Recipients(ctx, job, app.config.timelines.fanoutMaxFollowers)
+	if err != nil {
+		return err
+	}
+
+	// without Redis every feed is read from the database
+	if app.config.redisCfg.enabled {
+		if err := app.cacheStorage.Timelines.Push(ctx, recipients, job.PostID, job.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	// announcing is best effort and isn't retried, which would repeat events
+	if err := app.announcePost(ctx, job, recipients); err != nil {
+		app.logger.Warnw("failed to announce post", "post_id", job.PostID, "error", err.Error())
+	}
+
+	return nil
+}
+
+// getTimeline returns a page of the user's home feed. The page is picked
+// from the timeline cached in Redis, merged with the posts of the large
+// accounts the user follows, and only those posts are read from the
+// database. The timeline is built from the database if it isn't cached
+// yet. Filtered and backwards pages, pages the cached timeline doesn't
+// reach and problems with Redis fall back to the database query.
+func (app *application) getTimeline(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetadata, store.PageInfo, error) {
+	// the cached timeline only holds the newest posts, unfiltered
+	if !app.config.redisCfg.enabled || !servedFromTimeline(fq) {
+		return app.store.Posts.GetUserFeed(ctx, userID, fq)
+	}
+
+	timeline, err := app.loadTimeline(ctx, userID)
+	if err != nil {
+		app.logger.Warnw("failed to read cached timeline", "user_id", userID, "error", err.Error())
+		return app.store.Posts.GetUserFeed(ctx, userID, fq)
+	}
+
+	var horizon *time.Time
+	if timeline.Truncated {
+		horizon = &timeline.Oldest
+
+		if fq.Cursor != nil && fq.Cursor.CreatedAt.Before(timeline.Oldest) {
+			return app.store.Posts.GetUserFeed(ctx, userID, fq)
+		}
+	}
+
+	large := func(fq store.PaginatedFeedQuery) ([]store.TimelineEntry, error) {
+		return app.store.Timelines.GetLargeAccountEntries(ctx, userID, app.config.timelines.fanoutMaxFollowers, horizon, fq)
+	}
+	hydrate := func(ids []int64) ([]store.PostWithMetadata, error) {
+		return app.store.Posts.GetByIDs(ctx, userID, ids)
+	}
+
+	feed, page, err := timelinePage(timeline, fq, large, hydrate)
+	if errors.Is(err, errPastTimeline) {
+		return app.store.Posts.GetUserFeed(ctx, userID, fq)
+	}
+
+	return feed, page, err
+}
+
+// errPastTimeline is returned by timelinePage when a page runs into the end
+// of a truncated timeline, with older posts possibly beyond it.
+var errPastTimeline = errors.New("page reaches past the cached timeline")
+
+// timelinePage picks the page after fq.Cursor from the cached timeline,
+// merged with the entries large returns for a page of the large accounts
+// the user follows. hydrate reads the posts of the entries, leaving out
+// those deleted or hidden from the user since they were cached; the page
+// is then filled up from the entries after them.
+func timelinePage(
+	timeline *cache.Timeline,
+	fq store.PaginatedFeedQuery,
+	large func(store.PaginatedFeedQuery) ([]store.TimelineEntry, error),
+	hydrate func(ids []int64) ([]store.PostWithMetadata, error),
+) ([]store.PostWithMetadata, store.PageInfo, error) {
+	feed := []store.PostWithMetadata{}
+	// the cursors come from the entries, which are there even when a post
+	// was deleted in the meantime
+	var first, last *store.TimelineEntry
+	more := true
+
+	next := fq
+	for more && len(feed) < fq.Limit {
+		next.Limit = fq.Limit - len(feed)
+
+		largeEntries, err := large(next)
+		if err != nil {
+			return nil, store.PageInfo{}, err
+		}
+
+		entries := mergeTimeline(timeline.Entries, largeEntries, next.Cursor, next.Limit+1)
+		if timeline.Truncated && len(entries) <= next.Limit {
+			return nil, store.PageInfo{}, errPastTimeline
+		}
+
+		more = len(entries) > next.Limit
+		if more {
+			entries = entries[:next.Limit]
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		ids := make([]int64, len(entries))
+		for i, e := range entries {
+			ids[i] = e.PostID
+		}
+
+		posts, err := hydrate(ids)
+		if err != nil {
+			return nil, store.PageInfo{}, err
+		}
+		feed = append(feed, posts...)
+
+		if first == nil {
+			first = &entries[0]
+		}
+		last = &entries[len(entries)-1]
+		next.Cursor = &store.Cursor{CreatedAt: last.CreatedAt, ID: last.PostID}
+	}
+
+	var page store.PageInfo
+	if more && last != nil {
+		page.Next = store.Cursor{CreatedAt: last.CreatedAt, ID: last.PostID}.Encode()
+	}
+	if fq.Cursor != nil && first != nil {
+		page.Prev = store.Cursor{CreatedAt: first.CreatedAt, ID: first.PostID, Prev: true}.Encode()
+	}
+
+	return feed, page, nil
+}
+
+// servedFromTimeline reports whether a page of the home feed can be picked
+// from the cached timeline: the newest first, paged forwards by cursor,
+// with no search or filters.
+func servedFromTimeline(fq store.PaginatedFeedQuery) bool {
+	return fq.Sort == "desc" &&
+		fq.Offset == 0 &&
+		(fq.Cursor == nil || !fq.Cursor.Prev) &&
+		fq.Search == "" &&
+		len(fq.Tags) == 0 &&
+		fq.Since == nil &&
+		fq.Until == nil
+}
+
+// mergeTimeline returns up to limit entries from after the cursor, merging
+// the cached timeline with the posts of large accounts. Both are newest
+// first and the result is too; a post in both is only taken once.
+func mergeTimeline(cached, large []store.TimelineEntry, cursor *store.Cursor, limit int) []store.TimelineEntry {
+	after := func(e store.TimelineEntry) bool {
+		if cursor == nil {
+			return true
+		}
+		if e.CreatedAt.Equal(cursor.CreatedAt) {
+			return e.PostID < cursor.ID
+		}
+		return e.CreatedAt.Before(cursor.CreatedAt)
+	}
+	newer := func(a, b store.TimelineEntry) bool {
+		if a.CreatedAt.Equal(b.CreatedAt) {
+			return a.PostID > b.PostID
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+
+	entries := []store.TimelineEntry{}
+	seen := make(map[int64]bool)
+	i, j := 0, 0
+	for len(entries) < limit && (i < len(cached) || j < len(large)) {
+		var e store.TimelineEntry
+		if j == len(large) || (i < len(cached) && newer(cached[i], large[j])) {
+			e, i = cached[i], i+1
+		} else {
+			e, j = large[j], j+1
+		}
+
+		if !after(e) || seen[e.PostID] {
+			continue
+		}
+		seen[e.PostID] = true
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+// loadTimeline returns the user's cached timeline, building it first if
+// needed.
+func (app *application) loadTimeline(ctx context.Context, userID int64) (*cache.Timeline, error) {
+	timeline, err := app.cacheStorage.Timelines.Get(ctx, userID)
+	if err != nil || timeline != nil {
+		return timeline, err
+	}
+
+	// posts pushed from here on are merged in when the timeline is stored
+	if err := app.cacheStorage.Timelines.StartBuild(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// one more than fits tells whether the timeline holds everything
+	entries, err := app.store.Timelines.GetEntries(ctx, userID, app.config.timelines.fanoutMaxFollowers, cache.TimelineMaxLength+1)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline = &cache.Timeline{Entries: []store.TimelineEntry{}}
+	if len(entries) > cache.TimelineMaxLength {
+		entries = entries[:cache.TimelineMaxLength]
+		timeline.Truncated = true
+	}
+	timeline.Entries = entries
+	if len(entries) > 0 {
+		timeline.Oldest = entries[len(entries)-1].CreatedAt
+	}
+
+	if err := app.cacheStorage.Timelines.Set(ctx, userID, entries, !timeline.Truncated); err != nil {
+		return nil, err
+	}
+
+	return timeline, nil
+}
+
+// invalidateTimeline drops the user's cached timeline after a change to
+// whose posts belong in it.
+func (app *application) invalidateTimeline(ctx context.Context, userID int64) {
+	if app.config.redisCfg.enabled {
+		app.cacheStorage.Timelines.Delete(ctx, userID)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/store/cache"
+)
+
+func TestMergeTimeline(t *testing.T) {
+	at := func(min int) time.Time {
+		return time.Date(2024, 1, 2, 3, min, 0, 0, time.UTC)
+	}
+	entry := func(id int64, min int) store.TimelineEntry {
+		return store.TimelineEntry{PostID: id, CreatedAt: at(min)}
+	}
+	ids := func(entries []store.TimelineEntry) []int64 {
+		out := []int64{}
+		for _, e := range entries {
+			out = append(out, e.PostID)
+		}
+		return out
+	}
+
+	cached := []store.TimelineEntry{entry(9, 50), entry(7, 40), entry(5, 30), entry(3, 20)}
+	large := []store.TimelineEntry{entry(8, 45), entry(6, 40), entry(4, 25)}
+
+	tests := []struct {
+		name   string
+		cached []store.TimelineEntry
+		large  []store.TimelineEntry
+		cursor *store.Cursor
+		limit  int
+		want   []int64
+	}{
+		{name: "empty", limit: 5, want: []int64{}},
+		{name: "cached only", cached: cached, limit: 10, want: []int64{9, 7, 5, 3}},
+		{name: "large only", large: large, limit: 10, want: []int64{8, 6, 4}},
+		{name: "interleaved", cached: cached, large: large, limit: 10, want: []int64{9, 8, 7, 6, 5, 4, 3}},
+		{name: "limited", cached: cached, large: large, limit: 3, want: []int64{9, 8, 7}},
+		{
+			name:   "same time ordered by id",
+			cached: []store.TimelineEntry{entry(2, 10)},
+			large:  []store.TimelineEntry{entry(3, 10), entry(1, 10)},
+			limit:  10,
+			want:   []int64{3, 2, 1},
+		},
+		{
+			name:   "duplicates taken once",
+			cached: []store.TimelineEntry{entry(9, 50), entry(8, 45)},
+			large:  []store.TimelineEntry{entry(8, 45), entry(6, 40)},
+			limit:  10,
+			want:   []int64{9, 8, 6},
+		},
+		{
+			name:   "after cursor",
+			cached: cached,
+			large:  large,
+			cursor: &store.Cursor{CreatedAt: at(40), ID: 7},
+			limit:  10,
+			want:   []int64{6, 5, 4, 3},
+		},
+		{
+			name:   "cursor past the end",
+			cached: cached,
+			large:  large,
+			cursor: &store.Cursor{CreatedAt: at(20), ID: 3},
+			limit:  10,
+			want:   []int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(mergeTimeline(tt.cached, tt.large, tt.cursor, tt.limit))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeTimeline() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimelinePage(t *testing.T) {
+	at := func(min int) time.Time {
+		return time.Date(2024, 1, 2, 3, min, 0, 0, time.UTC)
+	}
+	entry := func(id int64, min int) store.TimelineEntry {
+		return store.TimelineEntry{PostID: id, CreatedAt: at(min)}
+	}
+	cursor := func(id int64, min int) string {
+		return store.Cursor{CreatedAt: at(min), ID: id}.Encode()
+	}
+
+	cached := []store.TimelineEntry{entry(9, 50), entry(7, 40), entry(5, 30), entry(3, 20)}
+	large := []store.TimelineEntry{entry(8, 45), entry(4, 25)}
+
+	tests := []struct {
+		name      string
+		timeline  cache.Timeline
+		large     []store.TimelineEntry
+		cursor    *store.Cursor
+		limit     int
+		hidden    []int64
+		want      []int64
+		next      string
+		prev      string
+		truncated bool
+	}{
+		{
+			name:     "full page",
+			timeline: cache.Timeline{Entries: cached},
+			limit:    2,
+			want:     []int64{9, 7},
+			next:     cursor(7, 40),
+		},
+		{
+			name:     "last page",
+			timeline: cache.Timeline{Entries: cached},
+			limit:    4,
+			want:     []int64{9, 7, 5, 3},
+		},
+		{
+			name:     "short page filled from the next entries",
+			timeline: cache.Timeline{Entries: cached},
+			limit:    2,
+			hidden:   []int64{7},
+			want:     []int64{9, 5},
+			next:     cursor(5, 30),
+		},
+		{
+			name:     "whole page hidden",
+			timeline: cache.Timeline{Entries: cached},
+			limit:    2,
+			hidden:   []int64{9, 7},
+			want:     []int64{5, 3},
+		},
+		{
+			name:     "everything hidden",
+			timeline: cache.Timeline{Entries: cached},
+			limit:    2,
+			hidden:   []int64{9, 7, 5, 3},
+			want:     []int64{},
+		},
+		{
+			name:     "filled with large accounts",
+			timeline: cache.Timeline{Entries: cached},
+			large:    large,
+			limit:    3,
+			hidden:   []int64{8, 7},
+			want:     []int64{9, 5, 4},
+			next:     cursor(4, 25),
+		},
+		{
+			name:     "after a cursor",
+			timeline: cache.Timeline{Entries: cached},
+			large:    large,
+			cursor:   &store.Cursor{CreatedAt: at(45), ID: 8},
+			limit:    2,
+			hidden:   []int64{5},
+			want:     []int64{7, 4},
+			next:     cursor(4, 25),
+			prev:     store.Cursor{CreatedAt: at(40), ID: 7, Prev: true}.Encode(),
+		},
+		{
+			name:     "within a truncated timeline",
+			timeline: cache.Timeline{Entries: cached, Oldest: at(20), Truncated: true},
+			limit:    2,
+			hidden:   []int64{7},
+			want:     []int64{9, 5},
+			next:     cursor(5, 30),
+		},
+		{
+			name:      "filling runs past a truncated timeline",
+			timeline:  cache.Timeline{Entries: cached, Oldest: at(20), Truncated: true},
+			limit:     3,
+			hidden:    []int64{7},
+			truncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			largeFn := func(fq store.PaginatedFeedQuery) ([]store.TimelineEntry, error) {
+				return mergeTimeline(nil, tt.large, fq.Cursor, fq.Limit+1), nil
+			}
+			hydrate := func(ids []int64) ([]store.PostWithMetadata, error) {
+				feed := []store.PostWithMetadata{}
+				for _, id := range ids {
+					hidden := false
+					for _, h := range tt.hidden {
+						hidden = hidden || h == id
+					}
+					if !hidden {
+						feed = append(feed, store.PostWithMetadata{Post: store.Post{ID: id}})
+					}
+				}
+				return feed, nil
+			}
+
+			fq := store.PaginatedFeedQuery{Limit: tt.limit, Sort: "desc", Cursor: tt.cursor}
+			feed, page, err := timelinePage(&tt.timeline, fq, largeFn, hydrate)
+			if tt.truncated {
+				if !errors.Is(err, errPastTimeline) {
+					t.Fatalf("timelinePage() error = %v, want %v", err, errPastTimeline)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []int64{}
+			for _, p := range feed {
+				got = append(got, p.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("timelinePage() = %v, want %v", got, tt.want)
+			}
+			if page.Next != tt.next {
+				t.Errorf("next = %q, want %q", page.Next, tt.next)
+			}
+			if page.Prev != tt.prev {
+				t.Errorf("prev = %q, want %q", page.Prev, tt.prev)
+			}
+		})
+	}
+}
+
+func TestServedFromTimeline(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		fq   store.PaginatedFeedQuery
+		want bool
+	}{
+		{name: "first page", fq: store.PaginatedFeedQuery{Limit: 20, Sort: "desc"}, want: true},
+		{name: "next page", fq: store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Cursor: &store.Cursor{CreatedAt: now, ID: 1}}, want: true},
+		{name: "previous page", fq: store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Cursor: &store.Cursor{CreatedAt: now, ID: 1, Prev: true}}},
+		{name: "oldest first", fq: store.PaginatedFeedQuery{Limit: 20, Sort: "asc"}},
+		{name: "offset", fq: store.PaginatedFeedQuery{Limit: 20, Offset: 20, Sort: "desc"}},
+		{name: "search", fq: store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Search: "go"}},
+		{name: "tags", fq: store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: []string{"go"}}},
+		{name: "since", fq: store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Since: &now}},
+		{name: "until", fq: store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Until: &now}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := servedFromTimeline(tt.fq); got != tt.want {
+				t.Errorf("servedFromTimeline() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supremed3v/social-media/internal/blob"
+	"github.com/supremed3v/social-media/internal/imaging"
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/transcode"
+	"github.com/supremed3v/social-media/internal/upload"
+)
+
+// Videos and animated GIFs are kept as uploaded and transcoded in the
+// background into an MP4 plus a poster frame. Until that is done their
+// status is "processing" and posts leave them out.
+
+var errVideoDisabled = fmt.Errorf("%w: video uploads are disabled", errUnsupportedUpload)
+
+// sourceExtensions names stored sources after their sniffed type.
+var sourceExtensions = map[string]string{
+	"image/gif":  ".gif",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+	"video/avi":  ".avi",
+}
+
+// storeVideoSource checks a video upload with ffprobe and stores it
+// untouched for the transcoding workers. The returned record is not saved
+// in the database yet.
+func (app *application) storeVideoSource(ctx context.Context, userID int64, up uploadedFile, mediaType string) (*store.Image, error) {
+	if app.transcoder == nil {
+		return nil, errVideoDisabled
+	}
+
+	if up.size > app.config.uploads.maxVideoSize {
+		return nil, fmt.Errorf("%w of %d bytes", upload.ErrTooLarge, app.config.uploads.maxVideoSize)
+	}
+
+	info, err := app.transcoder.Probe(ctx, up.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	if info.Duration > app.config.video.maxDuration {
+		return nil, fmt.Errorf("%w: %s, max %s", errMediaTooLong, info.Duration.Round(time.Second), app.config.video.maxDuration)
+	}
+
+	ext, ok := sourceExtensions[up.contentType]
+	if !ok {
+		ext = ".bin"
+	}
+	key := fmt.Sprintf("media/%d/%s/source%s", userID, uuid.New().String(), ext)
+
+	if _, err := up.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := app.blob.Put(ctx, key, up.file, up.size, up.contentType); err != nil {
+		return nil, fmt.Errorf("failed to upload media: %w", err)
+	}
+
+	return &store.Image{
+		UserID:      userID,
+		SourceKey:   key,
+		MediaType:   mediaType,
+		Status:      store.MediaStatusProcessing,
+		Width:       info.Width,
+		Height:      info.Height,
+		DurationMS:  int(info.Duration.Milliseconds()),
+		Codec:       info.Codec,
+		ContentType: up.contentType,
+	}, nil
+}
+
+// transcodePendingMedia works through the media waiting to be transcoded
+// until there is none left. Several of these run side by side; leases in
+// the database keep them from picking the same item.
+func (app *application) transcodePendingMedia(ctx context.Context) error {
+	for ctx.Err() == nil {
+		// the lease outlasts the job's own timeout so nobody else starts on it
+		lease := app.config.video.jobTimeout + time.Minute
+		img, err := app.store.Images.ClaimProcessing(ctx, lease, app.config.video.maxAttempts)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := app.transcodeMedia(ctx, img); err != nil {
+			app.logger.Errorw("failed to transcode media", "image_id", img.ID, "error", err.Error())
+
+			// an unreadable or lost file won't get better on the next attempt
+			permanent := errors.Is(err, transcode.ErrInvalidMedia) || errors.Is(err, blob.ErrNotFound)
+			if err := app.store.Images.FailProcessing(ctx, img, err.Error(), permanent, app.config.video.retryDelay, app.config.video.maxAttempts); err != nil {
+				return err
+			}
+			continue
+		}
+
+		app.logger.Infow("transcoded media", "image_id", img.ID, "media_type", img.MediaType)
+	}
+
+	return nil
+}
+
+// transcodeMedia turns the stored source into the playable video and its
+// poster, then swaps them in for the source.
+func (app *application) transcodeMedia(ctx context.Context, img *store.Image) error {
+	ctx, cancel := context.WithTimeout(ctx, app.config.video.jobTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "transcode-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "source"+path.Ext(img.SourceKey))
+	if err := app.downloadBlob(ctx, img.SourceKey, src); err != nil {
+		return err
+	}
+
+	video := filepath.Join(dir, "video.mp4")
+	if err := app.transcoder.Transcode(ctx, src, video); err != nil {
+		return err
+	}
+
+	info, err := app.transcoder.Probe(ctx, video)
+	if err != nil {
+		return err
+	}
+
+	// a second in skips the black frames many clips open with
+	poster := filepath.Join(dir, "poster.jpg")
+	if err := app.transcoder.Poster(ctx, video, poster, min(time.Second, info.Duration/2)); err != nil {
+		return err
+	}
+
+	placeholder, err := app.posterPlaceholder(poster)
+	if err != nil {
+		return err
+	}
+
+	prefix := path.Dir(img.SourceKey)
+	outputs := []struct {
+		name, file, key, contentType string
+	}{
+		{"video", video, prefix + "/video.mp4", "video/mp4"},
+		{"poster", poster, prefix + "/poster.jpg", "image/jpeg"},
+	}
+
+	done := &store.Image{ID: img.ID}
+	for _, out := range outputs {
+		size, err := app.putFile(ctx, out.key, out.file, out.contentType)
+		if err != nil {
+			app.deleteImageBlobs(done)
+			return err
+		}
+
+		done.Variants = append(done.Variants, store.ImageVariant{
+			Name:        out.name,
+			StorageKey:  out.key,
+			Width:       info.Width,
+			Height:      info.Height,
+			ContentType: out.contentType,
+			Size:        size,
+		})
+	}
+
+	source := img.SourceKey
+	img.Variants = done.Variants
+	img.StorageKey = done.Variants[0].StorageKey
+	img.Width = info.Width
+	img.Height = info.Height
+	img.DurationMS = int(info.Duration.Milliseconds())
+	img.Codec = info.Codec
+	img.ContentType = "video/mp4"
+	img.BlurHash = placeholder.BlurHash
+	img.DominantColor = placeholder.DominantColor
+
+	if err := app.store.Images.FinishProcessing(ctx, img); err != nil {
+		app.deleteImageBlobs(done)
+		return err
+	}
+
+	if err := app.blob.Delete(ctx, source); err != nil {
+		app.logger.Errorw("failed to delete media source", "key", source, "error", err.Error())
+	}
+
+	return nil
+}
+
+// posterPlaceholder summarises the poster frame, which is what clients
+// show before a video starts playing.
+func (app *application) posterPlaceholder(name string) (imaging.Placeholder, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return imaging.Placeholder{}, err
+	}
+	defer f.Close()
+
+	return imaging.DecodePlaceholder(f)
+}
+
+func (app *application) downloadBlob(ctx context.Context, key, dst string) error {
+	r, err := app.blob.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func (app *application) putFile(ctx context.Context, key, name, contentType string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), app.blob.Put(ctx, key, f, info.Size(), contentType)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+func (app *application) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	trash, err := app.store.Posts.GetTrash(r.Context(), user.ID, app.config.trash.retention)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, trash); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postId"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Posts.Restore(ctx, postID, user.ID, app.config.trash.retention); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	post, err := app.store.Posts.GetByID(ctx, postID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
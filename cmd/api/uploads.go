@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/supremed3v/social-media/internal/imaging"
+	"github.com/supremed3v/social-media/internal/store"
+	"github.com/supremed3v/social-media/internal/transcode"
+	"github.com/supremed3v/social-media/internal/upload"
+)
+
+type ImagePayload struct {
+	Image string `json:"image"`
+}
+
+const maxAltTextLength = 1000
+
+// Files are uploaded to uploadsPath in one request, or in chunks to a
+// session under uploadSessionsPath.
+const (
+	uploadsPath        = "/v1/uploads"
+	uploadSessionsPath = uploadsPath + "/sessions"
+)
+
+var (
+	errUnsupportedUpload = errors.New("unsupported file type")
+	errMediaTooLong      = errors.New("media is too long")
+)
+
+// uploadError reports a failure reading an upload stream. Client mistakes
+// are bad requests; anything else is on us.
+func (app *application) uploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, upload.ErrTooLarge), errors.As(err, &maxBytesErr):
+		app.payloadTooLargeError(w, r, err)
+	case errors.Is(err, upload.ErrNoFile), errors.Is(err, upload.ErrInvalidForm), errors.Is(err, http.ErrNotMultipart),
+		errors.Is(err, io.ErrUnexpectedEOF), isInvalidMedia(err):
+		app.badRequestError(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// isInvalidMedia reports whether err means the uploaded file itself is
+// unusable, as opposed to a failure on our side.
+func isInvalidMedia(err error) bool {
+	return errors.Is(err, errUnsupportedUpload) ||
+		errors.Is(err, errMediaTooLong) ||
+		errors.Is(err, upload.ErrTooLarge) ||
+		errors.Is(err, imaging.ErrUnsupportedFormat) ||
+		errors.Is(err, imaging.ErrTooLarge) ||
+		errors.Is(err, transcode.ErrInvalidMedia)
+}
+
+// maxUploadSize is the most any single upload may weigh; the limit for
+// its kind of media is checked once it has been sniffed.
+func (app *application) maxUploadSize() int64 {
+	return max(app.config.uploads.maxImageSize, app.config.uploads.maxVideoSize)
+}
+
+func (app *application) uploadImageHandler(w http.ResponseWriter, r *http.Request) {
+	var spooled *os.File
+	up := uploadedFile{}
+
+	// Stream the file part to disk, sniffing, hashing and enforcing the size
+	// limit on the way. Images have to be decoded and re-encoded, and videos
+	// probed, before any of it may reach storage, so it can't be piped there
+	// directly.
+	fields, err := upload.ReadMultipart(r, "file", app.maxUploadSize(), func(_ string, file *upload.Reader) error {
+		fileType := file.ContentType()
+		if !strings.HasPrefix(fileType, "image/") && !strings.HasPrefix(fileType, "video/") {
+			return fmt.Errorf("%w: %s", errUnsupportedUpload, fileType)
+		}
+
+		f, err := upload.Spool(file)
+		if err != nil {
+			return err
+		}
+		spooled = f
+		up = uploadedFile{
+			file:        f,
+			contentType: fileType,
+			sha256:      file.SHA256(),
+			size:        file.Size(),
+		}
+		return nil
+	})
+	if spooled != nil {
+		defer upload.Remove(spooled)
+	}
+	if err != nil {
+		app.uploadError(w, r, err)
+		return
+	}
+
+	up.altText = fields.Get("alt_text")
+	if len(up.altText) > maxAltTextLength {
+		app.badRequestError(w, r, fmt.Errorf("alt_text exceeds %d characters", maxAltTextLength))
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	img, created, err := app.saveUpload(r.Context(), user.ID, up)
+	if err != nil {
+		app.uploadError(w, r, err)
+		return
+	}
+
+	// Uploading the same file again hands back the media already stored
+	status := http.StatusOK
+	switch {
+	case created && img.Status == store.MediaStatusProcessing:
+		status = http.StatusAccepted
+	case created:
+		status = http.StatusCreated
+	}
+
+	app.respondWithImage(w, r, status, img)
+}
+
+// getMediaHandler lets uploaders follow the processing of their media.
+func (app *application) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "mediaID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	img, err := app.store.Images.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user := getUserFromContext(r)
+	if img.UserID != user.ID {
+		app.notFoundError(w, r, store.ErrNotFound)
+		return
+	}
+
+	app.respondWithImage(w, r, http.StatusOK, img)
+}
+
+// uploadedFile is a complete upload spooled to disk, sniffed and hashed.
+type uploadedFile struct {
+	file        *os.File
+	contentType string
+	sha256      string
+	size        int64
+	altText     string
+}
+
+// saveUpload turns an upload into a media record. A file the user already
+// uploaded gives back the existing record, with created false. Images are
+// processed right away; videos and animated GIFs are stored as they came
+// and left for the transcoding workers.
+func (app *application) saveUpload(ctx context.Context, userID int64, up uploadedFile) (*store.Image, bool, error) {
+	existing, err := app.findDuplicateImage(ctx, userID, up.sha256)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return existing, false, nil
+	}
+
+	mediaType, err := detectMediaType(up)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var img *store.Image
+	switch mediaType {
+	case store.MediaTypeImage:
+		if up.size > app.config.uploads.maxImageSize {
+			return nil, false, fmt.Errorf("%w of %d bytes", upload.ErrTooLarge, app.config.uploads.maxImageSize)
+		}
+		img, err = app.processImage(ctx, userID, up.file)
+	default:
+		img, err = app.storeVideoSource(ctx, userID, up, mediaType)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	img.AltText = up.altText
+	img.SHA256 = up.sha256
+	img.Size = up.size
+
+	// Save the media in the database so it can be attached to posts
+	if err := app.store.Images.Create(ctx, img); err != nil {
+		app.deleteImageBlobs(img)
+
+		// a concurrent upload of the same file got there first
+		if errors.Is(err, store.ErrDuplicateImage) {
+			if existing, err := app.findDuplicateImage(ctx, userID, up.sha256); err == nil && existing != nil {
+				return existing, false, nil
+			}
+		}
+
+		return nil, false, fmt.Errorf("failed to save image in the database: %w", err)
+	}
+
+	return img, true, nil
+}
+
+// detectMediaType tells still images from videos. GIFs with more than one
+// frame count as animations and get transcoded like videos.
+func detectMediaType(up uploadedFile) (string, error) {
+	switch {
+	case up.contentType == "image/gif":
+		animated, err := imaging.IsAnimatedGIF(up.file)
+		if err != nil {
+			return "", err
+		}
+		if _, err := up.file.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		if animated {
+			return store.MediaTypeAnimation, nil
+		}
+		return store.MediaTypeImage, nil
+	case strings.HasPrefix(up.contentType, "image/"):
+		return store.MediaTypeImage, nil
+	case strings.HasPrefix(up.contentType, "video/"):
+		return store.MediaTypeVideo, nil
+	default:
+		return "", fmt.Errorf("%w: %s", errUnsupportedUpload, up.contentType)
+	}
+}
+
+// findDuplicateImage returns the user's image with the given content hash,
+// or nil when they haven't uploaded it before.
+func (app *application) findDuplicateImage(ctx context.Context, userID int64, hash string) (*store.Image, error) {
+	img, err := app.store.Images.GetByHash(ctx, userID, hash)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	return img, err
+}
+
+func (app *application) respondWithImage(w http.ResponseWriter, r *http.Request, status int, img *store.Image) {
+	images := []store.Image{*img}
+	app.resolveImageURLs(images)
+
+	if err := app.jsonResponse(w, status, images[0]); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// processImage decodes an upload and re-encodes it in every size, which
+// also strips EXIF and GPS metadata, then writes the variants to blob
+// storage. The returned image is not saved in the database yet.
+func (app *application) processImage(ctx context.Context, userID int64, r io.ReadSeeker) (*store.Image, error) {
+	variants, placeholder, err := imaging.Process(r, app.config.images.limits, imaging.DefaultSizes)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := app.storeImageVariants(ctx, userID, variants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload image: %w", err)
+	}
+	img.BlurHash = placeholder.BlurHash
+	img.DominantColor = placeholder.DominantColor
+
+	return img, nil
+}
+
+// storeImageVariants writes each variant to blob storage under a fresh key,
+// so names from the client never reach the storage backend. The returned
+// image describes the "original" variant.
+func (app *application) storeImageVariants(ctx context.Context, userID int64, variants []imaging.Variant) (*store.Image, error) {
+	img := &store.Image{UserID: userID}
+	prefix := fmt.Sprintf("images/%d/%s", userID, uuid.New().String())
+
+	for _, v := range variants {
+		key := prefix + "/" + v.Name + v.Extension()
+		if err := app.blob.Put(ctx, key, bytes.NewReader(v.Data), int64(len(v.Data)), v.ContentType); err != nil {
+			app.deleteImageBlobs(img)
+			return nil, err
+		}
+
+		img.Variants = append(img.Variants, store.ImageVariant{
+			Name:        v.Name,
+			StorageKey:  key,
+			Width:       v.Width,
+			Height:      v.Height,
+			ContentType: v.ContentType,
+			Size:        int64(len(v.Data)),
+		})
+
+		if v.Name == "original" {
+			img.StorageKey = key
+			img.Width = v.Width
+			img.Height = v.Height
+			img.ContentType = v.ContentType
+		}
+	}
+
+	return img, nil
+}
+
+// deleteImageBlobs removes an image's files after a failed upload. It runs
+// detached from the request, which may already be cancelled.
+func (app *application) deleteImageBlobs(img *store.Image) {
+	ctx := context.Background()
+
+	keys := []string{}
+	for _, v := range img.Variants {
+		keys = append(keys, v.StorageKey)
+	}
+	if img.SourceKey != "" {
+		keys = append(keys, img.SourceKey)
+	}
+
+	for _, key := range keys {
+		if err := app.blob.Delete(ctx, key); err != nil {
+			app.logger.Errorw("failed to delete image blob", "key", key, "error", err.Error())
+		}
+	}
+}
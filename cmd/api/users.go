@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/supremed3v/social-media/internal/store"
@@ -47,6 +50,11 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := app.loadAvatar(r.Context(), user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -56,61 +64,112 @@ type FollowUser struct {
 	UserID int64 `json:"user_id"`
 }
 
+// followUserHandler makes the current user follow the user in the URL.
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
-	followerUser := getUserFromContext(r)
+	user := getUserFromContext(r)
 	followedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		app.badRequestError(w, r, err)
 		return
-
-	}
-
-	if err := readJSON(w, r, &followerUser.ID); err != nil {
-		app.badRequestError(w, r, err)
-		return
 	}
 
 	ctx := r.Context()
 
-	if err := app.store.Followers.Follow(ctx, followerUser.ID, followedID); err != nil {
+	if err := app.store.Followers.Follow(ctx, user.ID, followedID); err != nil {
 		switch err {
 		case store.ErrConflict:
 			app.conflictError(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
-			return
 		}
+		return
 	}
 
+	app.invalidateTimeline(ctx, user.ID)
+	app.notify(ctx, store.NotificationEvent{
+		Type:    store.NotificationFollow,
+		UserID:  followedID,
+		ActorID: user.ID,
+	})
+
 	if err := app.jsonResponse(w, http.StatusOK, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
-func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
-	unfollowedUser := getUserFromContext(r)
 
+// unfollowUserHandler makes the current user stop following the user in
+// the URL.
+func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
 	followedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 	if err != nil {
 		app.badRequestError(w, r, err)
 		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Followers.UnFollow(ctx, user.ID, followedID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
+	app.invalidateTimeline(ctx, user.ID)
+	app.retractNotification(ctx, store.NotificationEvent{
+		Type:    store.NotificationFollow,
+		UserID:  followedID,
+		ActorID: user.ID,
+	})
+
+	if err := app.jsonResponse(w, http.StatusOK, nil); err != nil {
+		app.internalServerError(w, r, err)
 	}
+}
 
-	if err := readJSON(w, r, &unfollowedUser); err != nil {
+// blockUserHandler blocks a user. Their existing and future mentions of the
+// current user are dropped.
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
 		app.badRequestError(w, r, err)
 		return
 	}
 
-	ctx := r.Context()
+	if blockedID == user.ID {
+		app.badRequestError(w, r, errors.New("you can't block yourself"))
+		return
+	}
 
-	if err := app.store.Followers.UnFollow(ctx, unfollowedUser.ID, followedID); err != nil {
-		app.internalServerError(w, r, err)
+	if err := app.store.Blocks.Block(r.Context(), user.ID, blockedID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, nil); err != nil {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	blockedID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Blocks.Unblock(r.Context(), user.ID, blockedID); err != nil {
 		app.internalServerError(w, r, err)
+		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -132,6 +191,117 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 }
 
+type DisplayNamePayload struct {
+	DisplayName string `json:"display_name" validate:"max=100"`
+}
+
+// setDisplayNameHandler sets the name shown next to the current user's
+// username. An empty name removes it.
+func (app *application) setDisplayNameHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DisplayNamePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	payload.DisplayName = strings.TrimSpace(payload.DisplayName)
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if err := app.store.Users.SetDisplayName(ctx, user, payload.DisplayName); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if app.config.redisCfg.enabled {
+		app.cacheStorage.Users.Delete(ctx, user.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type AvatarPayload struct {
+	ImageID int64 `json:"image_id" validate:"required"`
+}
+
+// setAvatarHandler makes one of the user's uploaded images their avatar.
+func (app *application) setAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	var payload AvatarPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	app.updateAvatar(w, r, &payload.ImageID)
+}
+
+func (app *application) deleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	app.updateAvatar(w, r, nil)
+}
+
+func (app *application) updateAvatar(w http.ResponseWriter, r *http.Request, imageID *int64) {
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	if err := app.store.Users.SetAvatar(ctx, user, imageID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrImageNotOwned):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if app.config.redisCfg.enabled {
+		app.cacheStorage.Users.Delete(ctx, user.ID)
+	}
+
+	if err := app.loadAvatar(ctx, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// loadAvatar fills in the user's avatar image, if they have one.
+func (app *application) loadAvatar(ctx context.Context, user *store.User) error {
+	user.Avatar = nil
+	if user.AvatarID == nil {
+		return nil
+	}
+
+	img, err := app.store.Images.GetByID(ctx, *user.AvatarID)
+	if err != nil {
+		// the image was collected after the user was cached
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	images := []store.Image{*img}
+	app.resolveImageURLs(images)
+	user.Avatar = &images[0]
+
+	return nil
+}
+
 func getUserFromContext(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtx).(*store.User)
 
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS post_revisions(
+    id bigserial PRIMARY KEY,
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    edited_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    createdAt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (post_id, version)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE comments DROP CONSTRAINT IF EXISTS fk_comments_post;
+
+DROP INDEX IF EXISTS idx_posts_deleted_at;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE posts DROP COLUMN IF EXISTS deleted_at;
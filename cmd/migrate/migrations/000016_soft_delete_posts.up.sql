@@ -0,0 +1,23 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_by bigint REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Comments were never tied to their post, so hard deletes left them behind.
+DELETE FROM comments c WHERE NOT EXISTS (
+    SELECT 1 FROM posts p WHERE p.id = c.post_id
+);
+
+DO $$ 
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1
+        FROM information_schema.table_constraints
+        WHERE constraint_type = 'FOREIGN KEY'
+        AND table_name = 'comments'
+        AND constraint_name = 'fk_comments_post'
+    ) THEN
+        ALTER TABLE comments
+        ADD CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE;
+    END IF;
+END $$;
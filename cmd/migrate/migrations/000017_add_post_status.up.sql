@@ -0,0 +1,5 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published'
+    CHECK (status IN ('draft', 'scheduled', 'published'));
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled ON posts (publish_at) WHERE status = 'scheduled';
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS post_images;
+
+DROP INDEX IF EXISTS idx_images_user_id;
+
+ALTER TABLE images DROP COLUMN IF EXISTS alt_text;
+ALTER TABLE images DROP COLUMN IF EXISTS content_type;
+ALTER TABLE images DROP COLUMN IF EXISTS height;
+ALTER TABLE images DROP COLUMN IF EXISTS width;
+ALTER TABLE images DROP COLUMN IF EXISTS user_id;
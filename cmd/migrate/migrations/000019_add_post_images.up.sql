@@ -0,0 +1,17 @@
+ALTER TABLE images ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS width INT NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS height INT NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS content_type VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS alt_text text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_images_user_id ON images (user_id);
+
+CREATE TABLE IF NOT EXISTS post_images(
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    image_id bigint NOT NULL REFERENCES images(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    PRIMARY KEY (post_id, image_id),
+    UNIQUE (post_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_images_image_id ON post_images (image_id);
@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN IF NOT EXISTS storage_key text NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS image_variants(
+    image_id bigint NOT NULL REFERENCES images(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    storage_key text NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes bigint NOT NULL,
+    PRIMARY KEY (image_id, name)
+);
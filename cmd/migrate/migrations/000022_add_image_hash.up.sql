@@ -0,0 +1,2 @@
+ALTER TABLE images ADD COLUMN IF NOT EXISTS sha256 VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS size_bytes bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS upload_sessions(
+    id uuid PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    length bigint NOT NULL CHECK (length > 0),
+    upload_offset bigint NOT NULL DEFAULT 0,
+    filename text NOT NULL DEFAULT '',
+    alt_text text NOT NULL DEFAULT '',
+    image_id bigint REFERENCES images(id) ON DELETE SET NULL,
+    expires_at timestamp(0) with time zone NOT NULL,
+    createdAt timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CHECK (upload_offset BETWEEN 0 AND length)
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_user_id ON upload_sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions (expires_at);
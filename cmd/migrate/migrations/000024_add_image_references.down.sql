@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS blob_deletions;
+
+DROP TRIGGER IF EXISTS user_avatar_ref_count ON users;
+DROP TRIGGER IF EXISTS post_images_ref_count ON post_images;
+DROP FUNCTION IF EXISTS user_avatar_ref_count();
+DROP FUNCTION IF EXISTS post_images_ref_count();
+DROP FUNCTION IF EXISTS count_image_refs(bigint, INT);
+
+DROP INDEX IF EXISTS idx_images_user_id_sha256;
+DROP INDEX IF EXISTS idx_images_unreferenced;
+ALTER TABLE images DROP COLUMN IF EXISTS last_used_at;
+ALTER TABLE images DROP COLUMN IF EXISTS ref_count;
+
+ALTER TABLE images DROP CONSTRAINT IF EXISTS images_user_id_fkey;
+ALTER TABLE images ADD CONSTRAINT images_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_image_id;
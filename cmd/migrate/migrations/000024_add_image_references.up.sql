@@ -0,0 +1,73 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_image_id bigint REFERENCES images(id) ON DELETE SET NULL;
+
+-- images outlive their uploader so the garbage collector can remove their
+-- files from storage, instead of the rows vanishing with the user
+ALTER TABLE images DROP CONSTRAINT IF EXISTS images_user_id_fkey;
+ALTER TABLE images ADD CONSTRAINT images_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- ref_count is the number of posts and avatars using the image. last_used_at
+-- restarts the grace period before an unreferenced image is collected.
+ALTER TABLE images ADD COLUMN IF NOT EXISTS ref_count INT NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS last_used_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+UPDATE images i SET ref_count = (SELECT count(*) FROM post_images pi WHERE pi.image_id = i.id);
+
+CREATE INDEX IF NOT EXISTS idx_images_unreferenced ON images (last_used_at) WHERE ref_count = 0;
+
+-- keep only the oldest copy of an image per owner addressable by its hash,
+-- later copies get collected once nothing uses them
+UPDATE images SET sha256 = ''
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, row_number() OVER (PARTITION BY user_id, sha256 ORDER BY id) AS n
+        FROM images
+        WHERE sha256 <> ''
+    ) copies
+    WHERE n > 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_images_user_id_sha256 ON images (user_id, sha256) WHERE sha256 <> '';
+
+CREATE OR REPLACE FUNCTION count_image_refs(target bigint, delta INT) RETURNS void AS $$
+BEGIN
+    UPDATE images SET ref_count = ref_count + delta, last_used_at = NOW() WHERE id = target;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION post_images_ref_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        PERFORM count_image_refs(NEW.image_id, 1);
+    ELSE
+        PERFORM count_image_refs(OLD.image_id, -1);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_images_ref_count
+AFTER INSERT OR DELETE ON post_images
+FOR EACH ROW EXECUTE FUNCTION post_images_ref_count();
+
+CREATE OR REPLACE FUNCTION user_avatar_ref_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.avatar_image_id IS NOT NULL THEN
+        PERFORM count_image_refs(OLD.avatar_image_id, -1);
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.avatar_image_id IS NOT NULL THEN
+        PERFORM count_image_refs(NEW.avatar_image_id, 1);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_avatar_ref_count
+AFTER INSERT OR DELETE OR UPDATE OF avatar_image_id ON users
+FOR EACH ROW EXECUTE FUNCTION user_avatar_ref_count();
+
+-- storage files of collected images, deleted by the collector after the
+-- rows are gone so a failing storage backend can't leave dangling rows
+CREATE TABLE IF NOT EXISTS blob_deletions(
+    storage_key text PRIMARY KEY,
+    createdAt timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_images_processing;
+
+ALTER TABLE images DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE images DROP COLUMN IF EXISTS processing_attempts;
+ALTER TABLE images DROP COLUMN IF EXISTS processing_error;
+ALTER TABLE images DROP COLUMN IF EXISTS source_key;
+ALTER TABLE images DROP COLUMN IF EXISTS codec;
+ALTER TABLE images DROP COLUMN IF EXISTS duration_ms;
+ALTER TABLE images DROP COLUMN IF EXISTS status;
+ALTER TABLE images DROP COLUMN IF EXISTS media_type;
@@ -0,0 +1,15 @@
+ALTER TABLE images ADD COLUMN IF NOT EXISTS media_type VARCHAR(20) NOT NULL DEFAULT 'image'
+    CHECK (media_type IN ('image', 'video', 'animation'));
+ALTER TABLE images ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'ready'
+    CHECK (status IN ('processing', 'ready', 'failed'));
+ALTER TABLE images ADD COLUMN IF NOT EXISTS duration_ms INT NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS codec VARCHAR(50) NOT NULL DEFAULT '';
+
+-- the upload as received, kept until transcoding is done with it
+ALTER TABLE images ADD COLUMN IF NOT EXISTS source_key text NOT NULL DEFAULT '';
+
+ALTER TABLE images ADD COLUMN IF NOT EXISTS processing_error text NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS processing_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN IF NOT EXISTS locked_until timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_images_processing ON images (id) WHERE status = 'processing';
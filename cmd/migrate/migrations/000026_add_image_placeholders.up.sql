@@ -0,0 +1,3 @@
+-- shown by clients while the image itself is loading
+ALTER TABLE images ADD COLUMN IF NOT EXISTS blurhash VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS dominant_color VARCHAR(7) NOT NULL DEFAULT '';
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS user_blocks(
+    blocker_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked_id ON user_blocks (blocked_id);
+
+CREATE TABLE IF NOT EXISTS comment_mentions(
+    comment_id bigint NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_user_id ON comment_mentions (user_id);
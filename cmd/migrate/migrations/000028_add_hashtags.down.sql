@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_posts_createdat;
+DROP TABLE IF EXISTS tag_followers;
+DROP TABLE IF EXISTS post_tags;
+DROP TABLE IF EXISTS tags;
+
+ALTER TABLE posts ALTER COLUMN tags DROP NOT NULL;
+ALTER TABLE posts ALTER COLUMN tags DROP DEFAULT;
+ALTER TABLE posts ALTER COLUMN tags TYPE VARCHAR(100) USING left(tags::text, 100);
+
+CREATE INDEX IF NOT EXISTS idx_posts_tags ON posts USING gin (tags gin_trgm_ops);
@@ -0,0 +1,57 @@
+-- posts.tags held a text array literal in a varchar, which neither @> nor
+-- the trigram index from 000008 could use. It becomes a real array of the
+-- tags given explicitly, while post_tags holds every tag of a post,
+-- including the hashtags in its content, for lookups.
+DROP INDEX IF EXISTS idx_posts_tags;
+
+ALTER TABLE posts ALTER COLUMN tags TYPE text[] USING COALESCE(tags::text[], '{}');
+ALTER TABLE posts ALTER COLUMN tags SET DEFAULT '{}';
+UPDATE posts SET tags = '{}' WHERE tags IS NULL;
+ALTER TABLE posts ALTER COLUMN tags SET NOT NULL;
+
+-- names are stored normalised and case-folded
+CREATE TABLE IF NOT EXISTS tags(
+    id bigserial PRIMARY KEY,
+    name VARCHAR(200) NOT NULL UNIQUE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS post_tags(
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag_id ON post_tags (tag_id, post_id);
+
+CREATE TABLE IF NOT EXISTS tag_followers(
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, tag_id)
+);
+
+-- tag pages and trending scan posts by time
+CREATE INDEX IF NOT EXISTS idx_posts_createdat ON posts (createdAt);
+
+-- Backfill from the explicit tags and the hashtags in existing content.
+-- lower() only approximates the normalisation the API does, so `make
+-- retag` has to run once afterwards to redo it the same way.
+CREATE TEMPORARY TABLE found_tags AS
+SELECT DISTINCT post_id, name FROM (
+    SELECT p.id AS post_id, lower(btrim(t, '#')) AS name
+    FROM posts p, unnest(p.tags) AS t
+    UNION
+    SELECT p.id, lower(m[1])
+    FROM posts p, regexp_matches(p.content, '(?:^|[^[:alnum:]_&#/])#([[:alnum:]_]+)', 'g') AS m
+) f
+WHERE name ~ '^[[:alnum:]_]+$' AND name ~ '[[:alpha:]]' AND char_length(name) <= 50;
+
+INSERT INTO tags (name) SELECT DISTINCT name FROM found_tags
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO post_tags (post_id, tag_id)
+SELECT f.post_id, t.id FROM found_tags f JOIN tags t ON t.name = f.name
+ON CONFLICT DO NOTHING;
+
+DROP TABLE found_tags;
@@ -0,0 +1,31 @@
+-- One preview per normalised URL, shared by every post linking to it.
+-- status tracks fetching; a preview stays visible while it is refreshed.
+CREATE TABLE IF NOT EXISTS link_previews(
+    url text PRIMARY KEY,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'ready', 'failed')),
+    title text NOT NULL DEFAULT '',
+    description text NOT NULL DEFAULT '',
+    image_url text NOT NULL DEFAULT '',
+    site_name text NOT NULL DEFAULT '',
+    preview_type VARCHAR(50) NOT NULL DEFAULT '',
+    error text NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    -- leased to a worker, or waiting to be retried, until then
+    locked_until timestamp(0) with time zone,
+    fetched_at timestamp(0) with time zone,
+    -- once past, the next post linking here fetches the page again
+    expires_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_previews_pending ON link_previews (created_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS post_links(
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    url text NOT NULL REFERENCES link_previews(url) ON DELETE CASCADE,
+    position INT NOT NULL,
+    PRIMARY KEY (post_id, url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_links_url ON post_links (url);
@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_posts_createdat ON posts (createdAt);
+DROP INDEX IF EXISTS idx_posts_createdat_id;
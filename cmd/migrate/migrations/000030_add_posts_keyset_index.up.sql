@@ -0,0 +1,3 @@
+-- keyset pagination orders and seeks by (createdAt, id)
+CREATE INDEX IF NOT EXISTS idx_posts_createdat_id ON posts (createdAt, id);
+DROP INDEX IF EXISTS idx_posts_createdat;
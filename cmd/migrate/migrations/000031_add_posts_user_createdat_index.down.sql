@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts (user_id);
+DROP INDEX IF EXISTS idx_posts_user_id_createdat;
@@ -0,0 +1,4 @@
+-- feeds read each followed author's posts within a time window, newest
+-- first; this also serves lookups by user_id alone
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_createdat ON posts (user_id, createdAt, id);
+DROP INDEX IF EXISTS idx_posts_user_id;
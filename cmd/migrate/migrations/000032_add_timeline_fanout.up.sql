@@ -0,0 +1,11 @@
+-- Posts waiting to be pushed into their readers' cached home timelines.
+-- Rows are leased to a worker the same way link previews are.
+CREATE TABLE IF NOT EXISTS timeline_fanout(
+    post_id bigint PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+    error text NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    locked_until timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_timeline_fanout_created_at ON timeline_fanout (created_at);
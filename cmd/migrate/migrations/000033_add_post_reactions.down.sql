@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_comments_user_id;
+DROP TABLE IF EXISTS post_reactions;
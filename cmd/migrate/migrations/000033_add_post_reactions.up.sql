@@ -0,0 +1,13 @@
+-- One reaction per user and post; reacting again replaces it.
+CREATE TABLE IF NOT EXISTS post_reactions(
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reaction VARCHAR(20) NOT NULL
+        CHECK (reaction IN ('like', 'love', 'laugh', 'insightful')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id)
+);
+
+-- the ranked feed looks up who a user interacted with recently
+CREATE INDEX IF NOT EXISTS idx_post_reactions_user_id ON post_reactions (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments (user_id, createdAt);
@@ -0,0 +1,3 @@
+-- whether the user's public posts are published as RSS, Atom and JSON
+-- feeds; users opt in, since feeds can be read without signing in
+ALTER TABLE users ADD COLUMN IF NOT EXISTS feeds_enabled boolean NOT NULL DEFAULT false;
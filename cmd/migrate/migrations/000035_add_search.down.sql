@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
+
+DROP INDEX IF EXISTS idx_comments_search_vector;
+ALTER TABLE comments DROP COLUMN IF EXISTS search_vector;
+
+DROP INDEX IF EXISTS idx_posts_search_vector;
+DROP TRIGGER IF EXISTS posts_search_vector ON posts;
+DROP FUNCTION IF EXISTS posts_search_vector();
+ALTER TABLE posts DROP COLUMN IF EXISTS search_vector;
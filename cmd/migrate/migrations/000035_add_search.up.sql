@@ -0,0 +1,34 @@
+-- Posts are searched by title, tags and content, in that order of weight.
+-- Tags live in an array, which a generated column can't turn into text, so
+-- a trigger keeps the vector up to date.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector NOT NULL DEFAULT ''::tsvector;
+
+CREATE OR REPLACE FUNCTION posts_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', COALESCE(NEW.title, '')), 'A') ||
+        setweight(to_tsvector('english', array_to_string(NEW.tags, ' ')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(NEW.content, '')), 'C');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_search_vector
+BEFORE INSERT OR UPDATE OF title, content, tags ON posts
+FOR EACH ROW EXECUTE FUNCTION posts_search_vector();
+
+-- fires the trigger for existing posts
+UPDATE posts SET title = title;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING gin (search_vector);
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING gin (search_vector);
+
+-- users are found by similarity of their username or display name
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING gin (display_name gin_trgm_ops);
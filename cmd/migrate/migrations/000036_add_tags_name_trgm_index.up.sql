@@ -0,0 +1,3 @@
+-- autocomplete looks tags up by prefix, like users through the indexes
+-- from 000035
+CREATE INDEX IF NOT EXISTS idx_tags_name_trgm ON tags USING gin (name gin_trgm_ops);
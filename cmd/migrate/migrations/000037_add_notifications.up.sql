@@ -0,0 +1,27 @@
+-- A notification groups everyone who did the same thing to the same thing
+-- ("5 people reacted to your post") for as long as it is unread. Once it
+-- is read, the next one starts a new group.
+CREATE TABLE IF NOT EXISTS notifications(
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL
+        CHECK (type IN ('follow', 'comment', 'mention', 'reaction')),
+    post_id bigint REFERENCES posts(id) ON DELETE CASCADE,
+    -- what is grouped together, such as 'reaction:42'
+    group_key VARCHAR(100) NOT NULL,
+    read_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    -- when the latest actor joined the group
+    updated_at timestamp with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread_group ON notifications (user_id, group_key) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_updated_at ON notifications (user_id, updated_at, id);
+
+CREATE TABLE IF NOT EXISTS notification_actors(
+    notification_id bigint NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    actor_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    comment_id bigint REFERENCES comments(id) ON DELETE CASCADE,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (notification_id, actor_id)
+);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS users_followers_count ON followers;
+DROP FUNCTION IF EXISTS users_followers_count();
+
+ALTER TABLE users DROP COLUMN IF EXISTS followers_count;
@@ -0,0 +1,20 @@
+-- followers_count is kept up to date by a trigger, so telling large
+-- accounts apart and ranking users by popularity doesn't count followers
+ALTER TABLE users ADD COLUMN IF NOT EXISTS followers_count bigint NOT NULL DEFAULT 0;
+
+UPDATE users u SET followers_count = (SELECT count(*) FROM followers f WHERE f.user_id = u.id);
+
+CREATE OR REPLACE FUNCTION users_followers_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET followers_count = followers_count + 1 WHERE id = NEW.user_id;
+    ELSE
+        UPDATE users SET followers_count = followers_count - 1 WHERE id = OLD.user_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_followers_count
+AFTER INSERT OR DELETE ON followers
+FOR EACH ROW EXECUTE FUNCTION users_followers_count();
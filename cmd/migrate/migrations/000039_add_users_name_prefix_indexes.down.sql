@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_display_name_prefix;
+DROP INDEX IF EXISTS idx_users_username_prefix;
@@ -0,0 +1,4 @@
+-- autocomplete matches the start of usernames and display names, which the
+-- trigram indexes from 000035 can't narrow down for one or two characters
+CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users (lower(username) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_display_name_prefix ON users (lower(display_name) text_pattern_ops);
@@ -0,0 +1,46 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	ErrNotFound         = errors.New("blob not found")
+	ErrInvalidKey       = errors.New("invalid blob key")
+	ErrInvalidSignature = errors.New("invalid or expired signature")
+)
+
+// Storage keeps uploaded media under keys chosen by the caller, such as
+// "images/42/1f0c....jpg". Keys use forward slashes on every driver.
+type Storage interface {
+	// Put stores the contents of r under key, replacing any existing object.
+	// size is the number of bytes r will yield, or -1 when it isn't known.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object for reading. It fails with ErrNotFound when there
+	// is nothing under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// URL returns an address clients can download the object from. Drivers
+	// serving private objects return a signed URL that eventually expires, so
+	// URLs are built when responding rather than stored.
+	URL(key string) (string, error)
+}
+
+// cleanKey rejects keys that could escape the storage root once they're
+// turned into paths.
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidKey
+	}
+
+	return cleaned, nil
+}
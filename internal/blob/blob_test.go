@@ -0,0 +1,48 @@
+package blob
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key string
+		err error
+	}{
+		{key: "images/42/a.jpg"},
+		{key: "a"},
+		{key: "a b/é.jpg"},
+		{key: "..a/b.."},
+		// percent signs are part of the name, nothing decodes them
+		{key: "%2e%2e%2fetc%2fpasswd"},
+		{key: "a%2F..%2F..%2Fb"},
+		{key: "", err: ErrInvalidKey},
+		{key: ".", err: ErrInvalidKey},
+		{key: "..", err: ErrInvalidKey},
+		{key: "../a", err: ErrInvalidKey},
+		{key: "../../etc/passwd", err: ErrInvalidKey},
+		{key: "a/../../b", err: ErrInvalidKey},
+		{key: "a/..", err: ErrInvalidKey},
+		{key: "a/../b", err: ErrInvalidKey},
+		{key: "./a", err: ErrInvalidKey},
+		{key: "a/./b", err: ErrInvalidKey},
+		{key: "a//b", err: ErrInvalidKey},
+		{key: "a/", err: ErrInvalidKey},
+		{key: "/etc/passwd", err: ErrInvalidKey},
+		{key: "//host/share", err: ErrInvalidKey},
+		{key: "a\\..\\..\\b", err: ErrInvalidKey},
+		{key: "..\\a", err: ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		got, err := cleanKey(tt.key)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("cleanKey(%q) error = %v, want %v", tt.key, err, tt.err)
+			continue
+		}
+		if tt.err == nil && got != tt.key {
+			t.Errorf("cleanKey(%q) = %q, want it unchanged", tt.key, got)
+		}
+	}
+}
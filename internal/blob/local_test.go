@@ -0,0 +1,166 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T, expiry time.Duration) *Local {
+	t.Helper()
+
+	l, err := NewLocal(LocalConfig{
+		Dir:           t.TempDir(),
+		BaseURL:       "http://localhost:8080/v1/media",
+		SigningSecret: "secret",
+		URLExpiry:     expiry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// openURL opens a URL made by Local.URL the way the media handler does.
+func openURL(l *Local, rawURL string) (*os.File, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	key, err := url.PathUnescape(strings.TrimPrefix(u.EscapedPath(), "/v1/media/"))
+	if err != nil {
+		return nil, err
+	}
+	return l.Open(key, u.Query().Get("expires"), u.Query().Get("signature"))
+}
+
+func TestLocalURLRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t, time.Hour)
+
+	for _, key := range []string{"images/1/a.jpg", "a b/é?#.jpg", "a%2F..%2Fb", "%2e%2e"} {
+		t.Run(key, func(t *testing.T) {
+			if err := l.Put(ctx, key, strings.NewReader(key), -1, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			u, err := l.URL(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := openURL(l, u)
+			if err != nil {
+				t.Fatalf("opening %s: %v", u, err)
+			}
+			defer f.Close()
+
+			// the file stays inside the storage directory
+			rel, err := filepath.Rel(l.dir, f.Name())
+			if err != nil || strings.HasPrefix(rel, "..") {
+				t.Errorf("%q is stored at %s, outside %s", key, f.Name(), l.dir)
+			}
+			if got, _ := io.ReadAll(f); string(got) != key {
+				t.Errorf("read %q, want %q", got, key)
+			}
+		})
+	}
+}
+
+func TestLocalOpen(t *testing.T) {
+	l := newTestLocal(t, time.Hour)
+	if err := l.Put(context.Background(), "a.jpg", strings.NewReader("a"), 1, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Second).Unix()
+	exp := strconv.FormatInt(future, 10)
+	sig := l.sign("a.jpg", future)
+
+	other, err := NewLocal(LocalConfig{Dir: l.dir, SigningSecret: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		expires   string
+		signature string
+		err       error
+	}{
+		{name: "valid", key: "a.jpg", expires: exp, signature: sig},
+		{name: "missing file", key: "b.jpg", expires: exp, signature: l.sign("b.jpg", future), err: ErrNotFound},
+		{name: "expired", key: "a.jpg", expires: strconv.FormatInt(past, 10), signature: l.sign("a.jpg", past), err: ErrInvalidSignature},
+		{name: "expiry pushed back", key: "a.jpg", expires: strconv.FormatInt(future+3600, 10), signature: sig, err: ErrInvalidSignature},
+		{name: "not a number", key: "a.jpg", expires: exp + "x", signature: sig, err: ErrInvalidSignature},
+		{name: "no expiry", key: "a.jpg", signature: sig, err: ErrInvalidSignature},
+		{name: "another key", key: "b.jpg", expires: exp, signature: sig, err: ErrInvalidSignature},
+		{name: "tampered", key: "a.jpg", expires: exp, signature: sig[:len(sig)-1] + "0", err: ErrInvalidSignature},
+		{name: "upper case", key: "a.jpg", expires: exp, signature: strings.ToUpper(sig), err: ErrInvalidSignature},
+		{name: "truncated", key: "a.jpg", expires: exp, signature: sig[:32], err: ErrInvalidSignature},
+		{name: "no signature", key: "a.jpg", expires: exp, err: ErrInvalidSignature},
+		{name: "another secret", key: "a.jpg", expires: exp, signature: other.sign("a.jpg", future), err: ErrInvalidSignature},
+		// even a correctly signed traversal key stays inside the directory
+		{name: "signed traversal", key: "../a.jpg", expires: exp, signature: l.sign("../a.jpg", future), err: ErrInvalidKey},
+		{name: "signed absolute path", key: "/etc/passwd", expires: exp, signature: l.sign("/etc/passwd", future), err: ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := l.Open(tt.key, tt.expires, tt.signature)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Open() error = %v, want %v", err, tt.err)
+			}
+			if f != nil {
+				f.Close()
+			}
+		})
+	}
+}
+
+func TestLocalURLExpires(t *testing.T) {
+	l := newTestLocal(t, -time.Second)
+	if err := l.Put(context.Background(), "a.jpg", strings.NewReader("a"), 1, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := l.URL("a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openURL(l, u); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("opening an expired URL: error = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestLocalRejectsTraversal(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLocal(t, time.Hour)
+
+	for _, key := range []string{"../escaped", "a/../../escaped", "/tmp/escaped", "..\\escaped"} {
+		if err := l.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+		if _, err := l.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+		if err := l.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+		if _, err := l.URL(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("URL(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(l.dir), "escaped")); err == nil {
+		t.Error("a file was written outside the storage directory")
+	}
+}
@@ -0,0 +1,322 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type S3Config struct {
+	// Endpoint is the base URL of the service, e.g. "https://s3.amazonaws.com"
+	// or "http://localhost:9000" for MinIO.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of
+	// bucket.endpoint/key. MinIO and most S3 stand-ins need it.
+	PathStyle bool
+	// PublicURL, when set, is a public base URL objects are served from
+	// (a CDN or a public bucket). Otherwise URL returns presigned links.
+	PublicURL string
+	URLExpiry time.Duration
+}
+
+// S3 stores blobs in an S3-compatible bucket. Requests are signed with AWS
+// Signature Version 4, so it works against AWS as well as MinIO.
+type S3 struct {
+	cfg    S3Config
+	base   *url.URL
+	client *http.Client
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3 blob storage needs a bucket and credentials")
+	}
+
+	base, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %q", cfg.Endpoint)
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	return &S3{
+		cfg:    cfg,
+		base:   base,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	// S3 needs the length up front; spool unknown-sized bodies to disk
+	// rather than memory
+	if size < 0 {
+		tmp, err := os.CreateTemp("", "s3-upload-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if size, err = io.Copy(tmp, r); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r = tmp
+	}
+
+	body := io.NopCloser(r)
+	if size == 0 {
+		body = http.NoBody
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return s.do(req, http.StatusOK)
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer res.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, res.Status, body)
+	}
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key).String(), nil)
+	if err != nil {
+		return err
+	}
+
+	// S3 answers 204 whether or not the object existed
+	return s.do(req, http.StatusNoContent)
+}
+
+func (s *S3) URL(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	if s.cfg.PublicURL != "" {
+		return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/" + escapePath(key), nil
+	}
+
+	return s.presign(http.MethodGet, key, time.Now().UTC(), s.cfg.URLExpiry), nil
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.base
+	if s.cfg.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.cfg.Bucket + "/" + key
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	u.RawPath = escapePath(u.Path)
+	return &u
+}
+
+func (s *S3) do(req *http.Request, want int) error {
+	s.sign(req, time.Now().UTC())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != want {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, res.Status, body)
+	}
+
+	return nil
+}
+
+const (
+	sigAlgorithm    = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+// sign adds a Signature Version 4 Authorization header to req. The payload
+// is left unsigned so bodies can be streamed.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers["content-type"] = ct
+	}
+
+	canonicalHeaders, signedHeaders := canonicalizeHeaders(headers)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := s.scope(now)
+	signature := s.signature(now, scope, amzDate, canonicalRequest)
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigAlgorithm, s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// presign returns a URL granting method on key until expiry runs out.
+func (s *S3) presign(method, key string, now time.Time, expiry time.Duration) string {
+	u := s.objectURL(key)
+	amzDate := now.Format(amzDateFormat)
+	scope := s.scope(now)
+
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", sigAlgorithm)
+	q.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalHeaders, signedHeaders := canonicalizeHeaders(map[string]string{"host": u.Host})
+	canonicalRequest := strings.Join([]string{
+		method,
+		escapePath(u.Path),
+		strings.ReplaceAll(q.Encode(), "+", "%20"),
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	q.Set("X-Amz-Signature", s.signature(now, scope, amzDate, canonicalRequest))
+	u.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+
+	return u.String()
+}
+
+func (s *S3) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(now time.Time, scope, amzDate, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		sigAlgorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalizeHeaders(headers map[string]string) (string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+
+	return b.String(), strings.Join(names, ";")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath percent-encodes everything but unreserved characters and
+// slashes, as Signature Version 4 expects for S3 object paths.
+func escapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -2,16 +2,26 @@ package cloudinary
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+	"github.com/cloudinary/cloudinary-go/v2/asset"
+	"github.com/supremed3v/social-media/internal/blob"
 )
 
 type CloudinaryConfig struct {
 	CloudName string
 	APIKey    string
 	APISecret string
+	// Timeout bounds every request to Cloudinary, reading the response
+	// included.
+	Timeout time.Duration
 }
 
 type CloudinaryService interface {
@@ -21,7 +31,8 @@ type CloudinaryService interface {
 }
 
 type Cloudinary struct {
-	cld *cloudinary.Cloudinary
+	cld    *cloudinary.Cloudinary
+	client *http.Client
 }
 
 func NewCloudinary(cfg CloudinaryConfig) (*Cloudinary, error) {
@@ -30,7 +41,14 @@ func NewCloudinary(cfg CloudinaryConfig) (*Cloudinary, error) {
 		return nil, err
 	}
 
-	return &Cloudinary{cld: cld}, nil
+	// the SDK's own clients have no timeout either
+	cld.Upload.Client.Timeout = cfg.Timeout
+	cld.Admin.Client.Timeout = cfg.Timeout
+
+	return &Cloudinary{
+		cld:    cld,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
 }
 
 func (c *Cloudinary) UploadImage(ctx context.Context, imagePath string) (string, error) {
@@ -67,3 +85,93 @@ func (c *Cloudinary) UploadImageFromReader(ctx context.Context, reader io.Reader
 
 	return uploadResult.URL, nil
 }
+
+// Put, Get, Delete and URL let Cloudinary act as a blob.Storage. The key,
+// minus its extension, becomes the asset's public ID, and the extension
+// tells videos apart from images.
+func (c *Cloudinary) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	overwrite := true
+	res, err := c.cld.Upload.Upload(ctx, r, uploader.UploadParams{
+		PublicID:     publicID(key),
+		Overwrite:    &overwrite,
+		ResourceType: resourceType(key),
+	})
+	if err != nil {
+		return err
+	}
+
+	// rejected uploads come back as a result carrying the error
+	if res.Error.Message != "" {
+		return fmt.Errorf("cloudinary upload %s: %s", publicID(key), res.Error.Message)
+	}
+
+	return nil
+}
+
+func (c *Cloudinary) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	u, err := c.URL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, blob.ErrNotFound
+	default:
+		res.Body.Close()
+		return nil, fmt.Errorf("cloudinary GET %s: %s", publicID(key), res.Status)
+	}
+}
+
+func (c *Cloudinary) Delete(ctx context.Context, key string) error {
+	_, err := c.cld.Upload.Destroy(ctx, uploader.DestroyParams{
+		PublicID:     publicID(key),
+		ResourceType: resourceType(key),
+	})
+
+	return err
+}
+
+func (c *Cloudinary) URL(key string) (string, error) {
+	var (
+		a   *asset.Asset
+		err error
+	)
+	if resourceType(key) == "video" {
+		a, err = c.cld.Video(publicID(key))
+	} else {
+		a, err = c.cld.Image(publicID(key))
+	}
+	if err != nil {
+		return "", err
+	}
+	a.Config.URL.Secure = true
+
+	return a.String()
+}
+
+func publicID(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key))
+}
+
+func resourceType(key string) string {
+	switch path.Ext(key) {
+	case ".mp4", ".webm", ".mov", ".avi", ".mkv":
+		return "video"
+	default:
+		return "image"
+	}
+}
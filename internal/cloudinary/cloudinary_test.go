@@ -0,0 +1,106 @@
+package cloudinary
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/supremed3v/social-media/internal/blob"
+)
+
+// redirect sends every request to the test server, whatever its host.
+type redirect struct {
+	to *url.URL
+}
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = r.to.Scheme
+	req.URL.Host = r.to.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGet(t *testing.T) {
+	stall := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "missing"):
+			http.NotFound(w, r)
+		case strings.Contains(r.URL.Path, "stalled"):
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-stall
+		case strings.Contains(r.URL.Path, "broken"):
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			io.WriteString(w, "image")
+		}
+	}))
+	defer srv.Close()
+	// let the stalled handler return before the server waits on it
+	defer close(stall)
+	to, _ := url.Parse(srv.URL)
+
+	c, err := NewCloudinary(CloudinaryConfig{CloudName: "demo", APIKey: "key", APISecret: "secret", Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.client.Transport = redirect{to}
+
+	if c.cld.Upload.Client.Timeout != 100*time.Millisecond || c.cld.Admin.Client.Timeout != 100*time.Millisecond {
+		t.Error("the SDK clients don't use the timeout")
+	}
+
+	tests := []struct {
+		key  string
+		want string
+		err  error
+	}{
+		{key: "images/1/a.jpg", want: "image"},
+		{key: "images/1/missing.jpg", err: blob.ErrNotFound},
+		{key: "images/1/broken.jpg", err: errors.New("any")},
+		{key: "images/1/stalled.jpg", err: errors.New("any")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			done := make(chan struct{})
+			var (
+				got []byte
+				err error
+			)
+			go func() {
+				defer close(done)
+				var rc io.ReadCloser
+				if rc, err = c.Get(context.Background(), tt.key); err == nil {
+					got, err = io.ReadAll(rc)
+					rc.Close()
+				}
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Get() is still waiting on a stalled response")
+			}
+
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("Get() error = %v", err)
+			case tt.err != nil && err == nil:
+				t.Fatalf("Get() succeeded, want an error")
+			case errors.Is(tt.err, blob.ErrNotFound) && !errors.Is(err, blob.ErrNotFound):
+				t.Fatalf("Get() error = %v, want %v", err, blob.ErrNotFound)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Get() read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
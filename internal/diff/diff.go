@@ -0,0 +1,70 @@
+package diff
+
+import "strings"
+
+type Op string
+
+const (
+	OpEqual  Op = "equal"
+	OpInsert Op = "insert"
+	OpDelete Op = "delete"
+)
+
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns a line-by-line diff turning a into b, based on the longest
+// common subsequence of their lines.
+func Lines(a, b string) []Line {
+	x := splitLines(a)
+	y := splitLines(b)
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := []Line{}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Op: OpEqual, Text: x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Op: OpDelete, Text: x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: OpInsert, Text: y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Op: OpDelete, Text: x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Op: OpInsert, Text: y[j]})
+	}
+
+	return lines
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
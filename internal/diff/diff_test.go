@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	eq := func(s string) Line { return Line{Op: OpEqual, Text: s} }
+	ins := func(s string) Line { return Line{Op: OpInsert, Text: s} }
+	del := func(s string) Line { return Line{Op: OpDelete, Text: s} }
+
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{name: "both empty", want: []Line{}},
+		{name: "unchanged", a: "one\ntwo", b: "one\ntwo", want: []Line{eq("one"), eq("two")}},
+		{name: "added to empty", b: "one\ntwo", want: []Line{ins("one"), ins("two")}},
+		{name: "emptied", a: "one\ntwo", want: []Line{del("one"), del("two")}},
+		{
+			name: "line changed",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			want: []Line{eq("one"), del("two"), ins("2"), eq("three")},
+		},
+		{
+			name: "line inserted",
+			a:    "one\nthree",
+			b:    "one\ntwo\nthree",
+			want: []Line{eq("one"), ins("two"), eq("three")},
+		},
+		{
+			name: "line removed",
+			a:    "one\ntwo\nthree",
+			b:    "one\nthree",
+			want: []Line{eq("one"), del("two"), eq("three")},
+		},
+		{
+			name: "appended",
+			a:    "one",
+			b:    "one\ntwo",
+			want: []Line{eq("one"), ins("two")},
+		},
+		{
+			name: "trailing newline",
+			a:    "one",
+			b:    "one\n",
+			want: []Line{eq("one"), ins("")},
+		},
+		{
+			name: "lines moved",
+			a:    "a\nb\nc",
+			b:    "c\na\nb",
+			want: []Line{ins("c"), eq("a"), eq("b"), del("c")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLinesRebuilds checks that every diff turns a into b: the equal and
+// deleted lines make up a, the equal and inserted ones b.
+func TestLinesRebuilds(t *testing.T) {
+	tests := [][2]string{
+		{"the quick\nbrown fox\njumps", "the slow\nbrown fox\nwalks\naway"},
+		{"a\nb\na\nb", "b\na\nb\na"},
+		{"x", "y"},
+		{"", "only\nnew"},
+	}
+
+	for _, tt := range tests {
+		var a, b []string
+		for _, l := range Lines(tt[0], tt[1]) {
+			if l.Op != OpInsert {
+				a = append(a, l.Text)
+			}
+			if l.Op != OpDelete {
+				b = append(b, l.Text)
+			}
+		}
+
+		if !reflect.DeepEqual(a, splitLines(tt[0])) || !reflect.DeepEqual(b, splitLines(tt[1])) {
+			t.Errorf("Lines(%q, %q) rebuilds %q and %q", tt[0], tt[1], a, b)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -56,3 +57,35 @@ func GetBool(key string, fallback bool) bool {
 
 	return boolVal
 }
+
+func GetFloat(key string, fallback float64) float64 {
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	val := os.Getenv(key)
+
+	floatVal, err := strconv.ParseFloat(val, 64)
+
+	if err != nil {
+		return fallback
+	}
+
+	return floatVal
+}
+
+func GetDuration(key string, fallback time.Duration) time.Duration {
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	val := os.Getenv(key)
+
+	duration, err := time.ParseDuration(val)
+
+	if err != nil {
+		return fallback
+	}
+
+	return duration
+}
@@ -0,0 +1,81 @@
+package hashtag
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength is the longest tag accepted, in characters.
+const MaxLength = 50
+
+// A hashtag is letters, digits and underscores after a "#", along with the
+// combining marks that scripts such as Devanagari write letters with. Like
+// mentions it has to start the text or follow a character that can't be
+// part of a word, which leaves out URL fragments and HTML entities such as
+// "&#39;".
+var hashtagRx = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_&#/])#([\p{L}\p{M}\p{N}_]+)`)
+
+var tagRx = regexp.MustCompile(`^[\p{L}\p{M}\p{N}_]+$`)
+
+// Normalize returns the form tags are stored and looked up in: without the
+// leading "#", Unicode-normalised and case-folded so "#GoLang" and
+// "#golang" are the same tag. ok is false for strings that aren't valid
+// tags; a tag needs at least one letter so "#1" isn't one.
+func Normalize(tag string) (string, bool) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+	tag = cases.Fold().String(norm.NFKC.String(tag))
+
+	if !tagRx.MatchString(tag) || utf8.RuneCountInString(tag) > MaxLength {
+		return "", false
+	}
+	if strings.IndexFunc(tag, unicode.IsLetter) < 0 {
+		return "", false
+	}
+
+	return tag, true
+}
+
+// NormalizePrefix is Normalize for the start of a tag that is still being
+// typed, which may not have a letter yet.
+func NormalizePrefix(prefix string) (string, bool) {
+	prefix = strings.TrimPrefix(strings.TrimSpace(prefix), "#")
+	prefix = cases.Fold().String(norm.NFKC.String(prefix))
+
+	if !tagRx.MatchString(prefix) || utf8.RuneCountInString(prefix) > MaxLength {
+		return "", false
+	}
+
+	return prefix, true
+}
+
+// Extract returns the distinct normalised hashtags in text, in order of
+// appearance.
+func Extract(text string) []string {
+	var tags []string
+	for _, m := range hashtagRx.FindAllStringSubmatch(text, -1) {
+		tags = append(tags, m[1])
+	}
+	return Merge(tags)
+}
+
+// Merge normalises and de-duplicates several lists of tags, keeping the
+// order they first appear in. Invalid tags are dropped.
+func Merge(lists ...[]string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, list := range lists {
+		for _, t := range list {
+			tag, ok := Normalize(t)
+			if ok && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
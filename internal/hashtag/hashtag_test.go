@@ -0,0 +1,105 @@
+package hashtag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+		ok   bool
+	}{
+		{tag: "golang", want: "golang", ok: true},
+		{tag: "#GoLang", want: "golang", ok: true},
+		{tag: "  #go_1 ", want: "go_1", ok: true},
+		{tag: "Café", want: "café", ok: true},
+		// a decomposed accent composes to the same tag
+		{tag: "Cafe\u0301", want: "café", ok: true},
+		// full-width letters fold to plain ones
+		{tag: "ＧＯ", want: "go", ok: true},
+		{tag: "Straße", want: "strasse", ok: true},
+		{tag: "ΣΟΦΙΑ", want: "σοφια", ok: true},
+		{tag: "日本語", want: "日本語", ok: true},
+		{tag: "हिन्दी", want: "हिन्दी", ok: true},
+		{tag: "Ⅻ", want: "xii", ok: true},
+		{tag: "", ok: false},
+		{tag: "#", ok: false},
+		{tag: "123", ok: false},
+		{tag: "go-lang", ok: false},
+		{tag: "go lang", ok: false},
+		{tag: "##go", ok: false},
+		{tag: "😀", ok: false},
+		{tag: strings.Repeat("a", MaxLength), want: strings.Repeat("a", MaxLength), ok: true},
+		{tag: strings.Repeat("a", MaxLength+1), ok: false},
+		{tag: strings.Repeat("é", MaxLength), want: strings.Repeat("é", MaxLength), ok: true},
+	}
+
+	for _, tt := range tests {
+		got, ok := Normalize(tt.tag)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.tag, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalizePrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{prefix: "#Go", want: "go", ok: true},
+		{prefix: "2", want: "2", ok: true},
+		{prefix: "Stra", want: "stra", ok: true},
+		{prefix: "", ok: false},
+		{prefix: "go-", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := NormalizePrefix(tt.prefix)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizePrefix(%q) = %q, %v, want %q, %v", tt.prefix, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "none", text: "no tags here", want: []string{}},
+		{name: "start and middle", text: "#go is fun, #Rust too", want: []string{"go", "rust"}},
+		{name: "duplicates in any case", text: "#Go #go #GO", want: []string{"go"}},
+		{name: "after punctuation", text: "(#go) and \"#rust\"", want: []string{"go", "rust"}},
+		{name: "url fragment", text: "https://example.com/page#section", want: []string{}},
+		{name: "html entity", text: "it&#39;s", want: []string{}},
+		{name: "inside a word", text: "c#sharp", want: []string{}},
+		{name: "double hash", text: "##go", want: []string{}},
+		{name: "numbers only", text: "#1 and #2024", want: []string{}},
+		{name: "unicode letters", text: "#Café au lait #日本語", want: []string{"café", "日本語"}},
+		{name: "combining marks", text: "#हिन्दी and #cafe\u0301", want: []string{"हिन्दी", "café"}},
+		{name: "after a word with marks", text: "हि#go", want: []string{}},
+		{name: "too long", text: "#" + strings.Repeat("a", MaxLength+1), want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Extract(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got := Merge([]string{"Go", "bad tag", "#rust"}, []string{"GO", "zig"}, nil)
+	want := []string{"go", "rust", "zig"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %q, want %q", got, want)
+	}
+}
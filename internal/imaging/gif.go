@@ -0,0 +1,105 @@
+package imaging
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// IsAnimatedGIF reports whether r holds a GIF with more than one frame. It
+// walks the block structure without decoding any pixels, so it is cheap
+// even for large files.
+func IsAnimatedGIF(r io.Reader) (bool, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return false, ErrUnsupportedFormat
+	}
+	if string(header[:3]) != "GIF" {
+		return false, ErrUnsupportedFormat
+	}
+
+	// global color table
+	if header[10]&0x80 != 0 {
+		if err := skip(br, 3<<(int(header[10]&0x07)+1)); err != nil {
+			return false, err
+		}
+	}
+
+	frames := 0
+	for {
+		block, err := br.ReadByte()
+		if err == io.EOF && frames == 1 {
+			// a missing trailer is common and harmless
+			return false, nil
+		}
+		if err != nil {
+			return false, gifError(err)
+		}
+
+		switch block {
+		case 0x2C: // image descriptor
+			frames++
+			if frames > 1 {
+				return true, nil
+			}
+
+			desc := make([]byte, 9)
+			if _, err := io.ReadFull(br, desc); err != nil {
+				return false, gifError(err)
+			}
+			// local color table
+			if desc[8]&0x80 != 0 {
+				if err := skip(br, 3<<(int(desc[8]&0x07)+1)); err != nil {
+					return false, err
+				}
+			}
+			// LZW minimum code size, then the image data
+			if _, err := br.ReadByte(); err != nil {
+				return false, gifError(err)
+			}
+			if err := skipSubBlocks(br); err != nil {
+				return false, err
+			}
+		case 0x21: // extension
+			if _, err := br.ReadByte(); err != nil {
+				return false, gifError(err)
+			}
+			if err := skipSubBlocks(br); err != nil {
+				return false, err
+			}
+		case 0x3B: // trailer
+			return false, nil
+		default:
+			return false, ErrUnsupportedFormat
+		}
+	}
+}
+
+func skipSubBlocks(br *bufio.Reader) error {
+	for {
+		size, err := br.ReadByte()
+		if err != nil {
+			return gifError(err)
+		}
+		if size == 0 {
+			return nil
+		}
+		if err := skip(br, int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+func skip(br *bufio.Reader, n int) error {
+	_, err := br.Discard(n)
+	return gifError(err)
+}
+
+func gifError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrUnsupportedFormat
+	}
+	return err
+}
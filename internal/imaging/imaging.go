@@ -0,0 +1,154 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image dimensions exceed the limit")
+)
+
+type Limits struct {
+	MaxWidth  int
+	MaxHeight int
+}
+
+// A Size describes one derivative to generate. Images are scaled down to fit
+// inside MaxSide x MaxSide, never up; MaxSide 0 keeps the original size.
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+var DefaultSizes = []Size{
+	{Name: "thumbnail", MaxSide: 320},
+	{Name: "medium", MaxSide: 1080},
+	{Name: "original", MaxSide: 0},
+}
+
+type Variant struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// Extension returns the file extension matching the variant's encoding.
+func (v Variant) Extension() string {
+	if v.ContentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// Process decodes the upload, checks it against the limits and re-encodes it
+// once per size. Re-encoding drops EXIF, GPS and any other metadata; the EXIF
+// orientation is applied to the pixels first so photos stay upright. The
+// image's placeholder is returned alongside the variants.
+func Process(r io.ReadSeeker, limits Limits, sizes []Size) ([]Variant, Placeholder, error) {
+	// check the header before decoding so oversized images never get
+	// allocated
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, Placeholder{}, ErrUnsupportedFormat
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, Placeholder{}, ErrUnsupportedFormat
+	}
+	if cfg.Width > limits.MaxWidth || cfg.Height > limits.MaxHeight {
+		return nil, Placeholder{}, fmt.Errorf("%w: %dx%d, max %dx%d", ErrTooLarge, cfg.Width, cfg.Height, limits.MaxWidth, limits.MaxHeight)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		if orientation, err = readOrientation(r); err != nil {
+			return nil, Placeholder{}, err
+		}
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, Placeholder{}, err
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, Placeholder{}, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	img = applyOrientation(img, orientation)
+
+	// keep transparency for formats that can have it
+	encodePNG := format == "png" || format == "gif" || format == "webp"
+	if encodePNG && isOpaque(img) {
+		encodePNG = false
+	}
+
+	variants := make([]Variant, 0, len(sizes))
+	for _, size := range sizes {
+		scaled := fit(img, size.MaxSide)
+
+		var buf bytes.Buffer
+		v := Variant{
+			Name:   size.Name,
+			Width:  scaled.Bounds().Dx(),
+			Height: scaled.Bounds().Dy(),
+		}
+
+		if encodePNG {
+			v.ContentType = "image/png"
+			err = png.Encode(&buf, scaled)
+		} else {
+			v.ContentType = "image/jpeg"
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return nil, Placeholder{}, err
+		}
+
+		v.Data = buf.Bytes()
+		variants = append(variants, v)
+	}
+
+	return variants, NewPlaceholder(img), nil
+}
+
+// fit scales img down so neither side exceeds maxSide.
+func fit(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxSide <= 0 || (w <= maxSide && h <= maxSide) {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxSide/w)
+		w = maxSide
+	} else {
+		w = max(1, w*maxSide/h)
+		h = maxSide
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
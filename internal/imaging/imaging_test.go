@@ -0,0 +1,315 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"testing"
+)
+
+var (
+	red   = color.NRGBA{R: 255, A: 255}
+	green = color.NRGBA{G: 255, A: 255}
+	blue  = color.NRGBA{B: 255, A: 255}
+	white = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+)
+
+// quadrants is red at the top left, green at the top right, blue at the
+// bottom left and white at the bottom right.
+func quadrants(w, h int) *image.NRGBA {
+	img := solid(w, h, white)
+	draw.Draw(img, image.Rect(0, 0, w/2, h/2), image.NewUniform(red), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(w/2, 0, w, h/2), image.NewUniform(green), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, h/2, w/2, h), image.NewUniform(blue), image.Point{}, draw.Src)
+	return img
+}
+
+// remap returns a w x h image whose pixel x, y is src's pixel at(x, y).
+func remap(src image.Image, w, h int, at func(x, y int) (int, int)) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := at(x, y)
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return dst
+}
+
+func mirrorX(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, y })
+}
+
+func mirrorY(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return x, h - 1 - y })
+}
+
+func transpose(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, h, w, func(x, y int) (int, int) { return y, x })
+}
+
+// stored returns how a camera stores upright with the EXIF orientation o,
+// so that applying o displays upright again.
+func stored(upright image.Image, o int) image.Image {
+	switch o {
+	case 2:
+		return mirrorX(upright)
+	case 3:
+		return mirrorX(mirrorY(upright))
+	case 4:
+		return mirrorY(upright)
+	case 5:
+		return transpose(upright)
+	case 6: // displayed rotated clockwise, so stored counter-clockwise
+		return mirrorY(transpose(upright))
+	case 7:
+		return mirrorX(mirrorY(transpose(upright)))
+	case 8: // displayed rotated counter-clockwise, so stored clockwise
+		return mirrorX(transpose(upright))
+	}
+	return upright
+}
+
+// gpsSecret is carried in the GPS IFD and must not survive processing.
+const gpsSecret = "GPSLEAK"
+
+// exifSegment returns an APP1 segment holding an EXIF orientation and a GPS
+// IFD with gpsSecret as its processing method.
+func exifSegment(order binary.ByteOrder, orientation int) []byte {
+	tiff := make([]byte, 64)
+	if order == binary.BigEndian {
+		copy(tiff, "MM")
+	} else {
+		copy(tiff, "II")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+
+	entry := func(at int, tag, typ uint16, count, value uint32) {
+		order.PutUint16(tiff[at:], tag)
+		order.PutUint16(tiff[at+2:], typ)
+		order.PutUint32(tiff[at+4:], count)
+		if typ == 3 {
+			order.PutUint16(tiff[at+8:], uint16(value))
+		} else {
+			order.PutUint32(tiff[at+8:], value)
+		}
+	}
+
+	// IFD0 at 8: orientation and the GPS IFD pointer
+	order.PutUint16(tiff[8:], 2)
+	entry(10, 0x0112, 3, 1, uint32(orientation))
+	entry(22, 0x8825, 4, 1, 38)
+	// GPS IFD at 38: GPSProcessingMethod, its value at 56
+	order.PutUint16(tiff[38:], 1)
+	entry(40, 0x001B, 7, uint32(len(gpsSecret)), 56)
+	copy(tiff[56:], gpsSecret)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(2+len(payload)))
+	return append(seg, payload...)
+}
+
+// exifJPEG encodes img as a JPEG with the EXIF segment right after SOI.
+func exifJPEG(t *testing.T, img image.Image, order binary.ByteOrder, orientation int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, exifSegment(order, orientation)...)
+	return append(out, data[2:]...)
+}
+
+// markers returns the markers of the segments before the image data.
+func markers(data []byte) []byte {
+	var ms []byte
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		ms = append(ms, data[i+1])
+		if data[i+1] == 0xDA {
+			break
+		}
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+	}
+	return ms
+}
+
+func near(got color.Color, want color.NRGBA) bool {
+	r, g, b, _ := got.RGBA()
+	d := func(a uint32, b uint8) int {
+		diff := int(a>>8) - int(b)
+		if diff < 0 {
+			diff = -diff
+		}
+		return diff
+	}
+	return d(r, want.R) < 48 && d(g, want.G) < 48 && d(b, want.B) < 48
+}
+
+func TestProcessOrientation(t *testing.T) {
+	const w, h = 64, 32
+	upright := quadrants(w, h)
+	sizes := []Size{{Name: "thumbnail", MaxSide: 16}, {Name: "medium", MaxSide: 32}, {Name: "original"}}
+	wantDims := [][2]int{{16, 8}, {32, 16}, {64, 32}}
+
+	for o := 1; o <= 8; o++ {
+		for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+			name := fmt.Sprintf("%d/%s", o, order)
+			t.Run(name, func(t *testing.T) {
+				data := exifJPEG(t, stored(upright, o), order, o)
+				if got := jpegOrientation(data); got != o {
+					t.Fatalf("jpegOrientation() of the input = %d, want %d", got, o)
+				}
+
+				variants, _, err := Process(bytes.NewReader(data), Limits{MaxWidth: 100, MaxHeight: 100}, sizes)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(variants) != len(sizes) {
+					t.Fatalf("got %d variants, want %d", len(variants), len(sizes))
+				}
+
+				for i, v := range variants {
+					if v.Name != sizes[i].Name || v.ContentType != "image/jpeg" {
+						t.Errorf("variant %d is %q %s", i, v.Name, v.ContentType)
+					}
+					if v.Width != wantDims[i][0] || v.Height != wantDims[i][1] {
+						t.Errorf("%s is %dx%d, want %dx%d", v.Name, v.Width, v.Height, wantDims[i][0], wantDims[i][1])
+					}
+					if bytes.Contains(markers(v.Data), []byte{0xE1}) || bytes.Contains(v.Data, []byte("Exif")) {
+						t.Errorf("%s still has an EXIF segment", v.Name)
+					}
+					if bytes.Contains(v.Data, []byte(gpsSecret)) {
+						t.Errorf("%s still carries the GPS tags", v.Name)
+					}
+
+					img, err := jpeg.Decode(bytes.NewReader(v.Data))
+					if err != nil {
+						t.Fatalf("%s: %v", v.Name, err)
+					}
+					if b := img.Bounds(); b.Dx() != v.Width || b.Dy() != v.Height {
+						t.Errorf("%s decodes as %v, want %dx%d", v.Name, b, v.Width, v.Height)
+					}
+
+					vw, vh := img.Bounds().Dx(), img.Bounds().Dy()
+					corners := []struct {
+						x, y int
+						want color.NRGBA
+					}{
+						{vw / 4, vh / 4, red},
+						{3 * vw / 4, vh / 4, green},
+						{vw / 4, 3 * vh / 4, blue},
+						{3 * vw / 4, 3 * vh / 4, white},
+					}
+					for _, c := range corners {
+						if got := img.At(c.x, c.y); !near(got, c.want) {
+							t.Errorf("%s at %d,%d is %v, want %v", v.Name, c.x, c.y, got, c.want)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.ReadSeeker
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	r.n += n
+	return n, err
+}
+
+// pngHeader returns the signature and IHDR of a w x h PNG, and no pixels.
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], w)
+	binary.BigEndian.PutUint32(ihdr[8:], h)
+	ihdr[12] = 8 // bit depth
+	ihdr[13] = 2 // truecolour
+
+	out := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d")
+	out = append(out, ihdr...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(ihdr))
+}
+
+// hugeJPEG returns the header of a JPEG claiming to be w x h, cut off
+// before the image data ends.
+func hugeJPEG(t *testing.T, w, h uint16) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, solid(8, 8, red), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	sof := bytes.Index(data, []byte{0xFF, 0xC0})
+	if sof < 0 {
+		t.Fatal("no SOF0 segment")
+	}
+	binary.BigEndian.PutUint16(data[sof+5:], h)
+	binary.BigEndian.PutUint16(data[sof+7:], w)
+
+	sos := bytes.Index(data, []byte{0xFF, 0xDA})
+	return data[:sos+4]
+}
+
+func TestProcessLimits(t *testing.T) {
+	var small bytes.Buffer
+	if err := jpeg.Encode(&small, solid(64, 32, red), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	limits := Limits{MaxWidth: 4096, MaxHeight: 4096}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		limits Limits
+		err    error
+	}{
+		{name: "within the limits", data: small.Bytes(), limits: Limits{MaxWidth: 64, MaxHeight: 32}},
+		{name: "too wide", data: small.Bytes(), limits: Limits{MaxWidth: 63, MaxHeight: 32}, err: ErrTooLarge},
+		{name: "too tall", data: small.Bytes(), limits: Limits{MaxWidth: 64, MaxHeight: 31}, err: ErrTooLarge},
+		// full decodes of these would fail on the missing pixels instead
+		{name: "huge png header", data: pngHeader(100000, 100000), limits: limits, err: ErrTooLarge},
+		{name: "huge jpeg header", data: hugeJPEG(t, 60000, 60000), limits: limits, err: ErrTooLarge},
+		{name: "not an image", data: []byte("hello"), limits: limits, err: ErrUnsupportedFormat},
+		{name: "zero size", data: pngHeader(0, 10), limits: limits, err: ErrUnsupportedFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &countingReader{ReadSeeker: bytes.NewReader(tt.data)}
+			_, _, err := Process(r, tt.limits, DefaultSizes)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Process() error = %v, want %v", err, tt.err)
+			}
+			// rejected from the header alone, without reading it twice
+			if tt.err != nil && r.n > len(tt.data) {
+				t.Errorf("read %d bytes of a %d byte image", r.n, len(tt.data))
+			}
+		})
+	}
+}
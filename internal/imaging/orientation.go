@@ -0,0 +1,136 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+)
+
+// EXIF lives in an APP1 segment near the start of the file, and a segment
+// can't be larger than 64KB.
+const exifSearchLen = 128 << 10
+
+func readOrientation(r io.ReadSeeker) (int, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	head, err := io.ReadAll(io.LimitReader(r, exifSearchLen))
+	if err != nil {
+		return 0, err
+	}
+
+	return jpegOrientation(head), nil
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) from a JPEG. It
+// returns 1, meaning "as stored", when there is none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// walk the marker segments up to the start of the image data
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+
+	return 1
+}
+
+// applyOrientation rotates and flips img so it displays upright without
+// the EXIF tag.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+
+	return dst
+}
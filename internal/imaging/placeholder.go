@@ -0,0 +1,192 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+// Placeholder is what clients draw while an image is still loading: a
+// BlurHash (https://blurha.sh) and a single dominant colour as #rrggbb.
+type Placeholder struct {
+	BlurHash      string
+	DominantColor string
+}
+
+// placeholderSide is the size images are shrunk to before summarising
+// them. Both the hash and the colour only describe coarse structure, so
+// looking at every pixel of a large photo would be wasted work.
+const placeholderSide = 64
+
+// NewPlaceholder summarises img for display before it has loaded.
+func NewPlaceholder(img image.Image) Placeholder {
+	small := fit(img, placeholderSide)
+	b := small.Bounds()
+
+	// 4 components along the longer side and 3 along the shorter keep the
+	// hash short while following the image's shape
+	cx, cy := 4, 3
+	if b.Dy() > b.Dx() {
+		cx, cy = 3, 4
+	}
+
+	return Placeholder{
+		BlurHash:      blurHash(small, cx, cy),
+		DominantColor: dominantColor(small),
+	}
+}
+
+// DecodePlaceholder decodes an image, such as a video poster, and
+// summarises it.
+func DecodePlaceholder(r io.Reader) (Placeholder, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return Placeholder{}, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	return NewPlaceholder(img), nil
+}
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// blurHash encodes img with cx by cy cosine components following the
+// reference implementation.
+func blurHash(img image.Image, cx, cy int) string {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// linear RGB of every pixel, read once
+	pixels := make([][3]float64, 0, w*h)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			pixels = append(pixels, [3]float64{sRGBToLinear(c.R), sRGBToLinear(c.G), sRGBToLinear(c.B)})
+		}
+	}
+
+	factors := make([][3]float64, 0, cx*cy)
+	for j := 0; j < cy; j++ {
+		for i := 0; i < cx; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var f [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := math.Cos(math.Pi*float64(i*x)/float64(w)) * math.Cos(math.Pi*float64(j*y)/float64(h))
+					p := pixels[y*w+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+
+			scale := normalisation / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	encode83(&sb, (cx-1)+(cy-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		encode83(&sb, quantisedMax, 1)
+	} else {
+		encode83(&sb, 0, 1)
+	}
+
+	encode83(&sb, linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		encode83(&sb, quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2)
+	}
+
+	return sb.String()
+}
+
+func encode83(sb *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := value / int(math.Pow(83, float64(length-i))) % 83
+		sb.WriteByte(base83Chars[digit])
+	}
+}
+
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// dominantColor buckets pixels by their top four bits per channel and
+// returns the average colour of the fullest bucket. Unlike a plain average
+// this picks a colour that actually appears in the image. Mostly
+// transparent pixels are left out.
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		n       int
+		r, g, b int
+	}
+	buckets := map[int]*bucket{}
+
+	b := img.Bounds()
+	var best *bucket
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 {
+				continue
+			}
+
+			key := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.n++
+			bk.r += int(c.R)
+			bk.g += int(c.G)
+			bk.b += int(c.B)
+
+			if best == nil || bk.n > best.n {
+				best = bk
+			}
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.n, best.g/best.n, best.b/best.n)
+}
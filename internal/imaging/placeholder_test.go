@@ -0,0 +1,94 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func solid(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+// halves is white on the left and black on the right, or the other way
+// round when flipped.
+func halves(w, h int, flipped bool) *image.NRGBA {
+	img := solid(w, h, color.Black)
+	rect := image.Rect(0, 0, w/2, h)
+	if flipped {
+		rect = image.Rect(w/2, 0, w, h)
+	}
+	draw.Draw(img, rect, image.NewUniform(color.White), image.Point{}, draw.Src)
+	return img
+}
+
+// The expected hashes come from a port of the reference encoder. Even flat
+// images have AC components, since the cosines are sampled at whole pixels.
+func TestBlurHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		img    image.Image
+		cx, cy int
+		want   string
+	}{
+		{name: "black", img: solid(8, 6, color.Black), cx: 4, cy: 3, want: "L00000fQfQfQfQfQfQfQfQfQfQfQ"},
+		{name: "white", img: solid(8, 6, color.White), cx: 4, cy: 3, want: "LsTSUA_3fQ_3~qt7fQt7fQfQfQfQ"},
+		{name: "red", img: solid(8, 6, color.NRGBA{R: 255, A: 255}), cx: 4, cy: 3, want: "LsTI:j]9fQ]9|csUfQsUfQfQfQfQ"},
+		{name: "gray", img: solid(8, 6, color.NRGBA{R: 128, G: 128, B: 128, A: 255}), cx: 4, cy: 3, want: "LBEyb[_3fQ_3~qt7fQt7fQfQfQfQ"},
+		{name: "dc only", img: solid(3, 3, color.White), cx: 1, cy: 1, want: "00TSUA"},
+		{
+			name: "offset bounds",
+			img:  solid(8, 6, color.White).SubImage(image.Rect(2, 2, 6, 5)),
+			cx:   4, cy: 3,
+			want: "L~TSUA~qfQ~q~q%MfQ%MfQfQfQfQ",
+		},
+		{name: "white left", img: halves(16, 8, false), cx: 4, cy: 3, want: "L~Lqe9~q%MIU%MxuofWBfQfQfQfQ"},
+		{name: "white right", img: halves(16, 8, true), cx: 4, cy: 3, want: "L~Lqe900IU?b%MRjWBoffQfQfQfQ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := blurHash(tt.img, tt.cx, tt.cy)
+			if got != tt.want {
+				t.Errorf("blurHash() = %q, want %q", got, tt.want)
+			}
+			if want := 6 + 2*(tt.cx*tt.cy-1); len(got) != want {
+				t.Errorf("blurHash() has %d characters, want %d", len(got), want)
+			}
+		})
+	}
+}
+
+func TestNewPlaceholder(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+
+	mostlyRed := solid(100, 50, red)
+	draw.Draw(mostlyRed, image.Rect(0, 0, 20, 50), image.NewUniform(blue), image.Point{}, draw.Src)
+
+	tests := []struct {
+		name     string
+		img      image.Image
+		size     byte
+		dominant string
+	}{
+		{name: "wide", img: mostlyRed, size: 'L', dominant: "#ff0000"},
+		{name: "tall", img: solid(50, 100, blue), size: 'T', dominant: "#0000ff"},
+		{name: "transparent", img: solid(10, 10, color.Transparent), size: 'L', dominant: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPlaceholder(tt.img)
+			if p.BlurHash == "" || p.BlurHash[0] != tt.size {
+				t.Errorf("BlurHash = %q, want it to start with %q", p.BlurHash, tt.size)
+			}
+			if p.DominantColor != tt.dominant {
+				t.Errorf("DominantColor = %q, want %q", p.DominantColor, tt.dominant)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package mention
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxUsernameLength is the most runes a username can have.
+const MaxUsernameLength = 100
+
+// A username is letters, marks, digits, underscores and dots, and doesn't
+// start or end with a dot, so a mention can be followed by a full stop.
+const usernamePattern = `[\p{L}\p{M}\p{N}_](?:[\p{L}\p{M}\p{N}_.]*[\p{L}\p{M}\p{N}_])?`
+
+var usernameRx = regexp.MustCompile(`^` + usernamePattern + `$`)
+
+// The mention has to start the text or follow a character that can't be part
+// of a username or email address. The username runs as far as it can, so a
+// mention never stops inside one.
+var mentionRx = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_@.])@(` + usernamePattern + `)`)
+
+// ValidUsername reports whether s can be a username. Every valid username
+// can be mentioned as a whole.
+func ValidUsername(s string) bool {
+	return utf8.RuneCountInString(s) <= MaxUsernameLength && usernameRx.MatchString(s)
+}
+
+type Mention struct {
+	// UserID is only set on mentions returned by Resolve.
+	UserID   int64  `json:"user_id,omitempty"`
+	Username string `json:"username"`
+	// Start and End are byte offsets of "@username" in the text.
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Parse returns the @username mentions in text, in order of appearance.
+func Parse(text string) []Mention {
+	var mentions []Mention
+	for _, m := range mentionRx.FindAllStringSubmatchIndex(text, -1) {
+		// m[2]:m[3] is the username, the "@" sits right before it
+		username := text[m[2]:m[3]]
+		// too long to be anyone, or the start of an email address
+		if utf8.RuneCountInString(username) > MaxUsernameLength || strings.HasPrefix(text[m[3]:], "@") {
+			continue
+		}
+		mentions = append(mentions, Mention{
+			Username: username,
+			Start:    m[2] - 1,
+			End:      m[3],
+		})
+	}
+	return mentions
+}
+
+// Usernames returns the distinct usernames mentioned in text.
+func Usernames(text string) []string {
+	seen := map[string]bool{}
+	usernames := []string{}
+	for _, m := range Parse(text) {
+		if !seen[m.Username] {
+			seen[m.Username] = true
+			usernames = append(usernames, m.Username)
+		}
+	}
+	return usernames
+}
+
+// Resolve returns the mentions in text of the users in ids, which maps
+// usernames to user IDs. Mentions of anyone else are left out.
+func Resolve(text string, ids map[string]int64) []Mention {
+	mentions := []Mention{}
+	if len(ids) == 0 {
+		return mentions
+	}
+
+	for _, m := range Parse(text) {
+		if id, ok := ids[m.Username]; ok {
+			m.UserID = id
+			mentions = append(mentions, m)
+		}
+	}
+	return mentions
+}
@@ -0,0 +1,179 @@
+package mention
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Mention
+	}{
+		{name: "none", text: "no mentions here"},
+		{name: "start of text", text: "@alice hi", want: []Mention{{Username: "alice", Start: 0, End: 6}}},
+		{name: "after a space", text: "hi @bob_1!", want: []Mention{{Username: "bob_1", Start: 3, End: 9}}},
+		{
+			name: "several",
+			text: "@a, @b and (@c)",
+			want: []Mention{
+				{Username: "a", Start: 0, End: 2},
+				{Username: "b", Start: 4, End: 6},
+				{Username: "c", Start: 12, End: 14},
+			},
+		},
+		{name: "email address", text: "mail bob@example.com"},
+		{name: "after a dot", text: "example.@bob"},
+		{name: "double at", text: "@@bob"},
+		{name: "inside a word", text: "foo@bar"},
+		{name: "bare at", text: "meet @ noon"},
+		{
+			name: "stops at a non word character",
+			text: "@alice's post",
+			want: []Mention{{Username: "alice", Start: 0, End: 6}},
+		},
+		{
+			name: "unicode username",
+			text: "@josé hi",
+			want: []Mention{{Username: "josé", Start: 0, End: 6}},
+		},
+		{
+			name: "combining mark",
+			text: "@jose\u0301",
+			want: []Mention{{Username: "jose\u0301", Start: 0, End: 7}},
+		},
+		{
+			name: "dotted username",
+			text: "cc @john.doe",
+			want: []Mention{{Username: "john.doe", Start: 3, End: 12}},
+		},
+		{
+			name: "full stop after",
+			text: "thanks @john.",
+			want: []Mention{{Username: "john", Start: 7, End: 12}},
+		},
+		{name: "email address after an at", text: "@bob@example.com"},
+		{name: "after a unicode letter", text: "é@bob"},
+		{name: "too long", text: "@" + strings.Repeat("a", MaxUsernameLength+1)},
+		{
+			name: "longest username",
+			text: "@" + strings.Repeat("é", MaxUsernameLength),
+			want: []Mention{{Username: strings.Repeat("é", MaxUsernameLength), Start: 0, End: 1 + 2*MaxUsernameLength}},
+		},
+		{
+			name: "byte offsets after multibyte text",
+			text: "héllo @ana",
+			want: []Mention{{Username: "ana", Start: 7, End: 11}},
+		},
+		{
+			name: "newline before",
+			text: "line\n@ana",
+			want: []Mention{{Username: "ana", Start: 5, End: 9}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+			for _, m := range got {
+				if tt.text[m.Start:m.End] != "@"+m.Username {
+					t.Errorf("Parse(%q): offsets %d:%d cover %q", tt.text, m.Start, m.End, tt.text[m.Start:m.End])
+				}
+			}
+		})
+	}
+}
+
+func TestValidUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		want     bool
+	}{
+		{username: "alice", want: true},
+		{username: "bob_1", want: true},
+		{username: "josé", want: true},
+		{username: "john.doe", want: true},
+		{username: "日本", want: true},
+		{username: "", want: false},
+		{username: ".john", want: false},
+		{username: "john.", want: false},
+		{username: "john doe", want: false},
+		{username: "john-doe", want: false},
+		{username: "bob@example.com", want: false},
+		{username: "@bob", want: false},
+		{username: strings.Repeat("é", MaxUsernameLength), want: true},
+		{username: strings.Repeat("a", MaxUsernameLength+1), want: false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidUsername(tt.username); got != tt.want {
+			t.Errorf("ValidUsername(%q) = %v, want %v", tt.username, got, tt.want)
+		}
+		// every valid username is mentioned as a whole
+		if tt.want {
+			want := []Mention{{Username: tt.username, Start: 0, End: len(tt.username) + 1}}
+			if got := Parse("@" + tt.username); !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", "@"+tt.username, got, want)
+			}
+		}
+	}
+}
+
+func TestUsernames(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "", want: []string{}},
+		{text: "@a @b @a", want: []string{"a", "b"}},
+		{text: "@B @b", want: []string{"B", "b"}},
+	}
+
+	for _, tt := range tests {
+		if got := Usernames(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Usernames(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		ids  map[string]int64
+		want []Mention
+	}{
+		{name: "no users", text: "@a", want: []Mention{}},
+		{
+			name: "known users only",
+			text: "@a @ghost @b",
+			ids:  map[string]int64{"a": 1, "b": 2},
+			want: []Mention{
+				{UserID: 1, Username: "a", Start: 0, End: 2},
+				{UserID: 2, Username: "b", Start: 10, End: 12},
+			},
+		},
+		{
+			name: "repeated mentions",
+			text: "@a @a",
+			ids:  map[string]int64{"a": 1},
+			want: []Mention{
+				{UserID: 1, Username: "a", Start: 0, End: 2},
+				{UserID: 1, Username: "a", Start: 3, End: 5},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Resolve(tt.text, tt.ids); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
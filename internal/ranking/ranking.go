@@ -0,0 +1,195 @@
+// Package ranking orders candidate posts for the "for you" feed.
+//
+// Each post gets a base score from how recent it is, how much engagement it
+// drew and how much the reader interacts with its author, scaled by how the
+// post reached the reader. Posts are then picked best first, with every
+// further post by an author already picked scored down, so a few prolific
+// accounts can't fill the feed.
+package ranking
+
+import (
+	"math"
+	"time"
+)
+
+// Sources, from the closest to the reader to the furthest.
+const (
+	SourceSelf           = "self"
+	SourceFollow         = "follow"
+	SourceTag            = "tag"
+	SourceFollowOfFollow = "follow_of_follow"
+)
+
+// Engagement and affinity grow with diminishing returns; these are the
+// counts at which they are half way to their maximum.
+const (
+	engagementHalf = 10
+	affinityHalf   = 5
+)
+
+type Weights struct {
+	Recency    float64
+	Engagement float64
+	Affinity   float64
+	// HalfLife is the age at which a post's recency has halved.
+	HalfLife time.Duration
+	// CommentWeight is how many reactions a comment counts as.
+	CommentWeight float64
+	// Tag and FollowOfFollow scale the scores of posts from followed tags
+	// and from accounts followed by the accounts the reader follows.
+	Tag            float64
+	FollowOfFollow float64
+	// AuthorDecay multiplies the score of a post once for every post by the
+	// same author ranked above it.
+	AuthorDecay float64
+	// MaxConsecutive is the most posts in a row by one author, unless
+	// nothing else is left. Zero means no limit.
+	MaxConsecutive int
+}
+
+// Signals is what a post is ranked on.
+type Signals struct {
+	AuthorID  int64
+	CreatedAt time.Time
+	Comments  int
+	Reactions int
+	// Interactions counts the reader's recent comments and reactions on
+	// the author's posts and mentions of the author.
+	Interactions int
+	Source       string
+}
+
+// Explanation breaks a post's score down.
+type Explanation struct {
+	Score           float64 `json:"score"`
+	BaseScore       float64 `json:"base_score"`
+	Recency         float64 `json:"recency"`
+	Engagement      float64 `json:"engagement"`
+	Affinity        float64 `json:"affinity"`
+	Source          string  `json:"source"`
+	SourceFactor    float64 `json:"source_factor"`
+	DiversityFactor float64 `json:"diversity_factor"`
+	AgeSeconds      int64   `json:"age_seconds"`
+}
+
+// Ranked is a post's place in a ranking: Index is its position in the
+// slice passed to Rank.
+type Ranked struct {
+	Index       int
+	Explanation Explanation
+}
+
+// Score explains the base score of a post, before diversity is taken into
+// account.
+func Score(s Signals, w Weights, now time.Time) Explanation {
+	age := now.Sub(s.CreatedAt)
+	if age < 0 {
+		age = 0
+	}
+
+	e := Explanation{
+		Source:          s.Source,
+		SourceFactor:    w.sourceFactor(s.Source),
+		DiversityFactor: 1,
+		AgeSeconds:      int64(age.Seconds()),
+	}
+
+	e.Recency = 1
+	if w.HalfLife > 0 {
+		e.Recency = math.Exp2(-age.Seconds() / w.HalfLife.Seconds())
+	}
+	e.Engagement = saturate(float64(s.Comments)*w.CommentWeight+float64(s.Reactions), engagementHalf)
+	e.Affinity = saturate(float64(s.Interactions), affinityHalf)
+
+	e.BaseScore = (w.Recency*e.Recency + w.Engagement*e.Engagement + w.Affinity*e.Affinity) * e.SourceFactor
+	e.Score = e.BaseScore
+
+	return e
+}
+
+// Rank orders posts best first.
+func Rank(items []Signals, w Weights, now time.Time) []Ranked {
+	scored := make([]Explanation, len(items))
+	for i, s := range items {
+		scored[i] = Score(s, w, now)
+	}
+
+	ranked := make([]Ranked, 0, len(items))
+	picked := make([]bool, len(items))
+	perAuthor := map[int64]int{}
+	var lastAuthor int64
+	run := 0
+
+	for len(ranked) < len(items) {
+		best, fallback := -1, -1
+		var bestScore, fallbackScore float64
+
+		for i, s := range items {
+			if picked[i] {
+				continue
+			}
+
+			score := scored[i].BaseScore * math.Pow(w.AuthorDecay, float64(perAuthor[s.AuthorID]))
+
+			if w.MaxConsecutive > 0 && s.AuthorID == lastAuthor && run >= w.MaxConsecutive {
+				if fallback < 0 || better(items, i, score, fallback, fallbackScore) {
+					fallback, fallbackScore = i, score
+				}
+				continue
+			}
+			if best < 0 || better(items, i, score, best, bestScore) {
+				best, bestScore = i, score
+			}
+		}
+
+		if best < 0 {
+			best, bestScore = fallback, fallbackScore
+		}
+
+		e := scored[best]
+		e.Score = bestScore
+		if e.BaseScore > 0 {
+			e.DiversityFactor = bestScore / e.BaseScore
+		}
+		ranked = append(ranked, Ranked{Index: best, Explanation: e})
+
+		picked[best] = true
+		author := items[best].AuthorID
+		perAuthor[author]++
+		if author == lastAuthor {
+			run++
+		} else {
+			lastAuthor, run = author, 1
+		}
+	}
+
+	return ranked
+}
+
+// better reports whether item i with score beats item j with jScore. Ties
+// go to the newer post.
+func better(items []Signals, i int, score float64, j int, jScore float64) bool {
+	if score != jScore {
+		return score > jScore
+	}
+	return items[i].CreatedAt.After(items[j].CreatedAt)
+}
+
+func (w Weights) sourceFactor(source string) float64 {
+	switch source {
+	case SourceTag:
+		return w.Tag
+	case SourceFollowOfFollow:
+		return w.FollowOfFollow
+	default:
+		return 1
+	}
+}
+
+// saturate maps a count onto [0, 1), reaching 0.5 at half.
+func saturate(x, half float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return x / (x + half)
+}
@@ -0,0 +1,205 @@
+package ranking
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+var weights = Weights{
+	Recency:        1,
+	Engagement:     1,
+	Affinity:       1,
+	HalfLife:       time.Hour,
+	CommentWeight:  2,
+	Tag:            0.5,
+	FollowOfFollow: 0.25,
+	AuthorDecay:    0.5,
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name       string
+		s          Signals
+		w          Weights
+		recency    float64
+		engagement float64
+		affinity   float64
+		base       float64
+	}{
+		{
+			name:    "brand new",
+			s:       Signals{CreatedAt: now, Source: SourceFollow},
+			w:       weights,
+			recency: 1, base: 1,
+		},
+		{
+			name:    "one half life old",
+			s:       Signals{CreatedAt: now.Add(-time.Hour), Source: SourceFollow},
+			w:       weights,
+			recency: 0.5, base: 0.5,
+		},
+		{
+			name:    "from the future",
+			s:       Signals{CreatedAt: now.Add(time.Hour), Source: SourceFollow},
+			w:       weights,
+			recency: 1, base: 1,
+		},
+		{
+			name:    "no half life",
+			s:       Signals{CreatedAt: now.Add(-24 * time.Hour), Source: SourceSelf},
+			w:       Weights{Recency: 1},
+			recency: 1, base: 1,
+		},
+		{
+			name:       "comments count double",
+			s:          Signals{CreatedAt: now, Comments: 3, Reactions: 4, Source: SourceFollow},
+			w:          weights,
+			recency:    1,
+			engagement: 0.5,
+			base:       1.5,
+		},
+		{
+			name:     "affinity half way",
+			s:        Signals{CreatedAt: now, Interactions: 5, Source: SourceFollow},
+			w:        weights,
+			recency:  1,
+			affinity: 0.5,
+			base:     1.5,
+		},
+		{
+			name:    "followed tag",
+			s:       Signals{CreatedAt: now, Source: SourceTag},
+			w:       weights,
+			recency: 1, base: 0.5,
+		},
+		{
+			name:    "follow of follow",
+			s:       Signals{CreatedAt: now, Source: SourceFollowOfFollow},
+			w:       weights,
+			recency: 1, base: 0.25,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Score(tt.s, tt.w, now)
+			if !approx(e.Recency, tt.recency) || !approx(e.Engagement, tt.engagement) || !approx(e.Affinity, tt.affinity) {
+				t.Errorf("recency, engagement, affinity = %v, %v, %v, want %v, %v, %v",
+					e.Recency, e.Engagement, e.Affinity, tt.recency, tt.engagement, tt.affinity)
+			}
+			if !approx(e.BaseScore, tt.base) || e.Score != e.BaseScore {
+				t.Errorf("score = %v, base %v, want %v", e.Score, e.BaseScore, tt.base)
+			}
+			if e.DiversityFactor != 1 || e.Source != tt.s.Source {
+				t.Errorf("diversity %v, source %q", e.DiversityFactor, e.Source)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	post := func(author int64, age time.Duration, reactions int) Signals {
+		return Signals{AuthorID: author, CreatedAt: now.Add(-age), Reactions: reactions, Source: SourceFollow}
+	}
+
+	noDecay := weights
+	noDecay.AuthorDecay = 1
+
+	runs := noDecay
+	runs.MaxConsecutive = 2
+
+	tests := []struct {
+		name  string
+		items []Signals
+		w     Weights
+		want  []int
+	}{
+		{name: "empty", w: weights, want: []int{}},
+		{
+			name:  "by score",
+			items: []Signals{post(1, 2*time.Hour, 0), post(2, 0, 0), post(3, time.Hour, 0)},
+			w:     weights,
+			want:  []int{1, 2, 0},
+		},
+		{
+			name:  "engagement beats age",
+			items: []Signals{post(1, 0, 0), post(2, time.Hour, 40)},
+			w:     weights,
+			want:  []int{1, 0},
+		},
+		{
+			name:  "ties go to the newer post",
+			items: []Signals{post(1, 2*time.Hour, 0), post(2, time.Hour, 0)},
+			w:     Weights{Engagement: 1},
+			want:  []int{1, 0},
+		},
+		{
+			name:  "later posts by the same author decay",
+			items: []Signals{post(1, 0, 0), post(1, time.Minute, 0), post(2, 30*time.Minute, 0)},
+			w:     weights,
+			want:  []int{0, 2, 1},
+		},
+		{
+			name:  "no decay",
+			items: []Signals{post(1, 0, 0), post(1, time.Minute, 0), post(2, 30*time.Minute, 0)},
+			w:     noDecay,
+			want:  []int{0, 1, 2},
+		},
+		{
+			name:  "runs are broken up",
+			items: []Signals{post(1, 0, 0), post(1, time.Minute, 0), post(1, 2*time.Minute, 0), post(2, 3*time.Hour, 0)},
+			w:     runs,
+			want:  []int{0, 1, 3, 2},
+		},
+		{
+			name:  "runs go on when nothing else is left",
+			items: []Signals{post(1, 0, 0), post(1, time.Minute, 0), post(1, 2*time.Minute, 0)},
+			w:     runs,
+			want:  []int{0, 1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked := Rank(tt.items, tt.w, now)
+
+			got := []int{}
+			for _, r := range ranked {
+				got = append(got, r.Index)
+				e := r.Explanation
+				if e.BaseScore > 0 && !approx(e.Score, e.BaseScore*e.DiversityFactor) {
+					t.Errorf("item %d: score %v isn't base %v times diversity %v", r.Index, e.Score, e.BaseScore, e.DiversityFactor)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rank() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankDiversityFactor(t *testing.T) {
+	items := []Signals{
+		{AuthorID: 1, CreatedAt: now, Source: SourceFollow},
+		{AuthorID: 1, CreatedAt: now, Source: SourceFollow},
+		{AuthorID: 1, CreatedAt: now, Source: SourceFollow},
+	}
+
+	var factors []float64
+	for _, r := range Rank(items, weights, now) {
+		factors = append(factors, r.Explanation.DiversityFactor)
+	}
+
+	want := []float64{1, 0.5, 0.25}
+	if !reflect.DeepEqual(factors, want) {
+		t.Errorf("diversity factors = %v, want %v", factors, want)
+	}
+}
@@ -0,0 +1,211 @@
+// Package search turns what users type into a search box into Postgres
+// full-text queries and renders the highlighted snippets Postgres returns.
+//
+// A query is a list of words, all of which have to match. On top of that:
+//
+//	"exact phrase"  the words in this order, next to each other
+//	gopher*         words starting with gopher
+//	-java           leave out matches containing java
+//	go OR rust      either side
+//
+// OR binds loosest, so "a b OR c" finds matches with both a and b, or c.
+// Everything other than letters and digits separates words, so nothing a
+// user types can change the structure of the query.
+package search
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Config is the text search configuration queries and documents are
+// stemmed with. It has to match the one the search columns are built with.
+const Config = "english"
+
+var (
+	ErrEmptyQuery   = errors.New("search query has no words to search for")
+	ErrOnlyExcluded = errors.New("search query needs a word that isn't excluded")
+	ErrTooManyTerms = errors.New("search query has too many words")
+)
+
+// maxTerms bounds the number of words in a query.
+const maxTerms = 20
+
+// Parse translates a search query into the text of a tsquery, for
+// to_tsquery with Config.
+func Parse(q string) (string, error) {
+	var (
+		clauses [][]string
+		clause  []string
+		// positive reports whether the clause has a word that isn't excluded
+		positive bool
+		terms    int
+	)
+
+	closeClause := func() error {
+		if len(clause) == 0 {
+			return nil
+		}
+		if !positive {
+			return ErrOnlyExcluded
+		}
+		clauses = append(clauses, clause)
+		clause, positive = nil, false
+		return nil
+	}
+
+	for _, tok := range tokenize(q) {
+		if tok.text == "OR" && !tok.phrase && !tok.negated && !tok.prefix {
+			if err := closeClause(); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		words := splitWords(tok.text)
+		if len(words) == 0 {
+			continue
+		}
+		terms += len(words)
+		if terms > maxTerms {
+			return "", ErrTooManyTerms
+		}
+
+		for i, w := range words {
+			words[i] = quote(w)
+		}
+		if tok.prefix {
+			words[len(words)-1] += ":*"
+		}
+
+		term := strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			term = "(" + term + ")"
+		}
+		if tok.negated {
+			term = "!" + term
+		} else {
+			positive = true
+		}
+		clause = append(clause, term)
+	}
+	if err := closeClause(); err != nil {
+		return "", err
+	}
+
+	if len(clauses) == 0 {
+		return "", ErrEmptyQuery
+	}
+
+	parts := make([]string, len(clauses))
+	for i, c := range clauses {
+		parts[i] = strings.Join(c, " & ")
+		if len(clauses) > 1 && len(c) > 1 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+
+	return strings.Join(parts, " | "), nil
+}
+
+type token struct {
+	text    string
+	phrase  bool
+	negated bool
+	prefix  bool
+}
+
+// tokenize splits a query on white space, keeping quoted phrases together.
+// An unterminated quote runs to the end of the query.
+func tokenize(q string) []token {
+	var tokens []token
+	runes := []rune(q)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var tok token
+		if runes[i] == '-' {
+			tok.negated = true
+			i++
+		}
+
+		start := i
+		if i < len(runes) && runes[i] == '"' {
+			tok.phrase = true
+			start = i + 1
+			i = start
+			for i < len(runes) && runes[i] != '"' {
+				i++
+			}
+			tok.text = string(runes[start:i])
+			if i < len(runes) {
+				i++
+			}
+		} else {
+			for i < len(runes) && !unicode.IsSpace(runes[i]) {
+				i++
+			}
+			tok.text = string(runes[start:i])
+		}
+
+		if !tok.phrase && strings.HasSuffix(tok.text, "*") {
+			tok.prefix = true
+		}
+
+		tokens = append(tokens, tok)
+	}
+
+	return tokens
+}
+
+// splitWords returns the runs of letters and digits in s, lower cased.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// quote makes w a tsquery lexeme. Words only hold letters and digits, so
+// there is nothing to escape.
+func quote(w string) string {
+	return "'" + w + "'"
+}
+
+// Postgres marks matches in snippets with these private use characters.
+// Highlight turns them into HTML once the rest is escaped.
+const (
+	startSel = "\uE000"
+	stopSel  = "\uE001"
+)
+
+// Markers holds the characters matches are marked with. Queries translate
+// them away in the text they highlight, so a post can't fake a match.
+const Markers = startSel + stopSel
+
+// HeadlineOptions returns the ts_headline options for a snippet of about
+// maxWords words, in up to fragments pieces. With no fragments, the
+// snippet is the whole text.
+func HeadlineOptions(maxWords, fragments int) string {
+	if fragments == 0 {
+		return fmt.Sprintf(`StartSel="%s", StopSel="%s", HighlightAll=true`, startSel, stopSel)
+	}
+	return fmt.Sprintf(
+		`StartSel="%s", StopSel="%s", MaxWords=%d, MinWords=%d, MaxFragments=%d, FragmentDelimiter=" … "`,
+		startSel, stopSel, maxWords, max(maxWords/3, 1), fragments,
+	)
+}
+
+// Highlight turns a snippet returned by ts_headline into HTML, with the
+// matches wrapped in <mark>.
+func Highlight(snippet string) string {
+	s := html.EscapeString(snippet)
+	s = strings.ReplaceAll(s, startSel, "<mark>")
+	return strings.ReplaceAll(s, stopSel, "</mark>")
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+		err  error
+	}{
+		{q: "go", want: "'go'"},
+		{q: "Go  Rust", want: "'go' & 'rust'"},
+		{q: `"exact phrase"`, want: "('exact' <-> 'phrase')"},
+		{q: `"unterminated phrase`, want: "('unterminated' <-> 'phrase')"},
+		{q: "gopher*", want: "'gopher':*"},
+		{q: `"no prefix"*`, want: "('no' <-> 'prefix')"},
+		{q: "go -java", want: "'go' & !'java'"},
+		{q: `-"bad phrase" good`, want: "!('bad' <-> 'phrase') & 'good'"},
+		{q: "go OR rust", want: "'go' | 'rust'"},
+		{q: "a b OR c", want: "('a' & 'b') | 'c'"},
+		{q: "go or rust", want: "'go' & 'or' & 'rust'"},
+		{q: "-OR go", want: "!'or' & 'go'"},
+		{q: "OR go OR", want: "'go'"},
+		{q: "node.js", want: "('node' <-> 'js')"},
+		{q: "node.js*", want: "('node' <-> 'js':*)"},
+		{q: "Café 日本語", want: "'café' & '日本語'"},
+
+		// tsquery syntax is only ever separators
+		{q: "go' | !x", want: "'go' & 'x'"},
+		{q: "'; DROP TABLE posts; --", want: "'drop' & 'table' & 'posts'"},
+		{q: "(a | b) & !c <-> d", want: "'a' & 'b' & 'c' & 'd'"},
+		{q: "a:A & b:*", want: "('a' <-> 'a') & 'b':*"},
+		{q: `it\'s`, want: "('it' <-> 's')"},
+		{q: "go", want: "'go'"},
+
+		{q: "", err: ErrEmptyQuery},
+		{q: `  * - "" & | ! `, err: ErrEmptyQuery},
+		{q: "OR", err: ErrEmptyQuery},
+		{q: "-java", err: ErrOnlyExcluded},
+		{q: "go OR -java", err: ErrOnlyExcluded},
+		{q: strings.Repeat("a ", maxTerms), want: strings.TrimSuffix(strings.Repeat("'a' & ", maxTerms), " & ")},
+		{q: strings.Repeat("a ", maxTerms+1), err: ErrTooManyTerms},
+		{q: `"` + strings.Repeat("a ", maxTerms+1) + `"`, err: ErrTooManyTerms},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.q)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.q, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		snippet string
+		want    string
+	}{
+		{snippet: "", want: ""},
+		{snippet: "no matches", want: "no matches"},
+		{snippet: "learn " + startSel + "go" + stopSel + " today", want: "learn <mark>go</mark> today"},
+		{snippet: startSel + "a" + stopSel + " … " + startSel + "b" + stopSel, want: "<mark>a</mark> … <mark>b</mark>"},
+		{snippet: `<script>alert("x")</script>`, want: "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;"},
+		{snippet: "<mark>fake</mark> " + startSel + "real" + stopSel, want: "&lt;mark&gt;fake&lt;/mark&gt; <mark>real</mark>"},
+		{snippet: startSel + "<b>&amp;" + stopSel, want: "<mark>&lt;b&gt;&amp;amp;</mark>"},
+	}
+
+	for _, tt := range tests {
+		if got := Highlight(tt.snippet); got != tt.want {
+			t.Errorf("Highlight(%q) = %q, want %q", tt.snippet, got, tt.want)
+		}
+	}
+}
+
+func TestHeadlineOptions(t *testing.T) {
+	tests := []struct {
+		maxWords, fragments int
+		want                string
+	}{
+		{maxWords: 30, fragments: 0, want: `StartSel="` + startSel + `", StopSel="` + stopSel + `", HighlightAll=true`},
+		{maxWords: 30, fragments: 2, want: `StartSel="` + startSel + `", StopSel="` + stopSel + `", MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=" … "`},
+		{maxWords: 2, fragments: 1, want: `StartSel="` + startSel + `", StopSel="` + stopSel + `", MaxWords=2, MinWords=1, MaxFragments=1, FragmentDelimiter=" … "`},
+	}
+
+	for _, tt := range tests {
+		if got := HeadlineOptions(tt.maxWords, tt.fragments); got != tt.want {
+			t.Errorf("HeadlineOptions(%d, %d) = %q, want %q", tt.maxWords, tt.fragments, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block stops blockedID from reaching blockerID. Mentions of the blocker
+// already made by the blocked user are removed along with it.
+func (s *BlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)`
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok {
+				switch pqErr.Code {
+				case "23505":
+					return ErrConflict
+				case "23503":
+					return ErrNotFound
+				}
+			}
+			return err
+		}
+
+		query = `
+			DELETE FROM post_mentions m USING posts p
+			WHERE m.post_id = p.id AND m.user_id = $1 AND p.user_id = $2
+		`
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM comment_mentions m USING comments c
+			WHERE m.comment_id = c.id AND m.user_id = $1 AND c.user_id = $2
+		`
+		_, err := tx.ExecContext(ctx, query, blockerID, blockedID)
+
+		return err
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	query := `
+		DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, blockerID, blockedID)
+
+	return err
+}
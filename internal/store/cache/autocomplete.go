@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+// Suggestions depend on who the user follows, so they are cached per user.
+// They aren't invalidated; follows show up once they expire.
+const AutocompleteExpTime = time.Minute
+
+type AutocompleteStore struct {
+	rdb *redis.Client
+}
+
+func autocompleteKey(userID int64, query string, limit int) string {
+	return fmt.Sprintf("autocomplete-%d-%d-%s", userID, limit, query)
+}
+
+// Get returns the suggestions cached for the query, or nil.
+func (s *AutocompleteStore) Get(ctx context.Context, userID int64, query string, limit int) (*store.Suggestions, error) {
+	data, err := s.rdb.Get(ctx, autocompleteKey(userID, query, limit)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var sg store.Suggestions
+	if err := json.Unmarshal(data, &sg); err != nil {
+		return nil, err
+	}
+
+	return &sg, nil
+}
+
+func (s *AutocompleteStore) Set(ctx context.Context, userID int64, query string, limit int, sg *store.Suggestions) error {
+	data, err := json.Marshal(sg)
+	if err != nil {
+		return err
+	}
+
+	return s.rdb.SetEX(ctx, autocompleteKey(userID, query, limit), data, AutocompleteExpTime).Err()
+}
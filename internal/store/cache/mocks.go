@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/supremed3v/social-media/internal/store"
@@ -9,7 +10,9 @@ import (
 
 func NewMockStore() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:        &MockUserStore{},
+		Timelines:    &MockTimelineStore{},
+		Autocomplete: &MockAutocompleteStore{},
 	}
 }
 
@@ -29,3 +32,45 @@ func (m *MockUserStore) Set(ctx context.Context, user *store.User) error {
 func (m *MockUserStore) Delete(ctx context.Context, userID int64) {
 	m.Called(userID)
 }
+
+type MockTimelineStore struct {
+	mock.Mock
+}
+
+func (m *MockTimelineStore) Get(ctx context.Context, userID int64) (*Timeline, error) {
+	args := m.Called(userID)
+	return nil, args.Error(1)
+}
+
+func (m *MockTimelineStore) StartBuild(ctx context.Context, userID int64) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+func (m *MockTimelineStore) Set(ctx context.Context, userID int64, entries []store.TimelineEntry, complete bool) error {
+	args := m.Called(userID, entries, complete)
+	return args.Error(0)
+}
+
+func (m *MockTimelineStore) Push(ctx context.Context, userIDs []int64, postID int64, createdAt time.Time) error {
+	args := m.Called(userIDs, postID, createdAt)
+	return args.Error(0)
+}
+
+func (m *MockTimelineStore) Delete(ctx context.Context, userID int64) {
+	m.Called(userID)
+}
+
+type MockAutocompleteStore struct {
+	mock.Mock
+}
+
+func (m *MockAutocompleteStore) Get(ctx context.Context, userID int64, query string, limit int) (*store.Suggestions, error) {
+	args := m.Called(userID, query, limit)
+	return nil, args.Error(1)
+}
+
+func (m *MockAutocompleteStore) Set(ctx context.Context, userID int64, query string, limit int, sg *store.Suggestions) error {
+	args := m.Called(userID, query, limit, sg)
+	return args.Error(0)
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/supremed3v/social-media/internal/store"
@@ -13,10 +14,23 @@ type Storage struct {
 		Set(context.Context, *store.User) error
 		Delete(context.Context, int64)
 	}
+	Timelines interface {
+		Get(ctx context.Context, userID int64) (*Timeline, error)
+		StartBuild(ctx context.Context, userID int64) error
+		Set(ctx context.Context, userID int64, entries []store.TimelineEntry, complete bool) error
+		Push(ctx context.Context, userIDs []int64, postID int64, createdAt time.Time) error
+		Delete(ctx context.Context, userID int64)
+	}
+	Autocomplete interface {
+		Get(ctx context.Context, userID int64, query string, limit int) (*store.Suggestions, error)
+		Set(ctx context.Context, userID int64, query string, limit int, sg *store.Suggestions) error
+	}
 }
 
 func NewRedisStorage(rdb *redis.Client) Storage {
 	return Storage{
-		Users: &UserStore{rdb: rdb},
+		Users:        &UserStore{rdb: rdb},
+		Timelines:    &TimelineStore{rdb: rdb},
+		Autocomplete: &AutocompleteStore{rdb: rdb},
 	}
 }
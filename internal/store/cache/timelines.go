@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/supremed3v/social-media/internal/store"
+)
+
+const (
+	// TimelineMaxLength is how many posts a cached timeline keeps. Older
+	// ones are dropped as new ones come in.
+	TimelineMaxLength = 800
+	TimelineExpTime   = 24 * time.Hour
+	// TimelineBuildTime bounds how long building a timeline may take
+	// before the posts pushed meanwhile are given up on.
+	TimelineBuildTime = time.Minute
+)
+
+// timelineEnd is kept below the oldest post of a timeline holding every
+// post the user has, so readers know there is nothing further back. It is
+// the first thing trimmed once the timeline fills up.
+const timelineEnd = "end"
+
+// pushTimeline adds a post to a timeline that is already cached and trims
+// it to length. A post for a timeline that is being built is kept on the
+// side until the timeline is stored. Other missing timelines are left
+// alone; they are built whole when next read.
+var pushTimeline = `
+local key = KEYS[1]
+if redis.call('EXISTS', key) == 0 then
+	if redis.call('EXISTS', KEYS[2]) == 0 then
+		return 0
+	end
+	key = KEYS[3]
+end
+redis.call('ZADD', key, ARGV[1], ARGV[2])
+redis.call('ZREMRANGEBYRANK', key, 0, -(tonumber(ARGV[3]) + 1))
+if key == KEYS[3] then
+	redis.call('EXPIRE', key, ARGV[4])
+end
+return 0
+`
+
+// setTimeline stores a timeline that was built, given as score and member
+// pairs after the length and expiry, together with the posts pushed while
+// it was being built. It does nothing when another build got there first
+// or the timeline was dropped in the meantime, since the posts read might
+// be out of date.
+var setTimeline = `
+if redis.call('EXISTS', KEYS[3]) == 0 or redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+for i = 3, #ARGV, 2 do
+	redis.call('ZADD', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+redis.call('ZUNIONSTORE', KEYS[1], 2, KEYS[1], KEYS[2], 'AGGREGATE', 'MAX')
+redis.call('ZREMRANGEBYRANK', KEYS[1], 0, -(tonumber(ARGV[1]) + 1))
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+redis.call('DEL', KEYS[2], KEYS[3])
+return 1
+`
+
+// Timeline is a user's cached home timeline, newest post first.
+type Timeline struct {
+	Entries []store.TimelineEntry
+	// Oldest is when the oldest post in the timeline was created.
+	Oldest time.Time
+	// Truncated is set when older posts were dropped from the timeline.
+	Truncated bool
+}
+
+type TimelineStore struct {
+	rdb *redis.Client
+}
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-%d", userID)
+}
+
+// timelineBuildingKey is set while the user's timeline is being built, and
+// timelinePendingKey holds the posts pushed to it meanwhile.
+func timelineBuildingKey(userID int64) string {
+	return fmt.Sprintf("timeline-%d-building", userID)
+}
+
+func timelinePendingKey(userID int64) string {
+	return fmt.Sprintf("timeline-%d-pending", userID)
+}
+
+func timelineScore(t time.Time) float64 {
+	return float64(t.UnixMicro())
+}
+
+// Get returns the user's timeline, or nil if it isn't cached.
+func (s *TimelineStore) Get(ctx context.Context, userID int64) (*Timeline, error) {
+	key := timelineKey(userID)
+
+	members, err := s.rdb.ZRevRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	// reading a timeline keeps it around
+	if err := s.rdb.Expire(ctx, key, TimelineExpTime).Err(); err != nil {
+		return nil, err
+	}
+
+	timeline := &Timeline{Truncated: true}
+	for _, m := range members {
+		member, _ := m.Member.(string)
+		if member == timelineEnd {
+			timeline.Truncated = false
+			continue
+		}
+
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		createdAt := time.UnixMicro(int64(m.Score))
+		timeline.Entries = append(timeline.Entries, store.TimelineEntry{PostID: id, CreatedAt: createdAt})
+		timeline.Oldest = createdAt
+	}
+
+	return timeline, nil
+}
+
+// StartBuild marks the user's timeline as being built, so posts pushed to
+// it from now on are kept for Set. Call it before reading the entries.
+func (s *TimelineStore) StartBuild(ctx context.Context, userID int64) error {
+	return s.rdb.Set(ctx, timelineBuildingKey(userID), 1, TimelineBuildTime).Err()
+}
+
+// Set stores the user's timeline built from entries, newest first, along
+// with the posts pushed since StartBuild. complete says whether entries
+// are all the posts the user has. A timeline that was stored or dropped
+// since StartBuild is left as it is.
+func (s *TimelineStore) Set(ctx context.Context, userID int64, entries []store.TimelineEntry, complete bool) error {
+	if len(entries) > TimelineMaxLength {
+		entries = entries[:TimelineMaxLength]
+		complete = false
+	}
+
+	args := make([]any, 0, 2*len(entries)+4)
+	args = append(args, TimelineMaxLength, int(TimelineExpTime.Seconds()))
+	for _, e := range entries {
+		args = append(args, timelineScore(e.CreatedAt), e.PostID)
+	}
+	if complete {
+		args = append(args, "-inf", timelineEnd)
+	}
+
+	keys := []string{timelineKey(userID), timelinePendingKey(userID), timelineBuildingKey(userID)}
+	return s.rdb.Eval(ctx, setTimeline, keys, args...).Err()
+}
+
+// Push adds a post to the cached timelines of userIDs.
+func (s *TimelineStore) Push(ctx context.Context, userIDs []int64, postID int64, createdAt time.Time) error {
+	score := timelineScore(createdAt)
+
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range userIDs {
+			keys := []string{timelineKey(id), timelineBuildingKey(id), timelinePendingKey(id)}
+			pipe.Eval(ctx, pushTimeline, keys, score, postID, TimelineMaxLength, int(TimelineBuildTime.Seconds()))
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Delete drops the user's timeline, so it is built again when next read.
+// A build under way is abandoned.
+func (s *TimelineStore) Delete(ctx context.Context, userID int64) {
+	s.rdb.Del(ctx, timelineKey(userID), timelineBuildingKey(userID), timelinePendingKey(userID))
+}
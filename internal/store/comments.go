@@ -3,15 +3,18 @@ package store
 import (
 	"context"
 	"database/sql"
+
+	"github.com/supremed3v/social-media/internal/mention"
 )
 
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"createdAt"`
-	User      User   `json:"user"`
+	ID        int64             `json:"id"`
+	PostID    int64             `json:"post_id"`
+	UserID    int64             `json:"user_id"`
+	Content   string            `json:"content"`
+	Mentions  []mention.Mention `json:"mentions"`
+	CreatedAt string            `json:"createdAt"`
+	User      User              `json:"user"`
 }
 
 type CommentStore struct {
@@ -64,13 +67,20 @@ func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 	defer cancel()
 
 	// Insert the comment and get the ID and createdAt
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		comment.PostID,
-		comment.UserID,
-		comment.Content,
-	).Scan(&comment.ID, &comment.CreatedAt)
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			comment.PostID,
+			comment.UserID,
+			comment.Content,
+		).Scan(&comment.ID, &comment.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		return setCommentMentions(ctx, tx, comment)
+	})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a list of posts ordered by (created_at, id).
+// Clients get it as an opaque string and hand it back to continue from
+// there, which unlike an offset stays put when new posts come in.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int64     `json:"id"`
+	// Prev means the page before the position is wanted, not the one
+	// after it.
+	Prev bool `json:"p,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 || c.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// PageInfo holds the cursors of the pages around the one returned. They are
+// empty at either end of the list.
+type PageInfo struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// direction is the SQL sort order for fq.Sort. Never concatenate Sort
+// itself into a query.
+func (fq PaginatedFeedQuery) direction() string {
+	if fq.Sort == "asc" {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// keyset returns the condition and ORDER BY clause for a page of posts
+// aliased as p, with the cursor's time and id going into the tArg and
+// idArg placeholders (see keysetArgs). Pages before a cursor are read in
+// reverse and put back in order by paginate.
+func (fq PaginatedFeedQuery) keyset(p, tArg, idArg string) (cond, order string) {
+	dir := fq.direction()
+	if fq.Cursor != nil && fq.Cursor.Prev {
+		dir = map[string]string{"ASC": "DESC", "DESC": "ASC"}[dir]
+	}
+
+	cmp := "<"
+	if dir == "ASC" {
+		cmp = ">"
+	}
+
+	// without a cursor both arguments are NULL and the condition folds away
+	cond = fmt.Sprintf(
+		"(%[3]s::timestamptz IS NULL OR (%[1]s.createdat, %[1]s.id) %[2]s (%[3]s::timestamptz, %[4]s::bigint))",
+		p, cmp, tArg, idArg,
+	)
+	order = fmt.Sprintf("%[1]s.createdat %[2]s, %[1]s.id %[2]s", p, dir)
+
+	return cond, order
+}
+
+// keysetArgs returns the values for keyset's placeholders.
+func (fq PaginatedFeedQuery) keysetArgs() (any, any) {
+	if fq.Cursor == nil {
+		return nil, nil
+	}
+	return fq.Cursor.CreatedAt, fq.Cursor.ID
+}
+
+// offset is the OFFSET for the page, which only applies without a cursor.
+func (fq PaginatedFeedQuery) offset() int {
+	if fq.Cursor != nil {
+		return 0
+	}
+	return fq.Offset
+}
+
+// paginate trims posts read with a limit of fq.Limit+1 to the page and
+// works out the cursors next to it.
+func paginate(fq PaginatedFeedQuery, posts []PostWithMetadata) ([]PostWithMetadata, PageInfo, error) {
+	var page PageInfo
+
+	more := len(posts) > fq.Limit
+	if more {
+		posts = posts[:fq.Limit]
+	}
+
+	backwards := fq.Cursor != nil && fq.Cursor.Prev
+	if backwards {
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
+
+	if len(posts) == 0 {
+		return posts, page, nil
+	}
+
+	first, err := cursorAt(posts[0], true)
+	if err != nil {
+		return nil, page, err
+	}
+	last, err := cursorAt(posts[len(posts)-1], false)
+	if err != nil {
+		return nil, page, err
+	}
+
+	// there is a page after this one if more were read going forwards, or
+	// if this one was reached going backwards; the other way round for the
+	// page before
+	if (!backwards && more) || backwards {
+		page.Next = last
+	}
+	if (backwards && more) || (!backwards && (fq.Cursor != nil || fq.Offset > 0)) {
+		page.Prev = first
+	}
+
+	return posts, page, nil
+}
+
+func cursorAt(p PostWithMetadata, prev bool) (string, error) {
+	t, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+	if err != nil {
+		return "", err
+	}
+	return Cursor{CreatedAt: t, ID: p.ID, Prev: prev}.Encode(), nil
+}
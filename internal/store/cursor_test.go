@@ -0,0 +1,186 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 678900000, time.UTC)
+
+	tests := []struct {
+		name string
+		s    string
+		want *Cursor
+		err  error
+	}{
+		{name: "next", s: Cursor{CreatedAt: at, ID: 7}.Encode(), want: &Cursor{CreatedAt: at, ID: 7}},
+		{name: "prev", s: Cursor{CreatedAt: at, ID: 7, Prev: true}.Encode(), want: &Cursor{CreatedAt: at, ID: 7, Prev: true}},
+		{name: "not base64", s: "!!", err: ErrInvalidCursor},
+		{name: "not json", s: "bm90IGpzb24", err: ErrInvalidCursor},
+		{name: "no id", s: Cursor{CreatedAt: at}.Encode(), err: ErrInvalidCursor},
+		{name: "negative id", s: Cursor{CreatedAt: at, ID: -1}.Encode(), err: ErrInvalidCursor},
+		{name: "no time", s: Cursor{ID: 7}.Encode(), err: ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeCursor(tt.s)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("DecodeCursor(%q) error = %v, want %v", tt.s, err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if !got.CreatedAt.Equal(tt.want.CreatedAt) || got.ID != tt.want.ID || got.Prev != tt.want.Prev {
+				t.Errorf("DecodeCursor(%q) = %+v, want %+v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	cursor := &Cursor{CreatedAt: time.Now(), ID: 1}
+	prev := &Cursor{CreatedAt: time.Now(), ID: 1, Prev: true}
+
+	tests := []struct {
+		name      string
+		fq        PaginatedFeedQuery
+		cmp       string
+		wantOrder string
+	}{
+		{name: "newest first", fq: PaginatedFeedQuery{Sort: "desc"}, cmp: "<", wantOrder: "p.createdat DESC, p.id DESC"},
+		{name: "oldest first", fq: PaginatedFeedQuery{Sort: "asc"}, cmp: ">", wantOrder: "p.createdat ASC, p.id ASC"},
+		{name: "next page", fq: PaginatedFeedQuery{Sort: "desc", Cursor: cursor}, cmp: "<", wantOrder: "p.createdat DESC, p.id DESC"},
+		{name: "previous page", fq: PaginatedFeedQuery{Sort: "desc", Cursor: prev}, cmp: ">", wantOrder: "p.createdat ASC, p.id ASC"},
+		{name: "previous page oldest first", fq: PaginatedFeedQuery{Sort: "asc", Cursor: prev}, cmp: "<", wantOrder: "p.createdat DESC, p.id DESC"},
+		{name: "sort is never pasted in", fq: PaginatedFeedQuery{Sort: "; DROP TABLE posts"}, cmp: "<", wantOrder: "p.createdat DESC, p.id DESC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, order := tt.fq.keyset("p", "$1", "$2")
+
+			wantCond := "($1::timestamptz IS NULL OR (p.createdat, p.id) " + tt.cmp + " ($1::timestamptz, $2::bigint))"
+			if cond != wantCond {
+				t.Errorf("cond = %q, want %q", cond, wantCond)
+			}
+			if order != tt.wantOrder {
+				t.Errorf("order = %q, want %q", order, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	at := func(min int) string {
+		return time.Date(2024, 1, 2, 3, min, 0, 0, time.UTC).Format(time.RFC3339Nano)
+	}
+	post := func(id int64) PostWithMetadata {
+		return PostWithMetadata{Post: Post{ID: id, CreatedAt: at(int(id))}}
+	}
+	posts := func(ids ...int64) []PostWithMetadata {
+		out := make([]PostWithMetadata, len(ids))
+		for i, id := range ids {
+			out[i] = post(id)
+		}
+		return out
+	}
+	cursor := func(id int64, prev bool) string {
+		return Cursor{CreatedAt: time.Date(2024, 1, 2, 3, int(id), 0, 0, time.UTC), ID: id, Prev: prev}.Encode()
+	}
+	next := &Cursor{CreatedAt: time.Date(2024, 1, 2, 3, 10, 0, 0, time.UTC), ID: 10}
+	back := &Cursor{CreatedAt: time.Date(2024, 1, 2, 3, 1, 0, 0, time.UTC), ID: 1, Prev: true}
+
+	tests := []struct {
+		name string
+		fq   PaginatedFeedQuery
+		read []PostWithMetadata
+		ids  []int64
+		page PageInfo
+	}{
+		{
+			name: "empty",
+			fq:   PaginatedFeedQuery{Limit: 3},
+			read: posts(),
+			ids:  []int64{},
+		},
+		{
+			name: "only page",
+			fq:   PaginatedFeedQuery{Limit: 3},
+			read: posts(9, 8),
+			ids:  []int64{9, 8},
+		},
+		{
+			name: "first of several",
+			fq:   PaginatedFeedQuery{Limit: 3},
+			read: posts(9, 8, 7, 6),
+			ids:  []int64{9, 8, 7},
+			page: PageInfo{Next: cursor(7, false)},
+		},
+		{
+			name: "middle page",
+			fq:   PaginatedFeedQuery{Limit: 2, Cursor: next},
+			read: posts(9, 8, 7),
+			ids:  []int64{9, 8},
+			page: PageInfo{Next: cursor(8, false), Prev: cursor(9, true)},
+		},
+		{
+			name: "last page",
+			fq:   PaginatedFeedQuery{Limit: 2, Cursor: next},
+			read: posts(9, 8),
+			ids:  []int64{9, 8},
+			page: PageInfo{Prev: cursor(9, true)},
+		},
+		{
+			name: "by offset",
+			fq:   PaginatedFeedQuery{Limit: 2, Offset: 2},
+			read: posts(7, 6),
+			ids:  []int64{7, 6},
+			page: PageInfo{Prev: cursor(7, true)},
+		},
+		{
+			name: "backwards with more before",
+			fq:   PaginatedFeedQuery{Limit: 2, Cursor: back},
+			read: posts(2, 3, 4),
+			ids:  []int64{3, 2},
+			page: PageInfo{Next: cursor(2, false), Prev: cursor(3, true)},
+		},
+		{
+			name: "backwards to the start",
+			fq:   PaginatedFeedQuery{Limit: 2, Cursor: back},
+			read: posts(2, 3),
+			ids:  []int64{3, 2},
+			page: PageInfo{Next: cursor(2, false)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, page, err := paginate(tt.fq, tt.read)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := []int64{}
+			for _, p := range got {
+				ids = append(ids, p.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("posts = %v, want %v", ids, tt.ids)
+			}
+			if page != tt.page {
+				t.Errorf("page = %+v, want %+v", page, tt.page)
+			}
+		})
+	}
+}
+
+func TestPaginateBadTime(t *testing.T) {
+	_, _, err := paginate(PaginatedFeedQuery{Limit: 2}, []PostWithMetadata{{Post: Post{ID: 1, CreatedAt: "yesterday"}}})
+	if err == nil {
+		t.Error("paginate() with an unparseable time succeeded")
+	}
+}
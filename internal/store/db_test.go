@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// testDB opens the database in TEST_DB_ADDR, which has to be migrated up.
+// Tests that need one are skipped without it.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR isn't set")
+	}
+
+	db, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// createTestUser adds a user that is removed, with their posts, once the
+// test is over.
+func createTestUser(t *testing.T, db *sql.DB, name string) int64 {
+	t.Helper()
+
+	username := fmt.Sprintf("%s_%d", name, time.Now().UnixNano())
+	query := `
+		INSERT INTO users (username, email, password, role_id)
+		VALUES ($1, $1 || '@example.com', '', (SELECT id FROM roles WHERE name = 'user'))
+		RETURNING id
+	`
+	var id int64
+	if err := db.QueryRow(query, username).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx := context.Background()
+		db.ExecContext(ctx, `DELETE FROM comments WHERE user_id = $1`, id)
+		db.ExecContext(ctx, `DELETE FROM posts WHERE user_id = $1`, id)
+		db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	})
+
+	return id
+}
+
+// usernameOf returns the username createTestUser picked.
+func usernameOf(t *testing.T, db *sql.DB, userID int64) string {
+	t.Helper()
+
+	var username string
+	if err := db.QueryRow(`SELECT username FROM users WHERE id = $1`, userID).Scan(&username); err != nil {
+		t.Fatal(err)
+	}
+	return username
+}
@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
+// GetDrafts lists the user's unpublished posts, both drafts and scheduled
+// ones, most recently edited first.
+func (s *PostStore) GetDrafts(ctx context.Context, userID int64) ([]Post, error) {
+	query := `
+		SELECT id, user_id, title, content, createdAt, updatedAt, tags, version, status, publish_at, visibility
+		FROM posts
+		WHERE user_id = $1 AND status <> 'published' AND deleted_at IS NULL
+		ORDER BY updatedAt DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drafts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			pq.Array(&p.Tags),
+			&p.Version,
+			&p.Status,
+			&p.PublishAt,
+			&p.Visibility,
+		)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, p)
+	}
+
+	return drafts, rows.Err()
+}
+
+// Schedule marks an unpublished post to go out at publishAt. The scheduler
+// job picks it up from the database, so pending posts survive restarts.
+func (s *PostStore) Schedule(ctx context.Context, post *Post, publishAt time.Time) error {
+	query := `
+		UPDATE posts SET status = 'scheduled', publish_at = $2, updatedAt = NOW()
+		WHERE id = $1 AND status <> 'published' AND deleted_at IS NULL
+		RETURNING status, publish_at, updatedAt
+	`
+	return s.setStatus(ctx, post, query, publishAt)
+}
+
+// Unschedule turns a scheduled post back into a draft.
+func (s *PostStore) Unschedule(ctx context.Context, post *Post) error {
+	query := `
+		UPDATE posts SET status = 'draft', publish_at = NULL, updatedAt = NOW()
+		WHERE id = $1 AND status = 'scheduled' AND deleted_at IS NULL
+		RETURNING status, publish_at, updatedAt
+	`
+	return s.setStatus(ctx, post, query)
+}
+
+// Publish makes an unpublished post visible right away. createdAt is moved to
+// the publication time so the post lands at the top of followers' feeds.
+func (s *PostStore) Publish(ctx context.Context, post *Post) error {
+	query := `
+		WITH published AS (
+			UPDATE posts SET status = 'published', publish_at = NULL, createdAt = NOW(), updatedAt = NOW()
+			WHERE id = $1 AND status <> 'published' AND deleted_at IS NULL
+			RETURNING id, status, publish_at, updatedAt
+		), queued AS (
+			INSERT INTO timeline_fanout (post_id) SELECT id FROM published
+			ON CONFLICT (post_id) DO NOTHING
+		)
+		SELECT status, publish_at, updatedAt FROM published
+	`
+	if err := s.setStatus(ctx, post, query); err != nil {
+		return err
+	}
+
+	post.CreatedAt = post.UpdatedAt
+
+	return nil
+}
+
+func (s *PostStore) setStatus(ctx context.Context, post *Post, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	args = append([]any{post.ID}, args...)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&post.Status, &post.PublishAt, &post.UpdatedAt)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PublishScheduled publishes every scheduled post whose time has come and
+// returns the published posts. Like Publish, createdAt is moved to the
+// publication time: a post published late isn't dated back to where readers
+// paging through their feeds have already gone past.
+func (s *PostStore) PublishScheduled(ctx context.Context) ([]Post, error) {
+	query := `
+		WITH published AS (
+			UPDATE posts SET status = 'published', createdAt = NOW(), publish_at = NULL
+			WHERE status = 'scheduled' AND publish_at <= NOW() AND deleted_at IS NULL
+			RETURNING id, user_id, title, content, createdAt, updatedAt, tags, version, status, visibility
+		), queued AS (
+			INSERT INTO timeline_fanout (post_id) SELECT id FROM published
+			ON CONFLICT (post_id) DO NOTHING
+		)
+		SELECT id, user_id, title, content, createdAt, updatedAt, tags, version, status, visibility FROM published
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	published := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			pq.Array(&p.Tags),
+			&p.Version,
+			&p.Status,
+			&p.Visibility,
+		)
+		if err != nil {
+			return nil, err
+		}
+		published = append(published, p)
+	}
+
+	return published, rows.Err()
+}
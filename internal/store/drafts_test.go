@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPublishScheduledLate(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, "alice")
+
+	p := &Post{UserID: alice, Title: "t", Content: "c", Status: PostStatusDraft}
+	if err := s.Posts.Create(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	// the job runs an hour after the post was due
+	if err := s.Posts.Schedule(ctx, p, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var started time.Time
+	if err := db.QueryRow(`SELECT NOW()`).Scan(&started); err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := s.Posts.PublishScheduled(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, pp := range published {
+		found = found || pp.ID == p.ID
+	}
+	if !found {
+		t.Fatalf("PublishScheduled() didn't publish post %d", p.ID)
+	}
+
+	var (
+		status    string
+		createdAt time.Time
+	)
+	query := `SELECT status, createdAt FROM posts WHERE id = $1`
+	if err := db.QueryRow(query, p.ID).Scan(&status, &createdAt); err != nil {
+		t.Fatal(err)
+	}
+	if status != PostStatusPublished {
+		t.Errorf("status = %q, want %q", status, PostStatusPublished)
+	}
+	// createdAt is stored to the second
+	if createdAt.Before(started.Truncate(time.Second)) {
+		t.Errorf("createdAt = %v, want the time it was published, after %v", createdAt, started)
+	}
+}
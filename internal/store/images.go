@@ -0,0 +1,419 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrImageNotOwned  = errors.New("images can only be attached by the user who uploaded them")
+	ErrDuplicateImage = errors.New("the user already uploaded this image")
+)
+
+// Image is an uploaded media file: a still image, or a video or animated
+// GIF that is only playable once Status is ready.
+type Image struct {
+	ID              int64          `json:"id"`
+	UserID          int64          `json:"user_id"`
+	ImageURL        string         `json:"image_url"`
+	StorageKey      string         `json:"-"`
+	SourceKey       string         `json:"-"`
+	MediaType       string         `json:"media_type"`
+	Status          string         `json:"status"`
+	ProcessingError string         `json:"processing_error,omitempty"`
+	Width           int            `json:"width"`
+	Height          int            `json:"height"`
+	DurationMS      int            `json:"duration_ms,omitempty"`
+	Codec           string         `json:"codec,omitempty"`
+	BlurHash        string         `json:"blurhash"`
+	DominantColor   string         `json:"dominant_color"`
+	ContentType     string         `json:"content_type"`
+	AltText         string         `json:"alt_text"`
+	SHA256          string         `json:"sha256"`
+	Size            int64          `json:"size"`
+	Variants        []ImageVariant `json:"variants"`
+	CreatedAt       string         `json:"createdAt"`
+}
+
+// ImageVariant is one of the derivative sizes generated for an upload.
+type ImageVariant struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	StorageKey  string `json:"-"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// imageColumns selects an image aliased as i in the order scanImage reads
+// it, with its variants folded into a JSON array.
+const imageColumns = `
+	i.id, COALESCE(i.user_id, 0), i.url, i.storage_key, i.source_key, i.media_type, i.status, i.processing_error,
+	i.width, i.height, i.duration_ms, i.codec, i.blurhash, i.dominant_color, i.content_type, i.alt_text, i.sha256, i.size_bytes, i.createdAt,
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'name', v.name, 'storage_key', v.storage_key, 'width', v.width, 'height', v.height,
+			'content_type', v.content_type, 'size', v.size_bytes
+		) ORDER BY v.width)
+		FROM image_variants v WHERE v.image_id = i.id
+	), '[]')`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanImage(row scanner, image *Image, dest ...any) error {
+	var variants []byte
+	dest = append(dest,
+		&image.ID,
+		&image.UserID,
+		&image.ImageURL,
+		&image.StorageKey,
+		&image.SourceKey,
+		&image.MediaType,
+		&image.Status,
+		&image.ProcessingError,
+		&image.Width,
+		&image.Height,
+		&image.DurationMS,
+		&image.Codec,
+		&image.BlurHash,
+		&image.DominantColor,
+		&image.ContentType,
+		&image.AltText,
+		&image.SHA256,
+		&image.Size,
+		&image.CreatedAt,
+		&variants,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	var rows []struct {
+		ImageVariant
+		StorageKey string `json:"storage_key"`
+	}
+	if err := json.Unmarshal(variants, &rows); err != nil {
+		return err
+	}
+
+	image.Variants = make([]ImageVariant, len(rows))
+	for n, v := range rows {
+		image.Variants[n] = v.ImageVariant
+		image.Variants[n].StorageKey = v.StorageKey
+	}
+
+	return nil
+}
+
+type ImageStore struct {
+	db *sql.DB
+}
+
+func (s *ImageStore) Create(ctx context.Context, image *Image) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return createImage(ctx, tx, image)
+	})
+}
+
+// GetByID returns an image along with its variants.
+func (s *ImageStore) GetByID(ctx context.Context, id int64) (*Image, error) {
+	query := `
+		SELECT ` + imageColumns + `
+		FROM images i
+		WHERE i.id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var image Image
+	if err := scanImage(s.db.QueryRowContext(ctx, query, id), &image); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &image, nil
+}
+
+// GetByHash looks for an image the user already uploaded with the same
+// content. Finding one restarts its grace period before garbage collection,
+// since it's about to be used again.
+func (s *ImageStore) GetByHash(ctx context.Context, userID int64, sha256 string) (*Image, error) {
+	query := `
+		WITH used AS (
+			UPDATE images SET last_used_at = NOW()
+			WHERE user_id = $1 AND sha256 = $2 AND sha256 <> ''
+			RETURNING id
+		)
+		SELECT ` + imageColumns + `
+		FROM images i
+		JOIN used ON used.id = i.id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var image Image
+	if err := scanImage(s.db.QueryRowContext(ctx, query, userID, sha256), &image); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &image, nil
+}
+
+// CollectGarbage deletes up to limit images that no post or avatar has
+// used for longer than gracePeriod. Their files are queued for deletion
+// from blob storage in the same statement, see PendingBlobDeletions.
+func (s *ImageStore) CollectGarbage(ctx context.Context, gracePeriod time.Duration, limit int) (int64, error) {
+	query := `
+		WITH doomed AS (
+			SELECT id FROM images
+			WHERE ref_count = 0 AND last_used_at < NOW() - $1 * interval '1 second'
+			ORDER BY last_used_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		), queued AS (
+			INSERT INTO blob_deletions (storage_key)
+			SELECT v.storage_key FROM image_variants v WHERE v.image_id IN (SELECT id FROM doomed)
+			UNION
+			SELECT i.storage_key FROM images i WHERE i.id IN (SELECT id FROM doomed) AND i.storage_key <> ''
+			UNION
+			SELECT i.source_key FROM images i WHERE i.id IN (SELECT id FROM doomed) AND i.source_key <> ''
+			ON CONFLICT DO NOTHING
+		)
+		DELETE FROM images WHERE id IN (SELECT id FROM doomed)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, gracePeriod.Seconds(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// PendingBlobDeletions lists storage keys of collected images whose files
+// haven't been deleted yet.
+func (s *ImageStore) PendingBlobDeletions(ctx context.Context, limit int) ([]string, error) {
+	query := `SELECT storage_key FROM blob_deletions ORDER BY createdAt LIMIT $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// ClearBlobDeletions marks files as deleted from blob storage.
+func (s *ImageStore) ClearBlobDeletions(ctx context.Context, keys []string) error {
+	query := `DELETE FROM blob_deletions WHERE storage_key = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, pq.Array(keys))
+	return err
+}
+
+// createImage saves a new image with its variants. It fails with
+// ErrDuplicateImage when the owner already has an image with the same hash.
+func createImage(ctx context.Context, tx *sql.Tx, image *Image) error {
+	query := `
+		INSERT INTO images (
+			url, storage_key, source_key, user_id, media_type, status, width, height,
+			duration_ms, codec, blurhash, dominant_color, content_type, alt_text, sha256, size_bytes
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING id, createdAt
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if image.MediaType == "" {
+		image.MediaType = MediaTypeImage
+	}
+	if image.Status == "" {
+		image.Status = MediaStatusReady
+	}
+
+	err := tx.QueryRowContext(ctx, query,
+		image.ImageURL,
+		image.StorageKey,
+		image.SourceKey,
+		image.UserID,
+		image.MediaType,
+		image.Status,
+		image.Width,
+		image.Height,
+		image.DurationMS,
+		image.Codec,
+		image.BlurHash,
+		image.DominantColor,
+		image.ContentType,
+		image.AltText,
+		image.SHA256,
+		image.Size,
+	).Scan(&image.ID, &image.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrDuplicateImage
+		}
+		return err
+	}
+
+	return insertImageVariants(ctx, tx, image)
+}
+
+func insertImageVariants(ctx context.Context, tx *sql.Tx, image *Image) error {
+	query := `
+		INSERT INTO image_variants (image_id, name, storage_key, width, height, content_type, size_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	for _, v := range image.Variants {
+		_, err := tx.ExecContext(ctx, query,
+			image.ID,
+			v.Name,
+			v.StorageKey,
+			v.Width,
+			v.Height,
+			v.ContentType,
+			v.Size,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetByPostIDs returns the images attached to each of the posts, in the
+// order they were attached. Media still processing, or that failed to, is
+// left out.
+func (s *ImageStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]Image, error) {
+	query := `
+		SELECT pi.post_id, ` + imageColumns + `
+		FROM post_images pi
+		JOIN images i ON i.id = pi.image_id
+		WHERE pi.post_id = ANY($1) AND i.status = 'ready'
+		ORDER BY pi.post_id, pi.position
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := map[int64][]Image{}
+	for rows.Next() {
+		var postID int64
+		var i Image
+		if err := scanImage(rows, &i, &postID); err != nil {
+			return nil, err
+		}
+		images[postID] = append(images[postID], i)
+	}
+
+	return images, rows.Err()
+}
+
+// attachPostImages links the images in post.Images to the post in the given
+// order and fills in their details. Every image has to belong to the post's
+// author, otherwise nothing is attached and ErrImageNotOwned is returned.
+func attachPostImages(ctx context.Context, tx *sql.Tx, post *Post) error {
+	if len(post.Images) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(post.Images))
+	for i, image := range post.Images {
+		ids[i] = image.ID
+	}
+
+	query := `
+		INSERT INTO post_images (post_id, image_id, position)
+		SELECT $1, i.id, t.position
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS t(image_id, position)
+		JOIN images i ON i.id = t.image_id
+		WHERE i.user_id = $3
+		ON CONFLICT DO NOTHING
+		RETURNING image_id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, query, post.ID, pq.Array(ids), post.UserID)
+	if err != nil {
+		return err
+	}
+	attached := 0
+	for rows.Next() {
+		attached++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if attached != len(ids) {
+		return ErrImageNotOwned
+	}
+
+	query = `
+		SELECT ` + imageColumns + `
+		FROM post_images pi
+		JOIN images i ON i.id = pi.image_id
+		WHERE pi.post_id = $1 AND i.status = 'ready'
+		ORDER BY pi.position
+	`
+	rows, err = tx.QueryContext(ctx, query, post.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	post.Images = post.Images[:0]
+	for rows.Next() {
+		var i Image
+		if err := scanImage(rows, &i); err != nil {
+			return err
+		}
+		post.Images = append(post.Images, i)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/supremed3v/social-media/internal/unfurl"
+)
+
+// maxPostLinks is how many links in a post get a preview card.
+const maxPostLinks = 3
+
+const (
+	LinkPreviewPending = "pending"
+	LinkPreviewReady   = "ready"
+	LinkPreviewFailed  = "failed"
+)
+
+// LinkPreview is the card shown for a link in a post. Previews are cached
+// by URL and shared between posts.
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
+	SiteName    string `json:"site_name"`
+	Type        string `json:"type"`
+	Status      string `json:"-"`
+	Attempts    int    `json:"-"`
+}
+
+// setPostLinks records the links in the post's content and queues the
+// ones without a preview, or with an expired one, to be fetched.
+func setPostLinks(ctx context.Context, tx *sql.Tx, post *Post) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_links WHERE post_id = $1`, post.ID); err != nil {
+		return err
+	}
+
+	urls := unfurl.ExtractURLs(post.Content, maxPostLinks)
+	if len(urls) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO link_previews (url) SELECT unnest($1::text[])
+		ON CONFLICT (url) DO UPDATE
+		SET status = 'pending', attempts = 0, locked_until = NULL
+		WHERE link_previews.status <> 'pending' AND link_previews.expires_at < NOW()
+	`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(urls)); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO post_links (post_id, url, position)
+		SELECT $1, u.url, u.position FROM unnest($2::text[]) WITH ORDINALITY AS u(url, position)
+	`
+	_, err := tx.ExecContext(ctx, query, post.ID, pq.Array(urls))
+
+	return err
+}
+
+type LinkPreviewStore struct {
+	db *sql.DB
+}
+
+// GetByPostIDs returns the previews fetched so far for each post's links,
+// in the order the links appear.
+func (s *LinkPreviewStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]LinkPreview, error) {
+	previews := map[int64][]LinkPreview{}
+	if len(postIDs) == 0 {
+		return previews, nil
+	}
+
+	query := `
+		SELECT pl.post_id, lp.url, lp.title, lp.description, lp.image_url, lp.site_name, lp.preview_type
+		FROM post_links pl
+		JOIN link_previews lp ON lp.url = pl.url
+		WHERE pl.post_id = ANY($1) AND lp.fetched_at IS NOT NULL
+		ORDER BY pl.post_id, pl.position
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int64
+		var p LinkPreview
+		if err := rows.Scan(&postID, &p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName, &p.Type); err != nil {
+			return nil, err
+		}
+		previews[postID] = append(previews[postID], p)
+	}
+
+	return previews, rows.Err()
+}
+
+// ClaimPending leases the oldest link waiting to be fetched to the caller,
+// the same way ImageStore.ClaimProcessing does for media. It returns
+// ErrNotFound when there is nothing to do.
+func (s *LinkPreviewStore) ClaimPending(ctx context.Context, lease time.Duration, maxAttempts int) (*LinkPreview, error) {
+	giveUp := `
+		UPDATE link_previews
+		SET status = 'failed', locked_until = NULL, expires_at = NOW(),
+			error = COALESCE(NULLIF(error, ''), 'fetch timed out')
+		WHERE status = 'pending' AND attempts >= $1 AND locked_until < NOW()
+	`
+	claim := `
+		UPDATE link_previews
+		SET attempts = attempts + 1, locked_until = NOW() + $1 * interval '1 second'
+		WHERE url = (
+			SELECT url FROM link_previews
+			WHERE status = 'pending' AND attempts < $2
+				AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING url, status, attempts
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, giveUp, maxAttempts); err != nil {
+		return nil, err
+	}
+
+	var p LinkPreview
+	if err := s.db.QueryRowContext(ctx, claim, lease.Seconds(), maxAttempts).Scan(&p.URL, &p.Status, &p.Attempts); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+// Finish stores a fetched preview, cached for ttl.
+func (s *LinkPreviewStore) Finish(ctx context.Context, preview *LinkPreview, ttl time.Duration) error {
+	query := `
+		UPDATE link_previews
+		SET status = 'ready', title = $2, description = $3, image_url = $4, site_name = $5,
+			preview_type = $6, error = '', locked_until = NULL, fetched_at = NOW(),
+			expires_at = NOW() + $7 * interval '1 second'
+		WHERE url = $1 AND status = 'pending'
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query,
+		preview.URL,
+		preview.Title,
+		preview.Description,
+		preview.ImageURL,
+		preview.SiteName,
+		preview.Type,
+		ttl.Seconds(),
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	preview.Status = LinkPreviewReady
+	return nil
+}
+
+// Fail records why fetching failed. The link is retried after retryAfter
+// unless it used up its attempts or permanent is set; then it is marked
+// failed for ttl, keeping any preview fetched earlier.
+func (s *LinkPreviewStore) Fail(ctx context.Context, preview *LinkPreview, reason string, permanent bool, retryAfter time.Duration, maxAttempts int, ttl time.Duration) error {
+	query := `
+		UPDATE link_previews
+		SET error = $2,
+			status = CASE WHEN $3 OR attempts >= $4 THEN 'failed' ELSE status END,
+			expires_at = CASE WHEN $3 OR attempts >= $4 THEN NOW() + $6 * interval '1 second' ELSE expires_at END,
+			locked_until = NOW() + $5 * interval '1 second'
+		WHERE url = $1 AND status = 'pending'
+		RETURNING status
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, preview.URL, reason, permanent, maxAttempts, retryAfter.Seconds(), ttl.Seconds()).Scan(&preview.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
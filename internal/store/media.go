@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	MediaTypeImage     = "image"
+	MediaTypeVideo     = "video"
+	MediaTypeAnimation = "animation"
+
+	MediaStatusProcessing = "processing"
+	MediaStatusReady      = "ready"
+	MediaStatusFailed     = "failed"
+)
+
+// ClaimProcessing hands out the oldest media waiting to be transcoded and
+// leases it to the caller for the given time, so each item is worked on by
+// one worker at a time. A worker that dies loses its lease and the item is
+// tried again, up to maxAttempts times before it is marked failed. It
+// returns ErrNotFound when there is nothing to do.
+func (s *ImageStore) ClaimProcessing(ctx context.Context, lease time.Duration, maxAttempts int) (*Image, error) {
+	giveUp := `
+		UPDATE images
+		SET status = 'failed', sha256 = '', locked_until = NULL,
+			processing_error = COALESCE(NULLIF(processing_error, ''), 'processing timed out')
+		WHERE status = 'processing' AND processing_attempts >= $1 AND locked_until < NOW()
+	`
+	claim := `
+		UPDATE images
+		SET processing_attempts = processing_attempts + 1, locked_until = NOW() + $1 * interval '1 second'
+		WHERE id = (
+			SELECT id FROM images
+			WHERE status = 'processing' AND processing_attempts < $2
+				AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, giveUp, maxAttempts); err != nil {
+		return nil, err
+	}
+
+	var id int64
+	if err := s.db.QueryRowContext(ctx, claim, lease.Seconds(), maxAttempts).Scan(&id); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return s.GetByID(ctx, id)
+}
+
+// FinishProcessing stores the outcome of transcoding and makes the media
+// ready. The caller deletes the source file afterwards.
+func (s *ImageStore) FinishProcessing(ctx context.Context, image *Image) error {
+	query := `
+		UPDATE images
+		SET status = 'ready', storage_key = $2, source_key = '', width = $3, height = $4,
+			duration_ms = $5, codec = $6, content_type = $7, blurhash = $8, dominant_color = $9,
+			processing_error = '', locked_until = NULL
+		WHERE id = $1 AND status = 'processing'
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query,
+			image.ID,
+			image.StorageKey,
+			image.Width,
+			image.Height,
+			image.DurationMS,
+			image.Codec,
+			image.ContentType,
+			image.BlurHash,
+			image.DominantColor,
+		)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		image.Status = MediaStatusReady
+		image.SourceKey = ""
+		return insertImageVariants(ctx, tx, image)
+	})
+}
+
+// FailProcessing records why processing failed. The media is retried after
+// retryAfter unless it used up its attempts or permanent is set, in which
+// case it is marked failed. Failed media no longer counts as a duplicate,
+// so uploading the file again starts over.
+func (s *ImageStore) FailProcessing(ctx context.Context, image *Image, reason string, permanent bool, retryAfter time.Duration, maxAttempts int) error {
+	query := `
+		UPDATE images
+		SET processing_error = $2,
+			status = CASE WHEN $3 OR processing_attempts >= $4 THEN 'failed' ELSE status END,
+			sha256 = CASE WHEN $3 OR processing_attempts >= $4 THEN '' ELSE sha256 END,
+			locked_until = NOW() + $5 * interval '1 second'
+		WHERE id = $1 AND status = 'processing'
+		RETURNING status
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, image.ID, reason, permanent, maxAttempts, retryAfter.Seconds()).Scan(&image.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	image.ProcessingError = reason
+	return nil
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/supremed3v/social-media/internal/mention"
+)
+
+// mentionableUsers selects the IDs of the users named in the $2 array that
+// may be mentioned by the author in $3. Users who blocked the author are
+// left out, so their mentions are dropped.
+const mentionableUsers = `
+	SELECT u.id FROM users u
+	WHERE u.username = ANY($2) AND NOT EXISTS (
+		SELECT 1 FROM user_blocks b WHERE b.blocker_id = u.id AND b.blocked_id = $3
+	)
+`
+
+// setPostMentions replaces the users mentioned by the post with the ones
+// currently in its content. Unknown usernames are ignored.
+func setPostMentions(ctx context.Context, tx *sql.Tx, post *Post) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_mentions WHERE post_id = $1`, post.ID); err != nil {
+		return err
+	}
+
+	usernames := mention.Usernames(post.Content)
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO post_mentions (post_id, user_id)
+		SELECT $1, id FROM (` + mentionableUsers + `) m
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, post.ID, pq.Array(usernames), post.UserID)
+
+	return err
+}
+
+// setCommentMentions records the users mentioned in a new comment.
+func setCommentMentions(ctx context.Context, tx *sql.Tx, comment *Comment) error {
+	usernames := mention.Usernames(comment.Content)
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO comment_mentions (comment_id, user_id)
+		SELECT $1, id FROM (` + mentionableUsers + `) m
+		ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, comment.ID, pq.Array(usernames), comment.UserID)
+
+	return err
+}
+
+type MentionStore struct {
+	db *sql.DB
+}
+
+// GetByPostIDs returns, per post, the usernames of the users it mentions
+// mapped to their IDs. mention.Resolve turns these into entities.
+func (s *MentionStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64]map[string]int64, error) {
+	query := `
+		SELECT m.post_id, u.id, u.username
+		FROM post_mentions m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.post_id = ANY($1)
+	`
+	return s.get(ctx, query, postIDs)
+}
+
+// GetByCommentIDs is GetByPostIDs for comments.
+func (s *MentionStore) GetByCommentIDs(ctx context.Context, commentIDs []int64) (map[int64]map[string]int64, error) {
+	query := `
+		SELECT m.comment_id, u.id, u.username
+		FROM comment_mentions m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.comment_id = ANY($1)
+	`
+	return s.get(ctx, query, commentIDs)
+}
+
+func (s *MentionStore) get(ctx context.Context, query string, ids []int64) (map[int64]map[string]int64, error) {
+	mentions := map[int64]map[string]int64{}
+	if len(ids) == 0 {
+		return mentions, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, userID int64
+		var username string
+		if err := rows.Scan(&id, &userID, &username); err != nil {
+			return nil, err
+		}
+
+		if mentions[id] == nil {
+			mentions[id] = map[string]int64{}
+		}
+		mentions[id][username] = userID
+	}
+
+	return mentions, rows.Err()
+}
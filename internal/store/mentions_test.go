@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestGetMentioning(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	carol := createTestUser(t, db, "carol")
+	dave := createTestUser(t, db, "dave")
+	at := "@" + usernameOf(t, db, alice)
+
+	post := func(author int64, content, visibility string) int64 {
+		p := &Post{UserID: author, Title: "t", Content: content, Visibility: visibility}
+		if err := s.Posts.Create(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		return p.ID
+	}
+	comment := func(postID, author int64, content string) {
+		if err := s.Comments.Create(ctx, &Comment{PostID: postID, UserID: author, Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inPost := post(bob, "hi "+at, VisibilityPublic)
+	inComment := post(bob, "no mentions", VisibilityPublic)
+	comment(inComment, carol, "look "+at)
+	hidden := post(bob, "followers only", VisibilityFollowers)
+	comment(hidden, carol, "look "+at)
+	byBlocked := post(bob, "no mentions", VisibilityPublic)
+	comment(byBlocked, dave, "look "+at)
+	post(bob, "no mentions", VisibilityPublic)
+
+	if err := s.Blocks.Block(ctx, alice, dave); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, _, err := s.Posts.GetMentioning(ctx, alice, PaginatedFeedQuery{Limit: 10, Sort: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []int64{}
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	// not the followers only post, nor the one mentioning alice in a comment
+	// by someone alice blocked
+	if want := []int64{inComment, inPost}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("GetMentioning() = %v, want %v (hidden %d, by blocked %d)", ids, want, hidden, byBlocked)
+	}
+}
@@ -0,0 +1,321 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	NotificationFollow   = "follow"
+	NotificationComment  = "comment"
+	NotificationMention  = "mention"
+	NotificationReaction = "reaction"
+)
+
+// notificationActorsShown is how many of the people behind a notification
+// are listed with it, the latest first. ActorsCount has them all.
+const notificationActorsShown = 3
+
+// NotificationEvent is something that happened to UserID: ActorID followed
+// them, or commented on, mentioned them in or reacted to PostID.
+type NotificationEvent struct {
+	Type      string
+	UserID    int64
+	ActorID   int64
+	PostID    *int64
+	CommentID *int64
+}
+
+// groupKey is what events are grouped by while their notification is
+// unread: the type and the post it's about.
+func (e NotificationEvent) groupKey() string {
+	if e.PostID == nil {
+		return e.Type
+	}
+	return fmt.Sprintf("%s:%d", e.Type, *e.PostID)
+}
+
+type NotificationActor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	AvatarID *int64 `json:"avatar_id"`
+	// CommentID is the comment the actor wrote, for comments and mentions
+	// in comments.
+	CommentID *int64 `json:"comment_id,omitempty"`
+}
+
+type Notification struct {
+	ID          int64               `json:"id"`
+	Type        string              `json:"type"`
+	PostID      *int64              `json:"post_id"`
+	Actors      []NotificationActor `json:"actors"`
+	ActorsCount int                 `json:"actors_count"`
+	Read        bool                `json:"read"`
+	CreatedAt   string              `json:"created_at"`
+	UpdatedAt   string              `json:"updated_at"`
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// notificationColumns selects a notification aliased as n with its latest
+// actors, in the order scanNotification reads them.
+var notificationColumns = fmt.Sprintf(`
+	n.id, n.type, n.post_id, n.read_at IS NOT NULL, n.created_at, n.updated_at,
+	(SELECT COUNT(*) FROM notification_actors na WHERE na.notification_id = n.id),
+	(
+		SELECT COALESCE(json_agg(json_build_object(
+			'id', u.id, 'username', u.username, 'avatar_id', u.avatar_image_id, 'comment_id', la.comment_id
+		) ORDER BY la.created_at DESC), '[]')
+		FROM (
+			SELECT * FROM notification_actors na
+			WHERE na.notification_id = n.id
+			ORDER BY na.created_at DESC
+			LIMIT %d
+		) la
+		JOIN users u ON u.id = la.actor_id
+	)`, notificationActorsShown)
+
+func scanNotification(row interface{ Scan(...any) error }) (*Notification, error) {
+	var (
+		n      Notification
+		actors []byte
+	)
+	err := row.Scan(&n.ID, &n.Type, &n.PostID, &n.Read, &n.CreatedAt, &n.UpdatedAt, &n.ActorsCount, &actors)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(actors, &n.Actors); err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+// Add records the event, joining the user's unread notification about the
+// same thing if there is one. It returns the notification as it is now, or
+// nil when the event isn't notified: users aren't told about themselves or
+// about users they blocked.
+func (s *NotificationStore) Add(ctx context.Context, e NotificationEvent) (*Notification, error) {
+	if e.UserID == e.ActorID {
+		return nil, nil
+	}
+
+	blocked := `SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2)`
+	upsert := `
+		INSERT INTO notifications (user_id, type, post_id, group_key)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, group_key) WHERE read_at IS NULL
+		DO UPDATE SET updated_at = NOW()
+		RETURNING id
+	`
+	addActor := `
+		INSERT INTO notification_actors (notification_id, actor_id, comment_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (notification_id, actor_id)
+		DO UPDATE SET comment_id = EXCLUDED.comment_id, created_at = NOW()
+	`
+
+	var id int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var isBlocked bool
+		if err := tx.QueryRowContext(ctx, blocked, e.UserID, e.ActorID).Scan(&isBlocked); err != nil {
+			return err
+		}
+		if isBlocked {
+			return nil
+		}
+
+		if err := tx.QueryRowContext(ctx, upsert, e.UserID, e.Type, e.PostID, e.groupKey()).Scan(&id); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, addActor, id, e.ActorID, e.CommentID)
+		return err
+	})
+	if err != nil || id == 0 {
+		return nil, err
+	}
+
+	return s.GetByID(ctx, e.UserID, id)
+}
+
+// Retract takes the actor out of the user's unread notification about the
+// event, after they unfollowed or took their reaction back. A notification
+// left with nobody is removed. Read notifications are left alone.
+func (s *NotificationStore) Retract(ctx context.Context, e NotificationEvent) error {
+	removeActor := `
+		DELETE FROM notification_actors na
+		USING notifications n
+		WHERE
+			n.id = na.notification_id AND
+			n.user_id = $1 AND n.group_key = $2 AND n.read_at IS NULL AND
+			na.actor_id = $3
+	`
+	removeEmpty := `
+		DELETE FROM notifications n
+		WHERE
+			n.user_id = $1 AND n.group_key = $2 AND n.read_at IS NULL AND
+			NOT EXISTS (SELECT 1 FROM notification_actors na WHERE na.notification_id = n.id)
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, removeActor, e.UserID, e.groupKey(), e.ActorID); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, removeEmpty, e.UserID, e.groupKey())
+		return err
+	})
+}
+
+func (s *NotificationStore) GetByID(ctx context.Context, userID, id int64) (*Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications n WHERE n.id = $1 AND n.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	n, err := scanNotification(s.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// List returns a page of the user's notifications, the most recently
+// active first, optionally only the unread ones. Notifications move to the
+// top as people join them, so they are paged forwards by cursor only.
+// Those about deleted posts are left out.
+func (s *NotificationStore) List(ctx context.Context, userID int64, unreadOnly bool, fq PaginatedFeedQuery) ([]Notification, PageInfo, error) {
+	query := `
+		SELECT ` + notificationColumns + `
+		FROM notifications n
+		WHERE
+			n.user_id = $1 AND
+			(NOT $3 OR n.read_at IS NULL) AND
+			($4::timestamptz IS NULL OR (n.updated_at, n.id) < ($4::timestamptz, $5::bigint)) AND
+			EXISTS (SELECT 1 FROM notification_actors na WHERE na.notification_id = n.id) AND
+			(n.post_id IS NULL OR EXISTS (
+				SELECT 1 FROM posts p WHERE p.id = n.post_id AND p.deleted_at IS NULL
+			))
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorTime, cursorID := fq.keysetArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit+1, unreadOnly, cursorTime, cursorID)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		notifications = append(notifications, *n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	var page PageInfo
+	if len(notifications) > fq.Limit {
+		notifications = notifications[:fq.Limit]
+
+		last := notifications[len(notifications)-1]
+		t, err := time.Parse(time.RFC3339Nano, last.UpdatedAt)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+		page.Next = Cursor{CreatedAt: t, ID: last.ID}.Encode()
+	}
+
+	return notifications, page, nil
+}
+
+// UnreadCount counts the user's unread notifications, each group once.
+func (s *NotificationStore) UnreadCount(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM notifications n
+		WHERE
+			n.user_id = $1 AND n.read_at IS NULL AND
+			EXISTS (SELECT 1 FROM notification_actors na WHERE na.notification_id = n.id) AND
+			(n.post_id IS NULL OR EXISTS (
+				SELECT 1 FROM posts p WHERE p.id = n.post_id AND p.deleted_at IS NULL
+			))
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MarkRead marks one of the user's notifications read. Marking a read one
+// again does nothing.
+func (s *NotificationStore) MarkRead(ctx context.Context, userID, id int64) error {
+	query := `
+		UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MarkAllRead marks every unread notification of the user read and
+// returns how many there were.
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userID int64) (int64, error) {
+	query := `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -1,10 +1,14 @@
 package store
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/supremed3v/social-media/internal/hashtag"
 )
 
 type PaginatedFeedQuery struct {
@@ -13,8 +17,13 @@ type PaginatedFeedQuery struct {
 	Sort   string   `json:"sort" validate:"oneof=asc desc"`
 	Tags   []string `json:"tags" validated:"max=5"`
 	Search string   `json:"search" validate:"max=100"`
-	Since  string   `json:"since"`
-	Until  string   `json:"until"`
+	// Since and Until limit posts to those created at or after Since and
+	// before Until.
+	Since *time.Time `json:"since"`
+	Until *time.Time `json:"until"`
+	// Cursor continues from a position returned with an earlier page. It
+	// takes the place of Offset, which is kept for older clients.
+	Cursor *Cursor `json:"-"`
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -24,7 +33,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if limit != "" {
 		l, err := strconv.Atoi(limit)
 		if err != nil {
-			return fq, nil
+			return fq, fmt.Errorf("invalid limit: %q is not a whole number", limit)
 		}
 
 		fq.Limit = l
@@ -33,20 +42,34 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if offset != "" {
 		o, err := strconv.Atoi(offset)
 		if err != nil {
-			return fq, nil
+			return fq, fmt.Errorf("invalid offset: %q is not a whole number", offset)
 		}
 
 		fq.Offset = o
 	}
 
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		if fq.Offset != 0 {
+			return fq, errors.New("cursor and offset can't be combined")
+		}
+
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return fq, err
+		}
+		fq.Cursor = c
+	}
+
 	sort := qs.Get("sort")
 	if sort != "" {
 		fq.Sort = sort
 	}
 
+	// tags are matched in their normalised form
 	tags := qs.Get("tags")
 	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+		fq.Tags = hashtag.Merge(strings.Split(tags, ","))
 	}
 
 	search := qs.Get("search")
@@ -56,21 +79,61 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 
 	since := qs.Get("since")
 	if since != "" {
-		fq.Since = parseTime(since)
+		t, err := parseTime(since)
+		if err != nil {
+			return fq, fmt.Errorf("invalid since: %w", err)
+		}
+		fq.Since = &t
 	}
 	until := qs.Get("until")
 	if until != "" {
-		fq.Until = parseTime(until)
+		t, err := parseTime(until)
+		if err != nil {
+			return fq, fmt.Errorf("invalid until: %w", err)
+		}
+		fq.Until = &t
+	}
+
+	if fq.Since != nil && fq.Until != nil && !fq.Since.Before(*fq.Until) {
+		return fq, errors.New("since must be before until")
 	}
 
 	return fq, nil
 }
 
-func parseTime(s string) string {
-	t, err := time.Parse(time.DateTime, s)
-	if err != nil {
-		return ""
+// parseTime reads an RFC 3339 timestamp. The "2006-01-02 15:04:05" form
+// accepted before is still understood, as UTC.
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err == nil {
+		return t, nil
 	}
 
-	return t.Format(time.DateTime)
+	if t, err := time.Parse(time.DateTime, s); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time like 2006-01-02T15:04:05Z", s)
+}
+
+// timeWindow returns a SQL condition that holds when the post aliased as p
+// falls within Since and Until, whose values go into the sinceArg and
+// untilArg placeholders (see timeWindowArgs). Unset bounds are NULL.
+func (fq PaginatedFeedQuery) timeWindow(p, sinceArg, untilArg string) string {
+	return fmt.Sprintf(
+		"(%[2]s::timestamptz IS NULL OR %[1]s.createdat >= %[2]s::timestamptz) AND (%[3]s::timestamptz IS NULL OR %[1]s.createdat < %[3]s::timestamptz)",
+		p, sinceArg, untilArg,
+	)
+}
+
+// timeWindowArgs returns the values for timeWindow's placeholders.
+func (fq PaginatedFeedQuery) timeWindowArgs() (any, any) {
+	var since, until any
+	if fq.Since != nil {
+		since = *fq.Since
+	}
+	if fq.Until != nil {
+		until = *fq.Until
+	}
+	return since, until
 }
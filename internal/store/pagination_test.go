@@ -0,0 +1,70 @@
+package store
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPaginatedFeedQueryParse(t *testing.T) {
+	since := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	until := since.Add(time.Hour)
+	cursor := Cursor{CreatedAt: since, ID: 7}
+
+	tests := []struct {
+		query string
+		want  PaginatedFeedQuery
+		err   string
+	}{
+		{
+			query: "",
+			want:  PaginatedFeedQuery{Limit: 20, Sort: "desc"},
+		},
+		{
+			query: "limit=5&offset=10&sort=asc&search=gophers",
+			want:  PaginatedFeedQuery{Limit: 5, Offset: 10, Sort: "asc", Search: "gophers"},
+		},
+		{
+			query: "tags=Go,%23golang,,bad-tag,Café",
+			want:  PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: []string{"go", "golang", "café"}},
+		},
+		{
+			query: "since=2024-01-02T03:04:05Z&until=2024-01-02%2004:04:05",
+			want:  PaginatedFeedQuery{Limit: 20, Sort: "desc", Since: &since, Until: &until},
+		},
+		{
+			query: "cursor=" + cursor.Encode(),
+			want:  PaginatedFeedQuery{Limit: 20, Sort: "desc", Cursor: &cursor},
+		},
+		{query: "limit=ten", err: "invalid limit"},
+		{query: "limit=5&offset=1e3", err: "invalid offset"},
+		{query: "offset=5&cursor=" + cursor.Encode(), err: "can't be combined"},
+		{query: "cursor=bm90IGpzb24", err: ErrInvalidCursor.Error()},
+		{query: "cursor=%00", err: ErrInvalidCursor.Error()},
+		{query: "since=yesterday", err: "invalid since"},
+		{query: "until=2024-13-01T00:00:00Z", err: "invalid until"},
+		{query: "since=2024-01-02T04:00:00Z&until=2024-01-02T03:00:00Z", err: "since must be before until"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+		got, err := PaginatedFeedQuery{Limit: 20, Sort: "desc"}.Parse(r)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Parse(%q): got error %v, want one containing %q", tt.query, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.query, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
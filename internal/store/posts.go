@@ -4,28 +4,37 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/lib/pq"
+	"github.com/supremed3v/social-media/internal/mention"
 )
 
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"createdAt"`
-	UpdatedAt string    `json:"updatedAt"`
-	Version   int       `json:"version"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"users"`
+	ID         int64             `json:"id"`
+	Content    string            `json:"content"`
+	Title      string            `json:"title"`
+	UserID     int64             `json:"user_id"`
+	Tags       []string          `json:"tags"`
+	Mentions   []mention.Mention `json:"mentions"`
+	CreatedAt  string            `json:"createdAt"`
+	UpdatedAt  string            `json:"updatedAt"`
+	Version    int               `json:"version"`
+	Status     string            `json:"status"`
+	PublishAt  *string           `json:"publish_at,omitempty"`
+	Visibility string            `json:"visibility"`
+	Images     []Image           `json:"images"`
+	Links      []LinkPreview     `json:"link_previews"`
+	Comments   []Comment         `json:"comments"`
+	User       User              `json:"users"`
 }
 
-type Image struct {
-	ID        int64  `json:"id"`
-	ImageURL  string `json:"image_url"`
-	CreatedAt string `json:"createdAt"`
-	UpdatedAt string `json:"updatedAt"`
+type TrashedPost struct {
+	Post
+	DeletedAt          string `json:"deleted_at"`
+	DeletedBy          *int64 `json:"deleted_by"`
+	DeletedByModerator bool   `json:"deleted_by_moderator"`
+	PurgeAt            string `json:"purge_at"`
 }
 
 type PostWithMetadata struct {
@@ -33,40 +42,95 @@ type PostWithMetadata struct {
 	CommentsCount int `json:"comments_count"`
 }
 
+// feedPostColumns selects a post aliased as p, with its author aliased as
+// u, in the order scanFeedPost reads them.
+const feedPostColumns = `
+	p.id, p.user_id, p.title, p.content, p.createdat, p.version, p.tags, p.visibility, u.username,
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id)`
+
+// scanFeedPost reads feedPostColumns into post, then any columns selected
+// after them into dest.
+func scanFeedPost(row scanner, post *PostWithMetadata, dest ...any) error {
+	return row.Scan(append([]any{
+		&post.ID,
+		&post.UserID,
+		&post.Title,
+		&post.Content,
+		&post.CreatedAt,
+		&post.Version,
+		pq.Array(&post.Tags),
+		&post.Visibility,
+		&post.User.Username,
+		&post.CommentsCount,
+	}, dest...)...)
+}
+
 type PostStore struct {
 	db *sql.DB
 }
 
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES ($1, $2, $3, $4) RETURNING id, createdAt, updatedAt
+		INSERT INTO posts (content, title, user_id, tags, status, publish_at, visibility)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, createdAt, updatedAt
 	`
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
-	err := s.db.QueryRowContext(ctx, query,
-		post.Content,
-		post.Title,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(
-		&post.ID,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
-
-	if err != nil {
-		return err
+	if post.Status == "" {
+		post.Status = PostStatusPublished
+	}
+	if post.Visibility == "" {
+		post.Visibility = VisibilityPublic
 	}
 
-	return nil
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+		err := tx.QueryRowContext(ctx, query,
+			post.Content,
+			post.Title,
+			post.UserID,
+			pq.Array(post.Tags),
+			post.Status,
+			post.PublishAt,
+			post.Visibility,
+		).Scan(
+			&post.ID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		if err := attachPostImages(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if err := setPostTags(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if err := setPostLinks(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if err := setPostMentions(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if post.Status == PostStatusPublished {
+			return enqueueFanout(ctx, tx, post.ID)
+		}
+
+		return nil
+	})
 }
 
 func (s *PostStore) GetByID(ctx context.Context, postID int64) (*Post, error) {
 	query := `
-		SELECT id, user_id, title, content, createdAt, updatedAt, tags, version
+		SELECT id, user_id, title, content, createdAt, updatedAt, tags, version, status, publish_at, visibility
 		FROM posts
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -81,6 +145,9 @@ func (s *PostStore) GetByID(ctx context.Context, postID int64) (*Post, error) {
 		&post.UpdatedAt,
 		pq.Array(&post.Tags),
 		&post.Version,
+		&post.Status,
+		&post.PublishAt,
+		&post.Visibility,
 	)
 
 	if err != nil {
@@ -95,21 +162,20 @@ func (s *PostStore) GetByID(ctx context.Context, postID int64) (*Post, error) {
 	return &post, nil
 }
 
-func (s *PostStore) Delete(ctx context.Context, postID int64) error {
+// Delete moves a post to the trash. deletedBy is the user performing the
+// deletion, which is how moderator removals are told apart from the author
+// deleting their own post.
+func (s *PostStore) Delete(ctx context.Context, postID, deletedBy int64) error {
 	query := `
-		DELETE FROM posts WHERE id = $1
+		UPDATE posts SET deleted_at = NOW(), deleted_by = $2
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	res, err := s.db.ExecContext(ctx, query, postID)
+	res, err := s.db.ExecContext(ctx, query, postID, deletedBy)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
-			return err
-		}
+		return err
 	}
 
 	rows, err := res.RowsAffected()
@@ -126,16 +192,153 @@ func (s *PostStore) Delete(ctx context.Context, postID int64) error {
 
 }
 
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
+// GetTrash lists the user's deleted posts that are still within the
+// retention window, most recently deleted first.
+func (s *PostStore) GetTrash(ctx context.Context, userID int64, retention time.Duration) ([]TrashedPost, error) {
+	query := `
+		SELECT id, user_id, title, content, createdAt, updatedAt, tags, version,
+			deleted_at, deleted_by, deleted_at + $2 * interval '1 second'
+		FROM posts
+		WHERE user_id = $1 AND deleted_at > NOW() - $2 * interval '1 second'
+		ORDER BY deleted_at DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, retention.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trash := []TrashedPost{}
+	for rows.Next() {
+		var p TrashedPost
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			pq.Array(&p.Tags),
+			&p.Version,
+			&p.DeletedAt,
+			&p.DeletedBy,
+			&p.PurgeAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		// deleted_by is unknown when the deleter's account is gone
+		p.DeletedByModerator = p.DeletedBy != nil && *p.DeletedBy != p.UserID
+		trash = append(trash, p)
+	}
+
+	return trash, rows.Err()
+}
+
+// Restore takes a post the user deleted themselves back out of the trash.
+// Posts removed by a moderator, or past the retention window, are not
+// restorable and report ErrNotFound.
+func (s *PostStore) Restore(ctx context.Context, postID, userID int64, retention time.Duration) error {
+	query := `
+		UPDATE posts SET deleted_at = NULL, deleted_by = NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_by = $2
+			AND deleted_at > NOW() - $3 * interval '1 second'
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, postID, userID, retention.Seconds())
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Purge hard-deletes posts that have been in the trash longer than the
+// retention window, batchSize posts at a time so that a large backlog
+// doesn't hold locks on the table for long. Their comments and revisions go
+// with them through the foreign keys. It returns how many posts it deleted.
+func (s *PostStore) Purge(ctx context.Context, retention time.Duration, batchSize int) (int64, error) {
+	query := `
+		DELETE FROM posts WHERE id IN (
+			SELECT id FROM posts
+			WHERE deleted_at < NOW() - $1 * interval '1 second'
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`
+
+	var purged int64
+	for {
+		n, err := func() (int64, error) {
+			ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+			defer cancel()
+
+			res, err := s.db.ExecContext(ctx, query, retention.Seconds(), batchSize)
+			if err != nil {
+				return 0, err
+			}
+			return res.RowsAffected()
+		}()
+		if err != nil {
+			return purged, err
+		}
+		purged += n
+
+		if n == 0 || n < int64(batchSize) {
+			return purged, nil
+		}
+	}
+}
+
+// Update writes the post's new title and content, keeping the version it
+// replaces in post_revisions. The version check makes concurrent edits fail
+// with ErrNotFound instead of silently overwriting each other.
+func (s *PostStore) Update(ctx context.Context, post *Post, editorID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := createPostRevision(ctx, tx, post.ID, post.Version, editorID); err != nil {
+			return err
+		}
+
+		if err := s.update(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if err := setPostTags(ctx, tx, post); err != nil {
+			return err
+		}
+
+		if err := setPostLinks(ctx, tx, post); err != nil {
+			return err
+		}
+
+		return setPostMentions(ctx, tx, post)
+	})
+}
+
+func (s *PostStore) update(ctx context.Context, tx *sql.Tx, post *Post) error {
 	query := `
 		UPDATE posts
-		SET title = $1, content = $2, version = version + 1
-		WHERE id = $3 AND version = $4
-		RETURNING version
+		SET title = $1, content = $2, visibility = $5, tags = $6, version = version + 1, updatedAt = NOW()
+		WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+		RETURNING version, updatedAt
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	err := s.db.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
+	err := tx.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version, post.Visibility, pq.Array(post.Tags)).Scan(&post.Version, &post.UpdatedAt)
 
 	if err != nil {
 		switch {
@@ -149,67 +352,259 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	return nil
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, PageInfo, error) {
+	keyset, order := fq.keyset("p", "$6", "$7")
 	query := `
-		SELECT 
-		p.id, p.user_id, p.title, p.content, p.createdat, p.version, p.tags, u.username,COUNT(c.id) AS comments_count
+		SELECT ` + feedPostColumns + `
 		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
 		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
 		WHERE 
-			f.user_id = $1 AND
+			(p.user_id = $1 OR EXISTS (
+				SELECT 1 FROM followers f WHERE f.user_id = p.user_id AND f.follower_id = $1
+			) OR EXISTS (
+				SELECT 1 FROM post_tags pt
+				JOIN tag_followers tf ON tf.tag_id = pt.tag_id
+				WHERE pt.post_id = p.id AND tf.user_id = $1
+			)) AND
+			p.deleted_at IS NULL AND
+			p.status = 'published' AND
+			` + postVisibleTo("p", "$1") + ` AND
 			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-			(p.tags @> $5 OR $5 = '{}')
-		GROUP BY p.id, u.username
-		ORDER BY p.createdat ` + fq.Sort + `
+			` + hasAllTags("p", "$5") + ` AND
+			` + fq.timeWindow("p", "$8", "$9") + ` AND
+			` + keyset + `
+		ORDER BY ` + order + `
 		LIMIT $2 OFFSET $3
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	// one more than asked for tells whether there is a next page
+	cursorTime, cursorID := fq.keysetArgs()
+	since, until := fq.timeWindowArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit+1, fq.offset(), fq.Search, pq.Array(fq.Tags), cursorTime, cursorID, since, until)
 	if err != nil {
-		return nil, err
+		return nil, PageInfo{}, err
 	}
 
 	defer rows.Close()
 
-	var feed []PostWithMetadata
+	feed := []PostWithMetadata{}
 	for rows.Next() {
 		var p PostWithMetadata
-		err := rows.Scan(
-			&p.ID,
-			&p.UserID,
-			&p.Title,
-			&p.Content,
-			&p.CreatedAt,
-			&p.Version,
-			pq.Array(&p.Tags),
-			&p.User.Username,
-			&p.CommentsCount,
-		)
-		if err != nil {
-			return nil, err
+		if err := scanFeedPost(rows, &p); err != nil {
+			return nil, PageInfo{}, err
 		}
 		feed = append(feed, p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
 
-	return feed, nil
+	return paginate(fq, feed)
+}
 
+// GetMentioning lists the published posts that mention the user, or that
+// have a comment mentioning them, and that they are allowed to see, newest
+// first unless fq says otherwise. Posts and comments by users they blocked
+// are left out.
+func (s *PostStore) GetMentioning(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, PageInfo, error) {
+	keyset, order := fq.keyset("p", "$4", "$5")
+	query := `
+		SELECT ` + feedPostColumns + `
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			p.id IN (
+				SELECT m.post_id FROM post_mentions m WHERE m.user_id = $1
+				UNION
+				SELECT c.post_id
+				FROM comment_mentions cm
+				JOIN comments c ON c.id = cm.comment_id
+				WHERE cm.user_id = $1 AND NOT EXISTS (
+					SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = c.user_id
+				)
+			) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = p.user_id
+			) AND
+			p.deleted_at IS NULL AND
+			p.status = 'published' AND
+			` + postVisibleTo("p", "$1") + ` AND
+			` + fq.timeWindow("p", "$6", "$7") + ` AND
+			` + keyset + `
+		ORDER BY ` + order + `
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorTime, cursorID := fq.keysetArgs()
+	since, until := fq.timeWindowArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit+1, fq.offset(), cursorTime, cursorID, since, until)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		if err := scanFeedPost(rows, &p); err != nil {
+			return nil, PageInfo{}, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	return paginate(fq, posts)
 }
 
-func (s *PostStore) PostImage(ctx context.Context, image string) error {
+// GetByTag lists the published posts carrying a normalised tag that the
+// user is allowed to see.
+func (s *PostStore) GetByTag(ctx context.Context, userID int64, tag string, fq PaginatedFeedQuery) ([]PostWithMetadata, PageInfo, error) {
+	keyset, order := fq.keyset("p", "$5", "$6")
 	query := `
-		INSERT INTO images (url)
-		VALUES ($1)
+		SELECT ` + feedPostColumns + `
+		FROM tags t
+		JOIN post_tags pt ON pt.tag_id = t.id
+		JOIN posts p ON p.id = pt.post_id
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			t.name = $2 AND
+			p.deleted_at IS NULL AND
+			p.status = 'published' AND
+			` + postVisibleTo("p", "$1") + ` AND
+			` + fq.timeWindow("p", "$7", "$8") + ` AND
+			` + keyset + `
+		ORDER BY ` + order + `
+		LIMIT $3 OFFSET $4
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
-	_, err := s.db.ExecContext(ctx, query, image)
+
+	cursorTime, cursorID := fq.keysetArgs()
+	since, until := fq.timeWindowArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, tag, fq.Limit+1, fq.offset(), cursorTime, cursorID, since, until)
 	if err != nil {
-		return err
+		return nil, PageInfo{}, err
 	}
+	defer rows.Close()
 
-	return nil
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		if err := scanFeedPost(rows, &p); err != nil {
+			return nil, PageInfo{}, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	return paginate(fq, posts)
+}
+
+// GetByUser lists the author's published posts that the user is allowed
+// to see, newest first unless fq says otherwise.
+func (s *PostStore) GetByUser(ctx context.Context, userID, authorID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, PageInfo, error) {
+	keyset, order := fq.keyset("p", "$7", "$8")
+	query := `
+		SELECT ` + feedPostColumns + `
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			p.user_id = $2 AND
+			p.deleted_at IS NULL AND
+			p.status = 'published' AND
+			` + postVisibleTo("p", "$1") + ` AND
+			(p.title ILIKE '%' || $5 || '%' OR p.content ILIKE '%' || $5 || '%') AND
+			` + hasAllTags("p", "$6") + ` AND
+			` + fq.timeWindow("p", "$9", "$10") + ` AND
+			` + keyset + `
+		ORDER BY ` + order + `
+		LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	cursorTime, cursorID := fq.keysetArgs()
+	since, until := fq.timeWindowArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, authorID, fq.Limit+1, fq.offset(), fq.Search, pq.Array(fq.Tags), cursorTime, cursorID, since, until)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		if err := scanFeedPost(rows, &p); err != nil {
+			return nil, PageInfo{}, err
+		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	return paginate(fq, posts)
+}
+
+// GetExplore lists the most popular public posts created in the last
+// window, from anyone but the authors the user blocked. Popularity is
+// engagement divided by age raised to gravity, so new posts get a chance
+// against older ones with more comments and reactions. A comment counts as
+// commentWeight reactions, as in the ranked feed. fq's filters apply, its
+// sort order is that of the popularity and it pages by offset only.
+func (s *PostStore) GetExplore(ctx context.Context, userID int64, window time.Duration, gravity, commentWeight float64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	query := `
+		SELECT ` + feedPostColumns + `
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN LATERAL (
+			SELECT
+				(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+				(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions_count
+		) e
+		WHERE
+			p.createdat >= NOW() - $4 * interval '1 second' AND
+			p.visibility = 'public' AND
+			p.deleted_at IS NULL AND
+			p.status = 'published' AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = p.user_id
+			) AND
+			(p.title ILIKE '%' || $6 || '%' OR p.content ILIKE '%' || $6 || '%') AND
+			` + hasAllTags("p", "$7") + ` AND
+			` + fq.timeWindow("p", "$8", "$9") + `
+		ORDER BY
+			(e.comments_count * $10::float8 + e.reactions_count + 1) /
+			POWER(EXTRACT(EPOCH FROM NOW() - p.createdat) / 3600 + 2, $5) ` + fq.direction() + `,
+			p.id ` + fq.direction() + `
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	since, until := fq.timeWindowArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, window.Seconds(), gravity, fq.Search, pq.Array(fq.Tags), since, until, commentWeight)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+	for rows.Next() {
+		var p PostWithMetadata
+		if err := scanFeedPost(rows, &p); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
 }
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestPurge(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	s := NewStorage(db)
+
+	alice := createTestUser(t, db, "alice")
+
+	post := func(deletedHoursAgo int) int64 {
+		p := &Post{UserID: alice, Title: "t", Content: "c", Visibility: VisibilityPublic}
+		if err := s.Posts.Create(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		if deletedHoursAgo >= 0 {
+			query := `UPDATE posts SET deleted_at = NOW() - $2 * interval '1 hour' WHERE id = $1`
+			if _, err := db.ExecContext(ctx, query, p.ID, deletedHoursAgo); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return p.ID
+	}
+
+	var expired []int64
+	for i := 0; i < 5; i++ {
+		expired = append(expired, post(48))
+	}
+	trashed := post(1)
+	live := post(-1)
+
+	// more expired posts than fit in a batch, and not a multiple of it
+	purged, err := s.Posts.Purge(ctx, 24*time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged < int64(len(expired)) {
+		t.Errorf("Purge() = %d, want at least %d", purged, len(expired))
+	}
+
+	ids := []int64{}
+	query := `SELECT id FROM posts WHERE id = ANY($1) ORDER BY id`
+	rows, err := db.QueryContext(ctx, query, pq.Array(append(expired, trashed, live)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int64{trashed, live}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("posts left = %v, want %v", ids, want)
+	}
+}
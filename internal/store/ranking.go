@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// RankingCandidate is a post that may go into a user's ranked feed, with
+// what it is ranked on.
+type RankingCandidate struct {
+	PostWithMetadata
+	ReactionsCount int
+	// Interactions counts the user's comments and reactions on the
+	// author's posts and their mentions of the author since the time
+	// passed to GetRankingCandidates.
+	Interactions int
+	// Source is how the post reached the user: "self", "follow", "tag" or
+	// "follow_of_follow".
+	Source string
+}
+
+// GetRankingCandidates returns up to limit of the newest posts created
+// since that the user can see, from themselves, the accounts and tags they
+// follow and the accounts followed by the accounts they follow. Authors the
+// user blocked are left out.
+func (s *PostStore) GetRankingCandidates(ctx context.Context, userID int64, since, interactionsSince time.Time, limit int) ([]RankingCandidate, error) {
+	query := `
+		WITH follows AS (
+			SELECT user_id FROM followers WHERE follower_id = $1
+		), follows_of_follows AS (
+			SELECT DISTINCT f.user_id FROM followers f
+			JOIN follows ON follows.user_id = f.follower_id
+			WHERE f.user_id <> $1 AND f.user_id NOT IN (SELECT user_id FROM follows)
+		), candidates AS (
+			SELECT p.id,
+				CASE
+					WHEN p.user_id = $1 THEN 'self'
+					WHEN p.user_id IN (SELECT user_id FROM follows) THEN 'follow'
+					WHEN EXISTS (
+						SELECT 1 FROM post_tags pt
+						JOIN tag_followers tf ON tf.tag_id = pt.tag_id
+						WHERE pt.post_id = p.id AND tf.user_id = $1
+					) THEN 'tag'
+					ELSE 'follow_of_follow'
+				END AS source
+			FROM posts p
+			WHERE
+				(p.user_id = $1 OR
+				p.user_id IN (SELECT user_id FROM follows) OR
+				p.user_id IN (SELECT user_id FROM follows_of_follows) OR
+				EXISTS (
+					SELECT 1 FROM post_tags pt
+					JOIN tag_followers tf ON tf.tag_id = pt.tag_id
+					WHERE pt.post_id = p.id AND tf.user_id = $1
+				)) AND
+				p.createdat >= $2 AND
+				p.deleted_at IS NULL AND
+				p.status = 'published' AND
+				` + postVisibleTo("p", "$1") + ` AND
+				NOT EXISTS (
+					SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = p.user_id
+				)
+			ORDER BY p.createdat DESC, p.id DESC
+			LIMIT $3
+		), interactions AS (
+			SELECT author_id, COUNT(*) AS n FROM (
+				SELECT p.user_id AS author_id FROM comments c
+				JOIN posts p ON p.id = c.post_id
+				WHERE c.user_id = $1 AND c.createdat >= $4
+				UNION ALL
+				SELECT p.user_id FROM post_reactions r
+				JOIN posts p ON p.id = r.post_id
+				WHERE r.user_id = $1 AND r.created_at >= $4
+				UNION ALL
+				SELECT m.user_id FROM post_mentions m
+				JOIN posts p ON p.id = m.post_id
+				WHERE p.user_id = $1 AND p.createdat >= $4
+			) i
+			WHERE author_id <> $1
+			GROUP BY author_id
+		)
+		SELECT
+			` + feedPostColumns + `,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id),
+			COALESCE(i.n, 0),
+			cand.source
+		FROM candidates cand
+		JOIN posts p ON p.id = cand.id
+		LEFT JOIN users u ON u.id = p.user_id
+		LEFT JOIN interactions i ON i.author_id = p.user_id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, since, limit, interactionsSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []RankingCandidate{}
+	for rows.Next() {
+		var c RankingCandidate
+		if err := scanFeedPost(rows, &c.PostWithMetadata, &c.ReactionsCount, &c.Interactions, &c.Source); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+
+	return candidates, rows.Err()
+}
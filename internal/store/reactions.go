@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Set records the user's reaction to the post, replacing any earlier one.
+func (s *ReactionStore) Set(ctx context.Context, postID, userID int64, reaction string) error {
+	query := `
+		INSERT INTO post_reactions (post_id, user_id, reaction) VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, user_id) DO UPDATE
+		SET reaction = EXCLUDED.reaction, created_at = NOW()
+		WHERE post_reactions.reaction <> EXCLUDED.reaction
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, query, postID, userID, reaction); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *ReactionStore) Remove(ctx context.Context, postID, userID int64) error {
+	query := `
+		DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID)
+
+	return err
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// PostRevision is a snapshot of a post as it was before an update replaced
+// it. EditedBy is the user whose update superseded this version.
+type PostRevision struct {
+	ID        int64  `json:"id"`
+	PostID    int64  `json:"post_id"`
+	Version   int    `json:"version"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	EditedBy  int64  `json:"edited_by"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type PostRevisionStore struct {
+	db *sql.DB
+}
+
+func createPostRevision(ctx context.Context, tx *sql.Tx, postID int64, version int, editorID int64) error {
+	query := `
+		INSERT INTO post_revisions (post_id, version, title, content, edited_by)
+		SELECT id, version, title, content, $3
+		FROM posts
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, postID, version, editorID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PostRevisionStore) GetByPostID(ctx context.Context, postID int64) ([]PostRevision, error) {
+	query := `
+		SELECT id, post_id, version, title, content, COALESCE(edited_by, 0), createdAt
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY version DESC
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		err := rows.Scan(
+			&rev.ID,
+			&rev.PostID,
+			&rev.Version,
+			&rev.Title,
+			&rev.Content,
+			&rev.EditedBy,
+			&rev.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *PostRevisionStore) GetByVersion(ctx context.Context, postID int64, version int) (*PostRevision, error) {
+	query := `
+		SELECT id, post_id, version, title, content, COALESCE(edited_by, 0), createdAt
+		FROM post_revisions
+		WHERE post_id = $1 AND version = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var rev PostRevision
+	err := s.db.QueryRowContext(ctx, query, postID, version).Scan(
+		&rev.ID,
+		&rev.PostID,
+		&rev.Version,
+		&rev.Title,
+		&rev.Content,
+		&rev.EditedBy,
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rev, nil
+}
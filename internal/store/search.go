@@ -0,0 +1,384 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+	"github.com/supremed3v/social-media/internal/search"
+)
+
+// SearchQuery is a full-text search. The embedded feed query supplies the
+// paging and the tag and time filters; Cursor isn't supported.
+type SearchQuery struct {
+	PaginatedFeedQuery
+	// Query is a tsquery built by search.Parse.
+	Query    string
+	AuthorID *int64
+	// Recent orders results newest first instead of by relevance.
+	Recent bool
+}
+
+// order returns the ORDER BY list for results with the given rank and
+// creation time expressions.
+func (q SearchQuery) order(rank, createdAt, id string) string {
+	if q.Recent {
+		return createdAt + " DESC, " + id + " DESC"
+	}
+	return rank + " DESC, " + createdAt + " DESC, " + id + " DESC"
+}
+
+// PostHighlights are HTML snippets of the text that matched a search, with
+// the matching words in <mark>.
+type PostHighlights struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+type PostSearchResult struct {
+	PostWithMetadata
+	Rank       float64        `json:"rank"`
+	Highlights PostHighlights `json:"highlights"`
+}
+
+type CommentSearchResult struct {
+	Comment
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight"`
+}
+
+type UserSearchResult struct {
+	ID          int64   `json:"id"`
+	Username    string  `json:"username"`
+	DisplayName string  `json:"display_name"`
+	AvatarID    *int64  `json:"avatar_id"`
+	Similarity  float64 `json:"similarity"`
+}
+
+// Suggestions complete what a user is typing after an @ or a #.
+type Suggestions struct {
+	Users []UserSuggestion `json:"users"`
+	Tags  []TagSuggestion  `json:"tags"`
+}
+
+type UserSuggestion struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarID    *int64 `json:"avatar_id"`
+	Following   bool   `json:"following"`
+	FollowsYou  bool   `json:"follows_you"`
+	Followers   int    `json:"followers_count"`
+}
+
+type TagSuggestion struct {
+	Name      string `json:"name"`
+	Posts     int    `json:"posts_count"`
+	Following bool   `json:"following"`
+}
+
+// Snippets are up to this many fragments of about this many words.
+const (
+	snippetWords     = 30
+	snippetFragments = 2
+)
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+// Posts searches the titles, tags and content of the published posts the
+// user can see, leaving out authors they blocked.
+func (s *SearchStore) Posts(ctx context.Context, userID int64, q SearchQuery) ([]PostSearchResult, error) {
+	query := `
+		WITH matches AS (
+			SELECT p.id, ts_rank(p.search_vector, tq.query, 1) AS rank, p.createdat
+			FROM posts p
+			CROSS JOIN to_tsquery($4::regconfig, $5) AS tq(query)
+			WHERE
+				p.search_vector @@ tq.query AND
+				p.deleted_at IS NULL AND
+				p.status = 'published' AND
+				` + postVisibleTo("p", "$1") + ` AND
+				NOT EXISTS (
+					SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = p.user_id
+				) AND
+				($6::bigint IS NULL OR p.user_id = $6) AND
+				` + hasAllTags("p", "$7") + ` AND
+				` + q.timeWindow("p", "$8", "$9") + `
+			ORDER BY ` + q.order("rank", "p.createdat", "p.id") + `
+			LIMIT $2 OFFSET $3
+		)
+		SELECT
+			` + feedPostColumns + `,
+			m.rank,
+			ts_headline($4::regconfig, translate(p.title, $10, ''), to_tsquery($4::regconfig, $5), $11),
+			ts_headline($4::regconfig, translate(p.content, $10, ''), to_tsquery($4::regconfig, $5), $12)
+		FROM matches m
+		JOIN posts p ON p.id = m.id
+		JOIN users u ON u.id = p.user_id
+		ORDER BY ` + q.order("m.rank", "m.createdat", "m.id") + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	since, until := q.timeWindowArgs()
+	rows, err := s.db.QueryContext(ctx, query,
+		userID,
+		q.Limit,
+		q.Offset,
+		search.Config,
+		q.Query,
+		q.AuthorID,
+		pq.Array(q.Tags),
+		since,
+		until,
+		search.Markers,
+		search.HeadlineOptions(0, 0),
+		search.HeadlineOptions(snippetWords, snippetFragments),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+	for rows.Next() {
+		var r PostSearchResult
+		err := scanFeedPost(rows, &r.PostWithMetadata, &r.Rank, &r.Highlights.Title, &r.Highlights.Content)
+		if err != nil {
+			return nil, err
+		}
+		r.Highlights.Title = search.Highlight(r.Highlights.Title)
+		r.Highlights.Content = search.Highlight(r.Highlights.Content)
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// Comments searches the comments on the published posts the user can see,
+// leaving out commenters they blocked. Tags filter by the post commented
+// on, the time window and author by the comment.
+func (s *SearchStore) Comments(ctx context.Context, userID int64, q SearchQuery) ([]CommentSearchResult, error) {
+	query := `
+		WITH matches AS (
+			SELECT c.id, ts_rank(c.search_vector, tq.query, 1) AS rank, c.createdat
+			FROM comments c
+			JOIN posts p ON p.id = c.post_id
+			CROSS JOIN to_tsquery($4::regconfig, $5) AS tq(query)
+			WHERE
+				c.search_vector @@ tq.query AND
+				p.deleted_at IS NULL AND
+				p.status = 'published' AND
+				` + postVisibleTo("p", "$1") + ` AND
+				NOT EXISTS (
+					SELECT 1 FROM user_blocks b WHERE b.blocker_id = $1 AND b.blocked_id = c.user_id
+				) AND
+				($6::bigint IS NULL OR c.user_id = $6) AND
+				` + hasAllTags("p", "$7") + ` AND
+				` + q.timeWindow("c", "$8", "$9") + `
+			ORDER BY ` + q.order("rank", "c.createdat", "c.id") + `
+			LIMIT $2 OFFSET $3
+		)
+		SELECT
+			c.id, c.post_id, c.user_id, c.content, c.createdat, u.id, u.username,
+			m.rank,
+			ts_headline($4::regconfig, translate(c.content, $10, ''), to_tsquery($4::regconfig, $5), $11)
+		FROM matches m
+		JOIN comments c ON c.id = m.id
+		JOIN users u ON u.id = c.user_id
+		ORDER BY ` + q.order("m.rank", "m.createdat", "m.id") + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	since, until := q.timeWindowArgs()
+	rows, err := s.db.QueryContext(ctx, query,
+		userID,
+		q.Limit,
+		q.Offset,
+		search.Config,
+		q.Query,
+		q.AuthorID,
+		pq.Array(q.Tags),
+		since,
+		until,
+		search.Markers,
+		search.HeadlineOptions(snippetWords, snippetFragments),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []CommentSearchResult{}
+	for rows.Next() {
+		var r CommentSearchResult
+		err := rows.Scan(
+			&r.ID,
+			&r.PostID,
+			&r.UserID,
+			&r.Content,
+			&r.CreatedAt,
+			&r.User.ID,
+			&r.User.Username,
+			&r.Rank,
+			&r.Highlight,
+		)
+		if err != nil {
+			return nil, err
+		}
+		r.Highlight = search.Highlight(r.Highlight)
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// Users finds active users whose username or display name is similar to
+// name or starts with it. Exact usernames come first. Users who blocked
+// userID are left out.
+func (s *SearchStore) Users(ctx context.Context, userID int64, name string, limit, offset int) ([]UserSearchResult, error) {
+	query := `
+		SELECT
+			u.id, u.username, u.display_name, u.avatar_image_id,
+			GREATEST(similarity(u.username, $4), similarity(u.display_name, $4)) AS score
+		FROM users u
+		WHERE
+			u.is_active = true AND
+			(
+				u.username % $4 OR
+				u.display_name % $4 OR
+				u.username ILIKE $5 || '%' OR
+				u.display_name ILIKE $5 || '%'
+			) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b WHERE b.blocker_id = u.id AND b.blocked_id = $1
+			)
+		ORDER BY lower(u.username) = lower($4) DESC, score DESC, u.username
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit, offset, name, escapeLike(name))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserSearchResult{}
+	for rows.Next() {
+		var u UserSearchResult
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarID, &u.Similarity); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// minWordPrefix is how many characters it takes to complete any word of a
+// display name rather than just its start. Shorter prefixes would match
+// too many names for the trigram index to help.
+const minWordPrefix = 3
+
+// SuggestUsers completes a username or display name from its first
+// characters, or those of any word of the display name once there are
+// minWordPrefix of them. The accounts the user follows come first, then
+// those following them, then the most followed. Blocked users either way
+// are left out.
+func (s *SearchStore) SuggestUsers(ctx context.Context, userID int64, prefix string, limit int) ([]UserSuggestion, error) {
+	// the prefix conditions match the text_pattern_ops indexes from 000039
+	words := "false"
+	if utf8.RuneCountInString(prefix) >= minWordPrefix {
+		words = `u.display_name ILIKE '% ' || $2 || '%'`
+	}
+
+	query := `
+		SELECT
+			u.id, u.username, u.display_name, u.avatar_image_id,
+			EXISTS (SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $1) AS following,
+			EXISTS (SELECT 1 FROM followers f WHERE f.user_id = $1 AND f.follower_id = u.id) AS follows_you,
+			u.followers_count
+		FROM users u
+		WHERE
+			u.is_active = true AND
+			u.id <> $1 AND
+			(
+				lower(u.username) LIKE lower($2) || '%' OR
+				lower(u.display_name) LIKE lower($2) || '%' OR
+				` + words + `
+			) AND
+			NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = u.id AND b.blocked_id = $1) OR (b.blocker_id = $1 AND b.blocked_id = u.id)
+			)
+		ORDER BY following DESC, follows_you DESC, u.followers_count DESC, u.username
+		LIMIT $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, escapeLike(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserSuggestion{}
+	for rows.Next() {
+		var u UserSuggestion
+		err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarID, &u.Following, &u.FollowsYou, &u.Followers)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// SuggestTags completes a normalised tag from its first characters. Tags
+// the user follows come first, then the most used.
+func (s *SearchStore) SuggestTags(ctx context.Context, userID int64, prefix string, limit int) ([]TagSuggestion, error) {
+	query := `
+		SELECT
+			t.name,
+			(SELECT COUNT(*) FROM post_tags pt WHERE pt.tag_id = t.id) AS posts_count,
+			EXISTS (SELECT 1 FROM tag_followers tf WHERE tf.tag_id = t.id AND tf.user_id = $1) AS following
+		FROM tags t
+		WHERE t.name LIKE $2 || '%'
+		ORDER BY following DESC, posts_count DESC, t.name
+		LIMIT $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, escapeLike(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagSuggestion{}
+	for rows.Next() {
+		var t TagSuggestion
+		if err := rows.Scan(&t.Name, &t.Posts, &t.Following); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// escapeLike escapes the characters LIKE treats specially, so s only
+// matches itself.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -15,18 +15,34 @@ var (
 
 type Storage struct {
 	Posts interface {
-		Delete(context.Context, int64) error
+		Delete(ctx context.Context, postID, deletedBy int64) error
+		GetTrash(ctx context.Context, userID int64, retention time.Duration) ([]TrashedPost, error)
+		Restore(ctx context.Context, postID, userID int64, retention time.Duration) error
+		Purge(ctx context.Context, retention time.Duration, batchSize int) (int64, error)
 		GetByID(context.Context, int64) (*Post, error)
+		CanView(ctx context.Context, post *Post, userID int64) (bool, error)
 		Create(context.Context, *Post) error
-		Update(context.Context, *Post) error
-		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
-		PostImage(ctx context.Context, image string) error
+		Update(ctx context.Context, post *Post, editorID int64) error
+		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, PageInfo, error)
+		GetRankingCandidates(ctx context.Context, userID int64, since, interactionsSince time.Time, limit int) ([]RankingCandidate, error)
+		GetByIDs(ctx context.Context, userID int64, ids []int64) ([]PostWithMetadata, error)
+		GetMentioning(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, PageInfo, error)
+		GetByTag(ctx context.Context, userID int64, tag string, fq PaginatedFeedQuery) ([]PostWithMetadata, PageInfo, error)
+		GetByUser(ctx context.Context, userID, authorID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, PageInfo, error)
+		GetExplore(ctx context.Context, userID int64, window time.Duration, gravity, commentWeight float64, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetDrafts(ctx context.Context, userID int64) ([]Post, error)
+		Schedule(ctx context.Context, post *Post, publishAt time.Time) error
+		Unschedule(ctx context.Context, post *Post) error
+		Publish(ctx context.Context, post *Post) error
+		PublishScheduled(ctx context.Context) ([]Post, error)
 	}
 	Users interface {
 		Activate(context.Context, string) error
 		Create(context.Context, *sql.Tx, *User) error
 		GetByID(context.Context, int64) (*User, error)
 		GetByEmail(context.Context, string) (*User, error)
+		SetAvatar(ctx context.Context, user *User, imageID *int64) error
+		SetDisplayName(ctx context.Context, user *User, name string) error
 		CreateAndInvite(ctx context.Context, user *User, token string, exp time.Duration) error
 		Delete(context.Context, int64) error
 	}
@@ -34,22 +50,112 @@ type Storage struct {
 		Create(context.Context, *Comment) error
 		GetByPostID(context.Context, int64) ([]Comment, error)
 	}
+	Reactions interface {
+		Set(ctx context.Context, postID, userID int64, reaction string) error
+		Remove(ctx context.Context, postID, userID int64) error
+	}
 	Followers interface {
 		Follow(ctx context.Context, followerID, userID int64) error
 		UnFollow(ctx context.Context, followerID, userID int64) error
 	}
+	Blocks interface {
+		Block(ctx context.Context, blockerID, blockedID int64) error
+		Unblock(ctx context.Context, blockerID, blockedID int64) error
+	}
+	Mentions interface {
+		GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64]map[string]int64, error)
+		GetByCommentIDs(ctx context.Context, commentIDs []int64) (map[int64]map[string]int64, error)
+	}
+	Tags interface {
+		GetByName(ctx context.Context, name string, userID int64) (*Tag, error)
+		Follow(ctx context.Context, userID int64, name string) error
+		Unfollow(ctx context.Context, userID int64, name string) error
+		Trending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error)
+		Renormalize(ctx context.Context, batchSize int) (int, error)
+	}
+	Timelines interface {
+		GetEntries(ctx context.Context, userID int64, maxFollowers, limit int) ([]TimelineEntry, error)
+		GetLargeAccountEntries(ctx context.Context, userID int64, maxFollowers int, horizon *time.Time, fq PaginatedFeedQuery) ([]TimelineEntry, error)
+		GetLargeAccountsFollowed(ctx context.Context, userID int64, maxFollowers int) ([]int64, error)
+		ClaimFanout(ctx context.Context, lease time.Duration, maxAttempts int) (*FanoutJob, error)
+		Recipients(ctx context.Context, job *FanoutJob, maxFollowers int) ([]int64, error)
+		FinishFanout(ctx context.Context, job *FanoutJob) error
+		FailFanout(ctx context.Context, job *FanoutJob, reason string, retryAfter time.Duration) error
+	}
+	LinkPreviews interface {
+		GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]LinkPreview, error)
+		ClaimPending(ctx context.Context, lease time.Duration, maxAttempts int) (*LinkPreview, error)
+		Finish(ctx context.Context, preview *LinkPreview, ttl time.Duration) error
+		Fail(ctx context.Context, preview *LinkPreview, reason string, permanent bool, retryAfter time.Duration, maxAttempts int, ttl time.Duration) error
+	}
+	Syndication interface {
+		GetFeed(ctx context.Context, userID int64, limit int) (*SyndicatedFeed, error)
+		SetEnabled(ctx context.Context, userID int64, enabled bool) error
+	}
+	Notifications interface {
+		Add(ctx context.Context, e NotificationEvent) (*Notification, error)
+		Retract(ctx context.Context, e NotificationEvent) error
+		GetByID(ctx context.Context, userID, id int64) (*Notification, error)
+		List(ctx context.Context, userID int64, unreadOnly bool, fq PaginatedFeedQuery) ([]Notification, PageInfo, error)
+		UnreadCount(ctx context.Context, userID int64) (int, error)
+		MarkRead(ctx context.Context, userID, id int64) error
+		MarkAllRead(ctx context.Context, userID int64) (int64, error)
+	}
+	Search interface {
+		Posts(ctx context.Context, userID int64, q SearchQuery) ([]PostSearchResult, error)
+		Comments(ctx context.Context, userID int64, q SearchQuery) ([]CommentSearchResult, error)
+		Users(ctx context.Context, userID int64, name string, limit, offset int) ([]UserSearchResult, error)
+		SuggestUsers(ctx context.Context, userID int64, prefix string, limit int) ([]UserSuggestion, error)
+		SuggestTags(ctx context.Context, userID int64, prefix string, limit int) ([]TagSuggestion, error)
+	}
 	Roles interface {
 		GetByName(context.Context, string) (*Role, error)
 	}
+	Images interface {
+		Create(context.Context, *Image) error
+		GetByID(context.Context, int64) (*Image, error)
+		GetByHash(ctx context.Context, userID int64, sha256 string) (*Image, error)
+		CollectGarbage(ctx context.Context, gracePeriod time.Duration, limit int) (int64, error)
+		PendingBlobDeletions(ctx context.Context, limit int) ([]string, error)
+		ClearBlobDeletions(ctx context.Context, keys []string) error
+		ClaimProcessing(ctx context.Context, lease time.Duration, maxAttempts int) (*Image, error)
+		FinishProcessing(context.Context, *Image) error
+		FailProcessing(ctx context.Context, image *Image, reason string, permanent bool, retryAfter time.Duration, maxAttempts int) error
+		GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]Image, error)
+	}
+	UploadSessions interface {
+		Create(ctx context.Context, session *UploadSession, ttl time.Duration) error
+		GetByID(context.Context, string) (*UploadSession, error)
+		Advance(ctx context.Context, session *UploadSession, offset int64, ttl time.Duration) error
+		Complete(ctx context.Context, session *UploadSession, image *Image) error
+		Delete(context.Context, string) error
+		DeleteExpired(context.Context) ([]string, error)
+	}
+	Revisions interface {
+		GetByPostID(context.Context, int64) ([]PostRevision, error)
+		GetByVersion(ctx context.Context, postID int64, version int) (*PostRevision, error)
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		Comments:  &CommentStore{db},
-		Followers: &FollowerStore{db},
-		Roles:     &RoleStore{db},
+		Posts:          &PostStore{db},
+		Users:          &UserStore{db},
+		Comments:       &CommentStore{db},
+		Reactions:      &ReactionStore{db},
+		Followers:      &FollowerStore{db},
+		Blocks:         &BlockStore{db},
+		Mentions:       &MentionStore{db},
+		Tags:           &TagStore{db},
+		Timelines:      &TimelineStore{db},
+		LinkPreviews:   &LinkPreviewStore{db},
+		Syndication:    &SyndicationStore{db},
+		Search:         &SearchStore{db},
+		Notifications:  &NotificationStore{db},
+		Roles:          &RoleStore{db},
+		Revisions:      &PostRevisionStore{db},
+		Images:         &ImageStore{db},
+		UploadSessions: &UploadSessionStore{db},
 	}
 }
 
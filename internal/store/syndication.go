@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// SyndicatedFeed is what goes into a user's RSS, Atom and JSON feeds.
+type SyndicatedFeed struct {
+	UserID   int64
+	Username string
+	// JoinedAt is when the user signed up, which stands in for when the
+	// feed last changed while there are no posts.
+	JoinedAt string
+	// Posts are the newest public posts, newest first.
+	Posts []Post
+}
+
+type SyndicationStore struct {
+	db *sql.DB
+}
+
+// GetFeed returns up to limit of the user's newest public posts. It returns
+// ErrNotFound for users that don't exist, aren't activated or turned their
+// feeds off.
+func (s *SyndicationStore) GetFeed(ctx context.Context, userID int64, limit int) (*SyndicatedFeed, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	feed := SyndicatedFeed{UserID: userID, Posts: []Post{}}
+
+	query := `SELECT username, createdAt FROM users WHERE id = $1 AND is_active AND feeds_enabled`
+	if err := s.db.QueryRowContext(ctx, query, userID).Scan(&feed.Username, &feed.JoinedAt); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		SELECT id, user_id, title, content, createdAt, updatedAt, tags, version, status, visibility
+		FROM posts
+		WHERE user_id = $1 AND visibility = 'public' AND status = 'published' AND deleted_at IS NULL
+		ORDER BY createdAt DESC, id DESC
+		LIMIT $2
+	`
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			pq.Array(&p.Tags),
+			&p.Version,
+			&p.Status,
+			&p.Visibility,
+		)
+		if err != nil {
+			return nil, err
+		}
+		feed.Posts = append(feed.Posts, p)
+	}
+
+	return &feed, rows.Err()
+}
+
+// SetEnabled turns the user's feeds on or off.
+func (s *SyndicationStore) SetEnabled(ctx context.Context, userID int64, enabled bool) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `UPDATE users SET feeds_enabled = $2 WHERE id = $1`, userID, enabled)
+	return err
+}
@@ -0,0 +1,333 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/supremed3v/social-media/internal/hashtag"
+)
+
+type Tag struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Posts     int    `json:"posts_count"`
+	Followers int    `json:"followers_count"`
+	Following bool   `json:"following"`
+	CreatedAt string `json:"created_at"`
+}
+
+// TrendingTag is a tag's activity in the latest window compared with the
+// window before it.
+type TrendingTag struct {
+	Name          string  `json:"name"`
+	Posts         int     `json:"posts_count"`
+	Authors       int     `json:"authors_count"`
+	PreviousPosts int     `json:"previous_posts_count"`
+	Score         float64 `json:"score"`
+}
+
+// setPostTags links the post to its explicit tags and the hashtags in its
+// content, creating tags seen for the first time.
+func setPostTags(ctx context.Context, tx *sql.Tx, post *Post) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_tags WHERE post_id = $1`, post.ID); err != nil {
+		return err
+	}
+
+	tags := hashtag.Merge(post.Tags, hashtag.Extract(post.Content))
+	if len(tags) == 0 {
+		return nil
+	}
+
+	query := `INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(tags)); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO post_tags (post_id, tag_id)
+		SELECT $1, id FROM tags WHERE name = ANY($2)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, post.ID, pq.Array(tags))
+
+	return err
+}
+
+// hasAllTags returns a SQL condition that holds when the post aliased as p
+// carries every normalised tag in the tagsParam array, or that array is
+// empty or NULL.
+func hasAllTags(p, tagsParam string) string {
+	return fmt.Sprintf(`(
+			COALESCE(cardinality(%[2]s::text[]), 0) = 0 OR (
+				SELECT COUNT(*) FROM post_tags ft
+				JOIN tags ft_t ON ft_t.id = ft.tag_id
+				WHERE ft.post_id = %[1]s.id AND ft_t.name = ANY(%[2]s::text[])
+			) = cardinality(%[2]s::text[])
+		)`, p, tagsParam)
+}
+
+type TagStore struct {
+	db *sql.DB
+}
+
+// GetByName returns a normalised tag with its counts, as seen by userID.
+func (s *TagStore) GetByName(ctx context.Context, name string, userID int64) (*Tag, error) {
+	query := `
+		SELECT t.id, t.name, t.created_at,
+			(SELECT COUNT(*) FROM post_tags pt WHERE pt.tag_id = t.id),
+			(SELECT COUNT(*) FROM tag_followers tf WHERE tf.tag_id = t.id),
+			EXISTS (SELECT 1 FROM tag_followers tf WHERE tf.tag_id = t.id AND tf.user_id = $2)
+		FROM tags t
+		WHERE t.name = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var tag Tag
+	err := s.db.QueryRowContext(ctx, query, name, userID).Scan(
+		&tag.ID,
+		&tag.Name,
+		&tag.CreatedAt,
+		&tag.Posts,
+		&tag.Followers,
+		&tag.Following,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tag, nil
+}
+
+// Follow adds posts with the tag to the user's feed. Tags can be followed
+// before anyone has used them.
+func (s *TagStore) Follow(ctx context.Context, userID int64, name string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		query := `INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`
+		if _, err := tx.ExecContext(ctx, query, name); err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO tag_followers (user_id, tag_id)
+			SELECT $1, id FROM tags WHERE name = $2
+		`
+		if _, err := tx.ExecContext(ctx, query, userID, name); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrConflict
+			}
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *TagStore) Unfollow(ctx context.Context, userID int64, name string) error {
+	query := `
+		DELETE FROM tag_followers tf USING tags t
+		WHERE tf.tag_id = t.id AND tf.user_id = $1 AND t.name = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, name)
+
+	return err
+}
+
+// Renormalize brings tags stored without going through hashtag.Normalize,
+// such as by the SQL backfill of migration 000028, in line with it. Tags
+// are merged into their normalised form, keeping their followers, then the
+// tags of every post are derived again from its explicit tags and content,
+// batchSize posts at a time. It returns how many posts it went through.
+func (s *TagStore) Renormalize(ctx context.Context, batchSize int) (int, error) {
+	if err := s.renameTags(ctx); err != nil {
+		return 0, err
+	}
+
+	query := `SELECT id, tags, content FROM posts WHERE id > $1 ORDER BY id LIMIT $2`
+
+	var (
+		lastID int64
+		done   int
+	)
+	for {
+		posts, err := func() ([]Post, error) {
+			ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+			defer cancel()
+
+			rows, err := s.db.QueryContext(ctx, query, lastID, batchSize)
+			if err != nil {
+				return nil, err
+			}
+			defer rows.Close()
+
+			var posts []Post
+			for rows.Next() {
+				var p Post
+				if err := rows.Scan(&p.ID, pq.Array(&p.Tags), &p.Content); err != nil {
+					return nil, err
+				}
+				posts = append(posts, p)
+			}
+			return posts, rows.Err()
+		}()
+		if err != nil {
+			return done, err
+		}
+		if len(posts) == 0 {
+			return done, nil
+		}
+
+		for i := range posts {
+			err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+				return setPostTags(ctx, tx, &posts[i])
+			})
+			if err != nil {
+				return done, err
+			}
+			done++
+		}
+		lastID = posts[len(posts)-1].ID
+	}
+}
+
+// renameTags merges every tag whose name isn't normalised into the tag it
+// normalises to, moving its followers over. Tags that aren't valid at all
+// are dropped. Links to posts are left for Renormalize to set again.
+func (s *TagStore) renameTags(ctx context.Context) error {
+	type tag struct {
+		id   int64
+		name string
+	}
+
+	tags, err := func() ([]tag, error) {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := s.db.QueryContext(ctx, `SELECT id, name FROM tags`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var tags []tag
+		for rows.Next() {
+			var t tag
+			if err := rows.Scan(&t.id, &t.name); err != nil {
+				return nil, err
+			}
+			tags = append(tags, t)
+		}
+		return tags, rows.Err()
+	}()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tags {
+		name, ok := hashtag.Normalize(t.name)
+		if ok && name == t.name {
+			continue
+		}
+
+		err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+			ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+			defer cancel()
+
+			if ok {
+				query := `INSERT INTO tags (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`
+				if _, err := tx.ExecContext(ctx, query, name); err != nil {
+					return err
+				}
+
+				query = `
+					INSERT INTO tag_followers (user_id, tag_id, created_at)
+					SELECT tf.user_id, t.id, tf.created_at
+					FROM tag_followers tf, tags t
+					WHERE tf.tag_id = $1 AND t.name = $2
+					ON CONFLICT DO NOTHING
+				`
+				if _, err := tx.ExecContext(ctx, query, t.id, name); err != nil {
+					return err
+				}
+			}
+
+			_, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = $1`, t.id)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Trending ranks the tags of public posts made within the last window.
+// Each tag's activity is compared with the window before it, so a tag
+// that is always busy ranks below one that is suddenly taking off:
+//
+//	score = authors * (posts + 1) / (previous posts + 1)
+//
+// Counting distinct authors keeps a single account from pushing a tag up
+// by posting it over and over.
+func (s *TagStore) Trending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error) {
+	query := `
+		WITH activity AS (
+			SELECT t.name,
+				COUNT(*) FILTER (WHERE p.createdAt > NOW() - $1 * interval '1 second') AS posts,
+				COUNT(DISTINCT p.user_id) FILTER (WHERE p.createdAt > NOW() - $1 * interval '1 second') AS authors,
+				COUNT(*) FILTER (WHERE p.createdAt <= NOW() - $1 * interval '1 second') AS previous_posts
+			FROM posts p
+			JOIN post_tags pt ON pt.post_id = p.id
+			JOIN tags t ON t.id = pt.tag_id
+			WHERE p.createdAt > NOW() - 2 * $1 * interval '1 second'
+				AND p.deleted_at IS NULL
+				AND p.status = 'published'
+				AND p.visibility = 'public'
+			GROUP BY t.name
+		)
+		SELECT name, posts, authors, previous_posts,
+			authors * (posts + 1)::float / (previous_posts + 1) AS score
+		FROM activity
+		WHERE posts > 0
+		ORDER BY score DESC, posts DESC, name
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, window.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Name, &t.Posts, &t.Authors, &t.PreviousPosts, &t.Score); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
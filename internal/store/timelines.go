@@ -0,0 +1,347 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Home timelines are kept precomputed in the cache: when a post is
+// published, its id is pushed to the timeline of everyone who would see it
+// in their feed. Authors with many followers are left out of that and
+// their posts are merged in when a timeline is read instead.
+
+// TimelineEntry is a post in a cached home timeline.
+type TimelineEntry struct {
+	PostID    int64
+	CreatedAt time.Time
+}
+
+// FanoutJob is a published post waiting to be pushed into timelines.
+type FanoutJob struct {
+	PostID     int64
+	AuthorID   int64
+	Visibility string
+	CreatedAt  time.Time
+	Attempts   int
+	// Followers is how many followers the author had when the job was
+	// claimed.
+	Followers int64
+}
+
+// LargeAccount reports whether the post's author has too many followers
+// for it to be pushed to each of them.
+func (j *FanoutJob) LargeAccount(maxFollowers int) bool {
+	return j.Followers >= int64(maxFollowers)
+}
+
+// largeAccount returns a SQL condition that holds when the user in the
+// userExpr expression has at least the number of followers in the
+// maxParam placeholder. Their posts aren't fanned out.
+func largeAccount(userExpr, maxParam string) string {
+	return fmt.Sprintf("(SELECT lu.followers_count FROM users lu WHERE lu.id = %s) >= %s", userExpr, maxParam)
+}
+
+// enqueueFanout queues a post that was just published to be pushed into
+// timelines.
+func enqueueFanout(ctx context.Context, tx *sql.Tx, postID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO timeline_fanout (post_id) VALUES ($1) ON CONFLICT (post_id) DO NOTHING`, postID)
+	return err
+}
+
+type TimelineStore struct {
+	db *sql.DB
+}
+
+// GetEntries returns the newest posts that belong in the user's cached
+// timeline: their own, those of the accounts they follow that have fewer
+// than maxFollowers followers, and those carrying a tag they follow, as
+// far as the user is allowed to see them.
+func (s *TimelineStore) GetEntries(ctx context.Context, userID int64, maxFollowers, limit int) ([]TimelineEntry, error) {
+	query := `
+		WITH sources AS (
+			SELECT f.user_id FROM followers f
+			WHERE f.follower_id = $1 AND NOT ` + largeAccount("f.user_id", "$2") + `
+		)
+		SELECT p.id, p.createdat
+		FROM posts p
+		WHERE
+			(p.user_id = $1 OR p.user_id IN (SELECT user_id FROM sources) OR EXISTS (
+				SELECT 1 FROM post_tags pt
+				JOIN tag_followers tf ON tf.tag_id = pt.tag_id
+				WHERE pt.post_id = p.id AND tf.user_id = $1
+			)) AND
+			p.deleted_at IS NULL AND
+			p.status = 'published' AND
+			` + postVisibleTo("p", "$1") + `
+		ORDER BY p.createdat DESC, p.id DESC
+		LIMIT $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, maxFollowers, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimelineEntry{}
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetLargeAccountsFollowed returns the accounts with maxFollowers or more
+// followers that the user follows.
+func (s *TimelineStore) GetLargeAccountsFollowed(ctx context.Context, userID int64, maxFollowers int) ([]int64, error) {
+	query := `
+		SELECT f.user_id FROM followers f
+		WHERE f.follower_id = $1 AND ` + largeAccount("f.user_id", "$2") + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, maxFollowers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ClaimFanout leases the oldest post waiting to be fanned out to the
+// caller, the same way LinkPreviewStore.ClaimPending does for links. Posts
+// that used up their attempts are dropped; their readers get them when
+// their timelines are next rebuilt. It returns ErrNotFound when there is
+// nothing to do.
+func (s *TimelineStore) ClaimFanout(ctx context.Context, lease time.Duration, maxAttempts int) (*FanoutJob, error) {
+	giveUp := `
+		DELETE FROM timeline_fanout
+		WHERE attempts >= $1 AND locked_until < NOW()
+	`
+	claim := `
+		UPDATE timeline_fanout tf
+		SET attempts = tf.attempts + 1, locked_until = NOW() + $1 * interval '1 second'
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.id = tf.post_id AND tf.post_id = (
+			SELECT post_id FROM timeline_fanout
+			WHERE attempts < $2 AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING tf.post_id, p.user_id, p.visibility, p.createdat, tf.attempts, u.followers_count
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, giveUp, maxAttempts); err != nil {
+		return nil, err
+	}
+
+	var job FanoutJob
+	err := s.db.QueryRowContext(ctx, claim, lease.Seconds(), maxAttempts).Scan(
+		&job.PostID,
+		&job.AuthorID,
+		&job.Visibility,
+		&job.CreatedAt,
+		&job.Attempts,
+		&job.Followers,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// Recipients returns the users whose timelines the post goes into: the
+// author, their followers unless they have maxFollowers or more, and the
+// followers of the post's tags, as far as they are allowed to see it. The
+// followers of a large account get its posts on its stream topic and
+// merged into their timelines when read, so they are left out even when
+// they follow one of the tags.
+func (s *TimelineStore) Recipients(ctx context.Context, job *FanoutJob, maxFollowers int) ([]int64, error) {
+	query := `
+		SELECT r.id FROM (
+			SELECT $2::bigint AS id
+			UNION
+			SELECT f.follower_id FROM followers f
+			WHERE f.user_id = $2 AND NOT $3
+			UNION
+			SELECT tf.user_id FROM post_tags pt
+			JOIN tag_followers tf ON tf.tag_id = pt.tag_id
+			WHERE pt.post_id = $1 AND NOT ($3 AND EXISTS (
+				SELECT 1 FROM followers f WHERE f.user_id = $2 AND f.follower_id = tf.user_id
+			))
+		) r
+		JOIN posts p ON p.id = $1
+		WHERE ` + postVisibleTo("p", "r.id") + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, job.PostID, job.AuthorID, job.LargeAccount(maxFollowers))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// FinishFanout removes a post that was fanned out from the queue.
+func (s *TimelineStore) FinishFanout(ctx context.Context, job *FanoutJob) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `DELETE FROM timeline_fanout WHERE post_id = $1`, job.PostID)
+	return err
+}
+
+// FailFanout records why fanning out failed. The post is retried after
+// retryAfter unless it used up its attempts.
+func (s *TimelineStore) FailFanout(ctx context.Context, job *FanoutJob, reason string, retryAfter time.Duration) error {
+	query := `
+		UPDATE timeline_fanout
+		SET error = $2, locked_until = NOW() + $3 * interval '1 second'
+		WHERE post_id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, job.PostID, reason, retryAfter.Seconds())
+	return err
+}
+
+// GetLargeAccountEntries returns a page of the posts of the large accounts
+// the user follows, which aren't fanned out, to be merged into their
+// cached timeline. With a horizon, posts older than it are left out; the
+// cached timeline doesn't reach further back. Up to fq.Limit+1 entries are
+// returned, so the caller can tell whether there are more.
+func (s *TimelineStore) GetLargeAccountEntries(ctx context.Context, userID int64, maxFollowers int, horizon *time.Time, fq PaginatedFeedQuery) ([]TimelineEntry, error) {
+	keyset, order := fq.keyset("p", "$4", "$5")
+	query := `
+		SELECT p.id, p.createdat
+		FROM followers f
+		JOIN posts p ON p.user_id = f.user_id
+		WHERE
+			f.follower_id = $1 AND ` + largeAccount("f.user_id", "$2") + ` AND
+			($3::timestamptz IS NULL OR p.createdat >= $3::timestamptz) AND
+			p.deleted_at IS NULL AND
+			p.status = 'published' AND
+			` + postVisibleTo("p", "$1") + ` AND
+			` + keyset + `
+		ORDER BY ` + order + `
+		LIMIT $6
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var oldest any
+	if horizon != nil {
+		oldest = *horizon
+	}
+
+	cursorTime, cursorID := fq.keysetArgs()
+	rows, err := s.db.QueryContext(ctx, query, userID, maxFollowers, oldest, cursorTime, cursorID, fq.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimelineEntry{}
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetByIDs reads the posts in ids for a page of the user's timeline, in the
+// order of ids. Posts deleted, unpublished or hidden from the user since
+// they were picked are left out.
+func (s *PostStore) GetByIDs(ctx context.Context, userID int64, ids []int64) ([]PostWithMetadata, error) {
+	query := `
+		SELECT ` + feedPostColumns + `
+		FROM posts p
+		LEFT JOIN users u ON p.user_id = u.id
+		WHERE
+			p.id = ANY($2) AND
+			p.deleted_at IS NULL AND
+			p.status = 'published' AND
+			` + postVisibleTo("p", "$1") + `
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]PostWithMetadata, len(ids))
+	for rows.Next() {
+		var p PostWithMetadata
+		if err := scanFeedPost(rows, &p); err != nil {
+			return nil, err
+		}
+		byID[p.ID] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	feed := make([]PostWithMetadata, 0, len(byID))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			feed = append(feed, p)
+		}
+	}
+
+	return feed, nil
+}
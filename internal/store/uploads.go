@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// UploadSession tracks a resumable upload. The bytes received so far live
+// outside the database; Offset is how many of them have been accepted.
+type UploadSession struct {
+	ID        string `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Length    int64  `json:"length"`
+	Offset    int64  `json:"offset"`
+	Filename  string `json:"filename"`
+	AltText   string `json:"alt_text"`
+	ImageID   *int64 `json:"image_id"`
+	Image     *Image `json:"image,omitempty"`
+	ExpiresAt string `json:"expires_at"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Complete reports whether every byte of the upload has been received.
+func (s *UploadSession) Complete() bool {
+	return s.Offset == s.Length
+}
+
+type UploadSessionStore struct {
+	db *sql.DB
+}
+
+func (s *UploadSessionStore) Create(ctx context.Context, session *UploadSession, ttl time.Duration) error {
+	query := `
+		INSERT INTO upload_sessions (id, user_id, length, filename, alt_text, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW() + $6 * interval '1 second')
+		RETURNING upload_offset, expires_at, createdAt
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query,
+		session.ID,
+		session.UserID,
+		session.Length,
+		session.Filename,
+		session.AltText,
+		ttl.Seconds(),
+	).Scan(&session.Offset, &session.ExpiresAt, &session.CreatedAt)
+}
+
+// GetByID returns a session that hasn't expired yet.
+func (s *UploadSessionStore) GetByID(ctx context.Context, id string) (*UploadSession, error) {
+	query := `
+		SELECT id, user_id, length, upload_offset, filename, alt_text, image_id, expires_at, createdAt
+		FROM upload_sessions
+		WHERE id = $1 AND expires_at > NOW()
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var session UploadSession
+	err := s.db.QueryRowContext(ctx, query, id).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Length,
+		&session.Offset,
+		&session.Filename,
+		&session.AltText,
+		&session.ImageID,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &session, nil
+}
+
+// Advance moves the session's offset forward and pushes its expiry back.
+// It fails with ErrConflict when the offset moved since the session was
+// loaded.
+func (s *UploadSessionStore) Advance(ctx context.Context, session *UploadSession, offset int64, ttl time.Duration) error {
+	query := `
+		UPDATE upload_sessions
+		SET upload_offset = $3, expires_at = NOW() + $4 * interval '1 second'
+		WHERE id = $1 AND upload_offset = $2 AND image_id IS NULL AND expires_at > NOW()
+		RETURNING expires_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, session.ID, session.Offset, offset, ttl.Seconds()).Scan(&session.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrConflict
+		default:
+			return err
+		}
+	}
+
+	session.Offset = offset
+	return nil
+}
+
+// Complete links the image assembled from a finished upload to the
+// session, so clients can look it up after the last chunk. A new image is
+// saved first; one that already has an ID is linked as it is.
+func (s *UploadSessionStore) Complete(ctx context.Context, session *UploadSession, image *Image) error {
+	query := `
+		UPDATE upload_sessions SET image_id = $2
+		WHERE id = $1 AND image_id IS NULL
+	`
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if image.ID == 0 {
+			if err := createImage(ctx, tx, image); err != nil {
+				return err
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, session.ID, image.ID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return ErrConflict
+		}
+
+		session.ImageID = &image.ID
+		session.Image = image
+		return nil
+	})
+}
+
+func (s *UploadSessionStore) Delete(ctx context.Context, id string) error {
+	query := `DELETE FROM upload_sessions WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpired removes sessions past their expiry and returns their ids.
+func (s *UploadSessionStore) DeleteExpired(ctx context.Context) ([]string, error) {
+	query := `DELETE FROM upload_sessions WHERE expires_at <= NOW() RETURNING id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
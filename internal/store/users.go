@@ -17,14 +17,17 @@ var (
 )
 
 type User struct {
-	ID        int64    `json:"id"`
-	Username  string   `json:"username"`
-	Email     string   `json:"email"`
-	Password  password `json:"-"`
-	CreatedAt string   `json:"createdAt"`
-	IsActive  bool     `json:"is_active"`
-	RoleID    int64    `json:"role_id"`
-	Role      Role     `json:"role"`
+	ID          int64    `json:"id"`
+	Username    string   `json:"username"`
+	DisplayName string   `json:"display_name"`
+	Email       string   `json:"email"`
+	Password    password `json:"-"`
+	CreatedAt   string   `json:"createdAt"`
+	IsActive    bool     `json:"is_active"`
+	RoleID      int64    `json:"role_id"`
+	Role        Role     `json:"role"`
+	AvatarID    *int64   `json:"avatar_id"`
+	Avatar      *Image   `json:"avatar,omitempty"`
 }
 
 type password struct {
@@ -170,7 +173,7 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT users.id, username, email, password,createdAt, roles.*
+		SELECT users.id, username, display_name, email, password,createdAt, avatar_image_id, roles.*
 		FROM users 
 		JOIN roles on (users.role_id =roles.id)
 		WHERE users.id = $1 AND is_active = true
@@ -178,7 +181,7 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 	user := &User{}
-	err := s.db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.Role.ID, &user.Role.Name, &user.Role.Level, &user.Role.Description)
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Username, &user.DisplayName, &user.Email, &user.Password.hash, &user.CreatedAt, &user.AvatarID, &user.Role.ID, &user.Role.Name, &user.Role.Level, &user.Role.Description)
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
@@ -275,3 +278,50 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	return user, nil
 
 }
+
+// SetAvatar points the user's avatar at one of their own images, or clears
+// it when imageID is nil. ErrImageNotOwned is returned for anyone else's.
+func (s *UserStore) SetAvatar(ctx context.Context, user *User, imageID *int64) error {
+	query := `
+		UPDATE users SET avatar_image_id = $2
+		WHERE id = $1 AND ($2::bigint IS NULL OR EXISTS (
+			SELECT 1 FROM images WHERE id = $2 AND user_id = $1
+		))
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, user.ID, imageID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrImageNotOwned
+	}
+
+	user.AvatarID = imageID
+	return nil
+}
+
+// SetDisplayName changes the name shown next to the user's username. An
+// empty name removes it.
+func (s *UserStore) SetDisplayName(ctx context.Context, user *User, name string) error {
+	query := `UPDATE users SET display_name = $2 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, query, user.ID, name); err != nil {
+		return err
+	}
+
+	user.DisplayName = name
+
+	return nil
+}
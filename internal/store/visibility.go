@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityMentioned = "mentioned"
+)
+
+// postVisibleTo returns a SQL condition that holds when the post aliased as p
+// can be seen by the user in the userParam placeholder. Every query listing
+// other users' posts has to include it.
+func postVisibleTo(p, userParam string) string {
+	return fmt.Sprintf(`(
+			%[1]s.visibility = 'public' OR
+			%[1]s.user_id = %[2]s OR
+			(%[1]s.visibility = 'followers' AND EXISTS (
+				SELECT 1 FROM followers vf WHERE vf.user_id = %[1]s.user_id AND vf.follower_id = %[2]s
+			)) OR
+			(%[1]s.visibility = 'mentioned' AND EXISTS (
+				SELECT 1 FROM post_mentions vm WHERE vm.post_id = %[1]s.id AND vm.user_id = %[2]s
+			))
+		)`, p, userParam)
+}
+
+// CanView reports whether the user is allowed to see the post under its
+// visibility setting.
+func (s *PostStore) CanView(ctx context.Context, post *Post, userID int64) (bool, error) {
+	if post.Visibility == VisibilityPublic || post.UserID == userID {
+		return true, nil
+	}
+
+	query := `SELECT EXISTS (SELECT 1 FROM posts p WHERE p.id = $1 AND ` + postVisibleTo("p", "$2") + `)`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var visible bool
+	if err := s.db.QueryRowContext(ctx, query, post.ID, userID).Scan(&visible); err != nil {
+		return false, err
+	}
+
+	return visible, nil
+}
@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"context"
+	"sync"
+)
+
+// LocalBroker delivers events within this process only.
+type LocalBroker struct {
+	buffer int
+
+	mu   sync.Mutex
+	subs map[string]map[chan Event]struct{}
+}
+
+// NewLocalBroker returns a broker whose subscriptions buffer up to buffer
+// events.
+func NewLocalBroker(buffer int) *LocalBroker {
+	return &LocalBroker{
+		buffer: buffer,
+		subs:   map[string]map[chan Event]struct{}{},
+	}
+}
+
+func (b *LocalBroker) Publish(ctx context.Context, e Event, userIDs ...int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, id := range userIDs {
+		b.deliver(e, userTopic(id))
+	}
+
+	return nil
+}
+
+func (b *LocalBroker) PublishTopic(ctx context.Context, e Event, topic string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deliver(e, topic)
+
+	return nil
+}
+
+// deliver hands the event to the subscriptions following topic. b.mu must
+// be held.
+func (b *LocalBroker) deliver(e Event, topic string) {
+	for ch := range b.subs[topic] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (b *LocalBroker) Subscribe(ctx context.Context, userID int64, topics ...string) (*Subscription, error) {
+	return b.subscribe(append([]string{userTopic(userID)}, topics...)), nil
+}
+
+// subscribe opens a subscription following every topic in topics.
+func (b *LocalBroker) subscribe(topics []string) *Subscription {
+	ch := make(chan Event, b.buffer)
+
+	b.mu.Lock()
+	for _, t := range topics {
+		if b.subs[t] == nil {
+			b.subs[t] = map[chan Event]struct{}{}
+		}
+		b.subs[t][ch] = struct{}{}
+	}
+	b.mu.Unlock()
+
+	return &Subscription{
+		Events: ch,
+		close: func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			for _, t := range topics {
+				delete(b.subs[t], ch)
+				if len(b.subs[t]) == 0 {
+					delete(b.subs, t)
+				}
+			}
+			close(ch)
+		},
+	}
+}
@@ -0,0 +1,154 @@
+package stream
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// drain returns the types of the events waiting on sub.
+func drain(sub *Subscription) []string {
+	got := []string{}
+	for {
+		select {
+		case e := <-sub.Events:
+			got = append(got, e.Type)
+		default:
+			return got
+		}
+	}
+}
+
+func TestLocalBroker(t *testing.T) {
+	type subscriber struct {
+		userID int64
+		topics []string
+	}
+	type publish struct {
+		typ     string
+		userIDs []int64
+		topic   string
+	}
+
+	tests := []struct {
+		name    string
+		subs    []subscriber
+		publish []publish
+		// want holds the events each subscriber received, in order
+		want [][]string
+	}{
+		{
+			name:    "to users",
+			subs:    []subscriber{{userID: 1}, {userID: 2}, {userID: 3}},
+			publish: []publish{{typ: "a", userIDs: []int64{1, 3}}, {typ: "b", userIDs: []int64{2}}},
+			want:    [][]string{{"a"}, {"b"}, {"a"}},
+		},
+		{
+			name:    "nobody connected",
+			subs:    []subscriber{{userID: 1}},
+			publish: []publish{{typ: "a", userIDs: []int64{2}}, {typ: "b", topic: AuthorTopic(1)}},
+			want:    [][]string{{}},
+		},
+		{
+			name:    "several connections of a user",
+			subs:    []subscriber{{userID: 1}, {userID: 1}},
+			publish: []publish{{typ: "a", userIDs: []int64{1}}},
+			want:    [][]string{{"a"}, {"a"}},
+		},
+		{
+			name: "to a topic",
+			subs: []subscriber{
+				{userID: 1, topics: []string{AuthorTopic(9)}},
+				{userID: 2, topics: []string{AuthorTopic(8), AuthorTopic(9)}},
+				{userID: 3},
+			},
+			publish: []publish{{typ: "a", topic: AuthorTopic(9)}, {typ: "b", topic: AuthorTopic(8)}},
+			want:    [][]string{{"a"}, {"a", "b"}, {}},
+		},
+		{
+			name:    "user and topic events together",
+			subs:    []subscriber{{userID: 1, topics: []string{AuthorTopic(9)}}},
+			publish: []publish{{typ: "a", userIDs: []int64{1}}, {typ: "b", topic: AuthorTopic(9)}},
+			want:    [][]string{{"a", "b"}},
+		},
+		{
+			// the topic of user 1 is "1", which no author topic can be
+			name:    "author topics aren't user topics",
+			subs:    []subscriber{{userID: 1}, {userID: 2, topics: []string{AuthorTopic(1)}}},
+			publish: []publish{{typ: "a", topic: AuthorTopic(1)}, {typ: "b", userIDs: []int64{1}}},
+			want:    [][]string{{"b"}, {"a"}},
+		},
+		{
+			name:    "full buffers drop events",
+			subs:    []subscriber{{userID: 1}},
+			publish: []publish{{typ: "a", userIDs: []int64{1}}, {typ: "b", userIDs: []int64{1}}, {typ: "c", userIDs: []int64{1}}},
+			want:    [][]string{{"a", "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := NewLocalBroker(2)
+
+			subs := make([]*Subscription, len(tt.subs))
+			for i, s := range tt.subs {
+				sub, err := b.Subscribe(ctx, s.userID, s.topics...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer sub.Close()
+				subs[i] = sub
+			}
+
+			for _, p := range tt.publish {
+				var err error
+				if p.topic != "" {
+					err = b.PublishTopic(ctx, Event{Type: p.typ}, p.topic)
+				} else {
+					err = b.Publish(ctx, Event{Type: p.typ}, p.userIDs...)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i, sub := range subs {
+				if got := drain(sub); !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("subscriber %d got %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLocalBrokerClose(t *testing.T) {
+	ctx := context.Background()
+	b := NewLocalBroker(1)
+
+	closed, _ := b.Subscribe(ctx, 1, AuthorTopic(9))
+	open, _ := b.Subscribe(ctx, 1, AuthorTopic(9))
+	defer open.Close()
+
+	closed.Close()
+	// closing twice is harmless
+	closed.Close()
+
+	if _, ok := <-closed.Events; ok {
+		t.Error("Events of a closed subscription is still open")
+	}
+
+	b.Publish(ctx, Event{Type: "a"}, 1)
+	if got := drain(open); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("open subscription got %q, want [a]", got)
+	}
+
+	open.Close()
+	if len(b.subs) != 0 {
+		t.Errorf("broker still tracks topics %v after every subscription closed", b.subs)
+	}
+
+	// publishing with nobody left must not panic on the closed channels
+	b.Publish(ctx, Event{Type: "b"}, 1)
+	b.PublishTopic(ctx, Event{Type: "b"}, AuthorTopic(9))
+}
@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const channelPrefix = "stream-"
+
+// RedisBroker delivers events across API instances with Redis pub/sub.
+// Each user and topic has a channel, which an instance subscribes to while
+// a connection to it follows them.
+type RedisBroker struct {
+	rdb    *redis.Client
+	local  *LocalBroker
+	pubsub *redis.PubSub
+
+	mu   sync.Mutex
+	refs map[string]int
+}
+
+// NewRedisBroker returns a broker whose subscriptions buffer up to buffer
+// events. Close it to stop listening to Redis.
+func NewRedisBroker(rdb *redis.Client, buffer int) *RedisBroker {
+	b := &RedisBroker{
+		rdb:    rdb,
+		local:  NewLocalBroker(buffer),
+		pubsub: rdb.Subscribe(context.Background()),
+		refs:   map[string]int{},
+	}
+
+	go b.receive()
+
+	return b
+}
+
+func channel(topic string) string {
+	return channelPrefix + topic
+}
+
+// receive hands the events arriving from Redis to the local subscriptions.
+func (b *RedisBroker) receive() {
+	for msg := range b.pubsub.Channel() {
+		var e Event
+		if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+			continue
+		}
+
+		b.local.PublishTopic(context.Background(), e, strings.TrimPrefix(msg.Channel, channelPrefix))
+	}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, e Event, userIDs ...int64) error {
+	topics := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		topics[i] = userTopic(id)
+	}
+
+	return b.publish(ctx, e, topics...)
+}
+
+func (b *RedisBroker) PublishTopic(ctx context.Context, e Event, topic string) error {
+	return b.publish(ctx, e, topic)
+}
+
+func (b *RedisBroker) publish(ctx context.Context, e Event, topics ...string) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, t := range topics {
+			pipe.Publish(ctx, channel(t), payload)
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, userID int64, topics ...string) (*Subscription, error) {
+	topics = append([]string{userTopic(userID)}, topics...)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var channels []string
+	for _, t := range topics {
+		if b.refs[t] == 0 {
+			channels = append(channels, channel(t))
+		}
+	}
+	if len(channels) > 0 {
+		if err := b.pubsub.Subscribe(ctx, channels...); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range topics {
+		b.refs[t]++
+	}
+
+	sub := b.local.subscribe(topics)
+
+	return &Subscription{
+		Events: sub.Events,
+		close: func() {
+			sub.Close()
+
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			var channels []string
+			for _, t := range topics {
+				b.refs[t]--
+				if b.refs[t] == 0 {
+					delete(b.refs, t)
+					channels = append(channels, channel(t))
+				}
+			}
+			if len(channels) > 0 {
+				b.pubsub.Unsubscribe(context.Background(), channels...)
+			}
+		},
+	}, nil
+}
+
+func (b *RedisBroker) Close() error {
+	return b.pubsub.Close()
+}
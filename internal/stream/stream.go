@@ -0,0 +1,76 @@
+// Package stream delivers real-time events to the users connected to the
+// API. Events are addressed to users, or to topics such as the posts of an
+// author; a broker hands them to every open subscription of those users or
+// following those topics, on this instance or, through Redis, on any
+// other.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+const (
+	// EventPost is a new post from someone the user follows.
+	EventPost = "post"
+	// EventComment is a new comment on one of the user's posts.
+	EventComment = "comment"
+	// EventMention is a new post or comment mentioning the user.
+	EventMention = "mention"
+	// EventNotification is a new notification of the user, or one that
+	// more people joined.
+	EventNotification = "notification"
+)
+
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func NewEvent(typ string, data any) (Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{Type: typ, Data: b}, nil
+}
+
+// AuthorTopic is the topic the posts of an author with too many followers
+// to address one by one are published on. Their followers subscribe to it.
+func AuthorTopic(userID int64) string {
+	return fmt.Sprintf("author-%d", userID)
+}
+
+// userTopic is the topic of the events addressed to a user. User ids can't
+// be mistaken for named topics like AuthorTopic.
+func userTopic(userID int64) string {
+	return strconv.FormatInt(userID, 10)
+}
+
+type Broker interface {
+	// Publish sends the event to the subscriptions of userIDs. Delivery is
+	// best effort: users who aren't connected miss it.
+	Publish(ctx context.Context, e Event, userIDs ...int64) error
+	// PublishTopic sends the event to the subscriptions following topic,
+	// as best effort as Publish.
+	PublishTopic(ctx context.Context, e Event, topic string) error
+	// Subscribe opens a subscription to the user's events and those of
+	// topics.
+	Subscribe(ctx context.Context, userID int64, topics ...string) (*Subscription, error)
+}
+
+// Subscription receives the events for one connection until it is closed.
+// Events that arrive while its buffer is full are dropped, so a slow client
+// can't hold up the others.
+type Subscription struct {
+	Events <-chan Event
+	once   sync.Once
+	close  func()
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(s.close)
+}
@@ -0,0 +1,261 @@
+// Package syndication renders lists of posts as RSS 2.0, Atom and JSON Feed
+// 1.1 documents for feed readers.
+package syndication
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	ContentTypeRSS  = "application/rss+xml; charset=utf-8"
+	ContentTypeAtom = "application/atom+xml; charset=utf-8"
+	ContentTypeJSON = "application/feed+json; charset=utf-8"
+)
+
+type Feed struct {
+	Title       string
+	Description string
+	// HomeURL is the page the feed is about and FeedURL the feed itself.
+	HomeURL string
+	FeedURL string
+	Author  string
+	Updated time.Time
+	Items   []Item
+}
+
+type Item struct {
+	ID        string
+	URL       string
+	Title     string
+	Content   string
+	Tags      []string
+	Published time.Time
+	Updated   time.Time
+}
+
+// contentHTML turns plain text post content into HTML, keeping its line
+// breaks. Markup in the text is escaped, not interpreted.
+func contentHTML(text string) string {
+	paragraphs := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n")
+	var b strings.Builder
+	for _, p := range paragraphs {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(p), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+	return b.String()
+}
+
+// Text inside the XML formats goes through encoding/xml, which escapes it
+// and replaces characters XML can't carry.
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title,omitempty"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS writes the feed as RSS 2.0.
+func RSS(w io.Writer, f *Feed) error {
+	doc := rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.HomeURL,
+			Description: f.Description,
+			Self:        atomLink{Href: f.FeedURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if !f.Updated.IsZero() {
+		doc.Channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, it := range f.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       it.Title,
+			Link:        it.URL,
+			GUID:        rssGUID{IsPermaLink: false, Value: it.ID},
+			Description: contentHTML(it.Content),
+			Categories:  it.Tags,
+			PubDate:     it.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	return writeXML(w, doc)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      atomText       `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Content    atomText       `xml:"content"`
+	Categories []atomCategory `xml:"category"`
+}
+
+// Atom writes the feed as Atom 1.0.
+func Atom(w io.Writer, f *Feed) error {
+	doc := atomFeed{
+		NS:      "http://www.w3.org/2005/Atom",
+		ID:      f.FeedURL,
+		Title:   f.Title,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: f.Author},
+		Links: []atomLink{
+			{Href: f.HomeURL, Rel: "alternate", Type: "text/html"},
+			{Href: f.FeedURL, Rel: "self", Type: "application/atom+xml"},
+		},
+	}
+
+	for _, it := range f.Items {
+		e := atomEntry{
+			ID:        it.ID,
+			Title:     atomText{Type: "text", Value: it.Title},
+			Link:      atomLink{Href: it.URL, Rel: "alternate", Type: "text/html"},
+			Published: it.Published.UTC().Format(time.RFC3339),
+			Updated:   it.Updated.UTC().Format(time.RFC3339),
+			Content:   atomText{Type: "html", Value: contentHTML(it.Content)},
+		}
+		for _, t := range it.Tags {
+			e.Categories = append(e.Categories, atomCategory{Term: t})
+		}
+		doc.Entries = append(doc.Entries, e)
+	}
+
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Authors     []jsonAuthor   `json:"authors,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title,omitempty"`
+	ContentHTML   string   `json:"content_html"`
+	ContentText   string   `json:"content_text"`
+	DatePublished string   `json:"date_published"`
+	DateModified  string   `json:"date_modified"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// JSONFeed writes the feed as JSON Feed 1.1.
+func JSONFeed(w io.Writer, f *Feed) error {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.FeedURL,
+		Description: f.Description,
+		Items:       []jsonFeedItem{},
+	}
+	if f.Author != "" {
+		doc.Authors = []jsonAuthor{{Name: f.Author}}
+	}
+
+	for _, it := range f.Items {
+		doc.Items = append(doc.Items, jsonFeedItem{
+			ID:            it.ID,
+			URL:           it.URL,
+			Title:         it.Title,
+			ContentHTML:   contentHTML(it.Content),
+			ContentText:   it.Content,
+			DatePublished: it.Published.UTC().Format(time.RFC3339),
+			DateModified:  it.Updated.UTC().Format(time.RFC3339),
+			Tags:          it.Tags,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
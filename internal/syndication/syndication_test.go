@@ -0,0 +1,210 @@
+package syndication
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContentHTML(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "", want: ""},
+		{text: "hello", want: "<p>hello</p>"},
+		{text: "one\ntwo", want: "<p>one<br>two</p>"},
+		{text: "one\r\n\r\ntwo", want: "<p>one</p><p>two</p>"},
+		{text: "one\n\n\n\ntwo", want: "<p>one</p><p>two</p>"},
+		{text: "  \n\n", want: ""},
+		{text: "<script>alert(1)</script>", want: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{text: `a & b "c" 'd'`, want: "<p>a &amp; b &#34;c&#34; &#39;d&#39;</p>"},
+		{text: "<br>", want: "<p>&lt;br&gt;</p>"},
+	}
+
+	for _, tt := range tests {
+		if got := contentHTML(tt.text); got != tt.want {
+			t.Errorf("contentHTML(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// hostile is text that would break out of the document if it were pasted in
+// unescaped.
+const hostile = `</title></item><script>alert("x")</script> ]]> & <![CDATA[ &amp; ` + "\x01"
+
+func testFeed() *Feed {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &Feed{
+		Title:       "Posts by " + hostile,
+		Description: hostile,
+		HomeURL:     "https://example.com/alice?a=1&b=2",
+		FeedURL:     "https://example.com/alice/feed.rss?a=1&b=\"2\"",
+		Author:      hostile,
+		Updated:     at,
+		Items: []Item{{
+			ID:        "https://example.com/posts/1",
+			URL:       "https://example.com/posts/1?x=<y>",
+			Title:     hostile,
+			Content:   hostile + "\n\nsecond",
+			Tags:      []string{"go", `"quoted"`},
+			Published: at,
+			Updated:   at,
+		}},
+	}
+}
+
+// rssReadback reads an RSS document back. The decoder can't tell atom:link
+// from link by the encoder's tags, so the namespaced element comes first.
+type rssReadback struct {
+	Channel struct {
+		Self struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.w3.org/2005/Atom link"`
+		Title       string    `xml:"title"`
+		Link        string    `xml:"link"`
+		Description string    `xml:"description"`
+		Items       []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+func TestXMLEscaping(t *testing.T) {
+	f := testFeed()
+
+	tests := []struct {
+		name   string
+		encode func(io.Writer, *Feed) error
+		doc    any
+		check  func(doc any) []string
+	}{
+		{
+			name:   "rss",
+			encode: RSS,
+			doc:    &rssReadback{},
+			check: func(doc any) []string {
+				c := doc.(*rssReadback).Channel
+				it := c.Items[0]
+				return []string{
+					c.Title, f.Title,
+					c.Description, f.Description,
+					c.Link, f.HomeURL,
+					c.Self.Href, f.FeedURL,
+					it.Title, f.Items[0].Title,
+					it.Link, f.Items[0].URL,
+					it.Description, contentHTML(f.Items[0].Content),
+					strings.Join(it.Categories, ","), strings.Join(f.Items[0].Tags, ","),
+				}
+			},
+		},
+		{
+			name:   "atom",
+			encode: Atom,
+			doc:    &atomFeed{},
+			check: func(doc any) []string {
+				a := doc.(*atomFeed)
+				e := a.Entries[0]
+				return []string{
+					a.Title, f.Title,
+					a.Author.Name, f.Author,
+					a.Links[0].Href, f.HomeURL,
+					a.Links[1].Href, f.FeedURL,
+					e.Title.Value, f.Items[0].Title,
+					e.Link.Href, f.Items[0].URL,
+					e.Content.Value, contentHTML(f.Items[0].Content),
+					e.Categories[1].Term, f.Items[0].Tags[1],
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.encode(&buf, f); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+
+			if strings.Contains(out, "<script>") || strings.Contains(out, "</title></item>") {
+				t.Errorf("markup in the feed text was written unescaped:\n%s", out)
+			}
+			if !strings.HasPrefix(out, xml.Header) {
+				t.Errorf("output doesn't start with the XML header")
+			}
+
+			if err := xml.Unmarshal(buf.Bytes(), tt.doc); err != nil {
+				t.Fatalf("output isn't well formed: %v\n%s", err, out)
+			}
+
+			// characters XML can't carry come back replaced
+			pairs := tt.check(tt.doc)
+			for i := 0; i < len(pairs); i += 2 {
+				want := strings.ReplaceAll(pairs[i+1], "\x01", "�")
+				if pairs[i] != want {
+					t.Errorf("read back %q, want %q", pairs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	tests := []struct {
+		name string
+		feed *Feed
+		want jsonFeed
+	}{
+		{
+			name: "empty",
+			feed: &Feed{Title: "t", HomeURL: "h", FeedURL: "f"},
+			want: jsonFeed{Version: "https://jsonfeed.org/version/1.1", Title: "t", HomePageURL: "h", FeedURL: "f", Items: []jsonFeedItem{}},
+		},
+		{
+			name: "hostile text",
+			feed: testFeed(),
+			want: jsonFeed{
+				Version:     "https://jsonfeed.org/version/1.1",
+				Title:       "Posts by " + hostile,
+				HomePageURL: "https://example.com/alice?a=1&b=2",
+				FeedURL:     "https://example.com/alice/feed.rss?a=1&b=\"2\"",
+				Description: hostile,
+				Authors:     []jsonAuthor{{Name: hostile}},
+				Items: []jsonFeedItem{{
+					ID:            "https://example.com/posts/1",
+					URL:           "https://example.com/posts/1?x=<y>",
+					Title:         hostile,
+					ContentHTML:   contentHTML(hostile + "\n\nsecond"),
+					ContentText:   hostile + "\n\nsecond",
+					DatePublished: "2024-01-02T03:04:05Z",
+					DateModified:  "2024-01-02T03:04:05Z",
+					Tags:          []string{"go", `"quoted"`},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := JSONFeed(&buf, tt.feed); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(buf.String(), "<script>") {
+				t.Errorf("markup was written unescaped:\n%s", buf.String())
+			}
+
+			var got jsonFeed
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("JSONFeed() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidMedia is returned when ffprobe can't make sense of a file or
+// it has no video stream to play.
+var ErrInvalidMedia = errors.New("not a playable video")
+
+// Info is what probing a file tells us about its first video stream.
+type Info struct {
+	Duration time.Duration
+	Codec    string
+	Width    int
+	Height   int
+}
+
+// Transcoder drives local ffmpeg and ffprobe binaries. Outputs are H.264
+// MP4 files with the index up front, which every browser can stream.
+type Transcoder struct {
+	ffmpeg  string
+	ffprobe string
+	// maxSide bounds the longer side of transcoded videos and posters
+	maxSide int
+}
+
+func New(ffmpegPath, ffprobePath string, maxSide int) *Transcoder {
+	return &Transcoder{ffmpeg: ffmpegPath, ffprobe: ffprobePath, maxSide: maxSide}
+}
+
+// Available reports whether both binaries can be found.
+func (t *Transcoder) Available() error {
+	for _, bin := range []string{t.ffmpeg, t.ffprobe} {
+		if _, err := exec.LookPath(bin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inputOptions go before every input. They stop crafted uploads, such as
+// playlists or concat lists, from making ffmpeg open other files or URLs:
+// only local files are read, and only by the demuxers of the formats
+// uploads are accepted in.
+var inputOptions = []string{
+	"-protocol_whitelist", "file",
+	"-format_whitelist", "mov,mp4,m4a,3gp,3g2,mj2,matroska,webm,avi,gif",
+}
+
+func (t *Transcoder) Probe(ctx context.Context, path string) (*Info, error) {
+	args := append([]string{
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+	}, inputOptions...)
+	out, err := t.run(ctx, t.ffprobe, append(args, path)...)
+	if err != nil {
+		// a missing binary or a timeout is our problem, not the file's
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMedia, err)
+	}
+
+	var probe struct {
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			Duration  string `json:"duration"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, err
+	}
+
+	for _, s := range probe.Streams {
+		if s.CodecType != "video" || s.Width == 0 || s.Height == 0 {
+			continue
+		}
+
+		// containers report the duration more reliably than streams
+		duration := parseSeconds(probe.Format.Duration)
+		if duration == 0 {
+			duration = parseSeconds(s.Duration)
+		}
+
+		return &Info{
+			Duration: duration,
+			Codec:    s.CodecName,
+			Width:    s.Width,
+			Height:   s.Height,
+		}, nil
+	}
+
+	return nil, ErrInvalidMedia
+}
+
+// Transcode writes src to dst as an H.264/AAC MP4, rotated upright and
+// scaled down to fit maxSide. Sources without sound, like animated GIFs,
+// come out silent.
+func (t *Transcoder) Transcode(ctx context.Context, src, dst string) error {
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-y"}, inputOptions...)
+	_, err := t.run(ctx, t.ffmpeg, append(args,
+		"-i", src,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", t.scaleFilter(),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		dst,
+	)...)
+	return err
+}
+
+// Poster writes the frame at offset as a JPEG still.
+func (t *Transcoder) Poster(ctx context.Context, src, dst string, offset time.Duration) error {
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-y"}, inputOptions...)
+	_, err := t.run(ctx, t.ffmpeg, append(args,
+		"-ss", strconv.FormatFloat(offset.Seconds(), 'f', 3, 64),
+		"-i", src,
+		"-frames:v", "1",
+		"-vf", t.scaleFilter(),
+		"-q:v", "3",
+		"-f", "image2",
+		dst,
+	)...)
+	return err
+}
+
+// scaleFilter shrinks frames to fit maxSide and rounds both sides down to
+// even numbers, which yuv420p requires.
+func (t *Transcoder) scaleFilter() string {
+	return fmt.Sprintf(
+		"scale='min(%[1]d,iw)':'min(%[1]d,ih)':force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		t.maxSide,
+	)
+}
+
+func (t *Transcoder) run(ctx context.Context, bin string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 500 {
+			msg = msg[:500]
+		}
+		return nil, fmt.Errorf("%s: %w: %s", bin, err, msg)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func parseSeconds(s string) time.Duration {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second))
+}
@@ -0,0 +1,244 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSeconds(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{s: "12", want: 12 * time.Second},
+		{s: "12.500000", want: 12500 * time.Millisecond},
+		{s: "0.04", want: 40 * time.Millisecond},
+		{s: "0", want: 0},
+		{s: "", want: 0},
+		{s: "N/A", want: 0},
+		{s: "-1", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseSeconds(tt.s); got != tt.want {
+			t.Errorf("parseSeconds(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestScaleFilter(t *testing.T) {
+	tests := []struct {
+		maxSide int
+		want    string
+	}{
+		{
+			maxSide: 1080,
+			want:    "scale='min(1080,iw)':'min(1080,ih)':force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		},
+		{
+			maxSide: 720,
+			want:    "scale='min(720,iw)':'min(720,ih)':force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := New("ffmpeg", "ffprobe", tt.maxSide).scaleFilter(); got != tt.want {
+			t.Errorf("scaleFilter() with max side %d = %s, want %s", tt.maxSide, got, tt.want)
+		}
+	}
+}
+
+// fakeScript stands in for ffmpeg and ffprobe. It records its arguments in
+// $FAKE_ARGS and prints $FAKE_STDOUT, then exits with $FAKE_EXIT.
+const fakeScript = `#!/bin/sh
+printf '%s\n' "$@" > "$FAKE_ARGS"
+printf '%s' "$FAKE_STDOUT"
+if [ -n "$FAKE_SLEEP" ]; then exec sleep "$FAKE_SLEEP"; fi
+echo "fake failure" >&2
+exit "${FAKE_EXIT:-0}"
+`
+
+// fakeBinaries puts fake ffmpeg and ffprobe binaries first on the PATH and
+// returns the file their arguments are recorded in.
+func fakeBinaries(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(fakeScript), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	args := filepath.Join(dir, "args")
+	t.Setenv("FAKE_ARGS", args)
+	return args
+}
+
+func readArgs(t *testing.T, file string) []string {
+	t.Helper()
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+// checkInputOptions fails unless every input option comes before the input.
+func checkInputOptions(t *testing.T, args []string, input string) {
+	t.Helper()
+
+	at := slices.Index(args, input)
+	for i := 0; i < len(inputOptions); i += 2 {
+		opt := slices.Index(args, inputOptions[i])
+		if opt < 0 || opt+1 >= len(args) || args[opt+1] != inputOptions[i+1] || opt > at {
+			t.Errorf("%s %s isn't passed before the input: %q", inputOptions[i], inputOptions[i+1], args)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run the fake ffprobe")
+	}
+	argsFile := fakeBinaries(t)
+
+	tests := []struct {
+		name    string
+		stdout  string
+		exit    string
+		want    *Info
+		invalid bool
+	}{
+		{
+			name:   "container duration",
+			stdout: `{"streams":[{"codec_type":"video","codec_name":"h264","width":1920,"height":1080,"duration":"10.0"}],"format":{"duration":"12.5"}}`,
+			want:   &Info{Duration: 12500 * time.Millisecond, Codec: "h264", Width: 1920, Height: 1080},
+		},
+		{
+			name:   "stream duration when the container has none",
+			stdout: `{"streams":[{"codec_type":"video","codec_name":"vp9","width":640,"height":480,"duration":"3.25"}],"format":{}}`,
+			want:   &Info{Duration: 3250 * time.Millisecond, Codec: "vp9", Width: 640, Height: 480},
+		},
+		{
+			name:   "stream duration when the container's isn't a number",
+			stdout: `{"streams":[{"codec_type":"video","codec_name":"gif","width":10,"height":20,"duration":"1.5"}],"format":{"duration":"N/A"}}`,
+			want:   &Info{Duration: 1500 * time.Millisecond, Codec: "gif", Width: 10, Height: 20},
+		},
+		{
+			name:   "first video stream after audio",
+			stdout: `{"streams":[{"codec_type":"audio","codec_name":"aac"},{"codec_type":"video","codec_name":"mjpeg","width":0,"height":0},{"codec_type":"video","codec_name":"h264","width":2,"height":2}],"format":{"duration":"1"}}`,
+			want:   &Info{Duration: time.Second, Codec: "h264", Width: 2, Height: 2},
+		},
+		{
+			name:    "no video",
+			stdout:  `{"streams":[{"codec_type":"audio","codec_name":"aac"}],"format":{"duration":"60"}}`,
+			invalid: true,
+		},
+		{
+			name:    "no streams",
+			stdout:  `{"format":{}}`,
+			invalid: true,
+		},
+		{
+			name:    "ffprobe rejects the file",
+			exit:    "1",
+			invalid: true,
+		},
+		{
+			name:   "output isn't json",
+			stdout: "not json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FAKE_STDOUT", tt.stdout)
+			t.Setenv("FAKE_EXIT", tt.exit)
+
+			got, err := New("ffmpeg", "ffprobe", 1080).Probe(context.Background(), "/tmp/upload")
+			if tt.want != nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if *got != *tt.want {
+					t.Errorf("Probe() = %+v, want %+v", got, tt.want)
+				}
+			} else {
+				if err == nil {
+					t.Fatalf("Probe() = %+v, want an error", got)
+				}
+				if errors.Is(err, ErrInvalidMedia) != tt.invalid {
+					t.Errorf("Probe() error = %v, want ErrInvalidMedia %v", err, tt.invalid)
+				}
+			}
+
+			checkInputOptions(t, readArgs(t, argsFile), "/tmp/upload")
+		})
+	}
+}
+
+// Failures that aren't about the file must not be reported as invalid
+// media, or the upload would be rejected for our own problem.
+func TestProbeOtherFailures(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run the fake ffprobe")
+	}
+	fakeBinaries(t)
+
+	t.Run("missing binary", func(t *testing.T) {
+		_, err := New("ffmpeg", "no-such-ffprobe", 1080).Probe(context.Background(), "/tmp/upload")
+		if err == nil || errors.Is(err, ErrInvalidMedia) {
+			t.Errorf("Probe() error = %v, want one other than ErrInvalidMedia", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Setenv("FAKE_SLEEP", "5")
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := New("ffmpeg", "ffprobe", 1080).Probe(ctx, "/tmp/upload")
+		if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrInvalidMedia) {
+			t.Errorf("Probe() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestFFmpegInputOptions(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell to run the fake ffmpeg")
+	}
+	argsFile := fakeBinaries(t)
+	tr := New("ffmpeg", "ffprobe", 1080)
+	ctx := context.Background()
+
+	if err := tr.Transcode(ctx, "/tmp/src", "/tmp/dst.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	checkInputOptions(t, readArgs(t, argsFile), "/tmp/src")
+
+	if err := tr.Poster(ctx, "/tmp/dst.mp4", "/tmp/poster.jpg", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	args := readArgs(t, argsFile)
+	checkInputOptions(t, args, "/tmp/dst.mp4")
+	if i := slices.Index(args, "-ss"); i < 0 || args[i+1] != "1.000" {
+		t.Errorf("poster offset isn't passed: %q", args)
+	}
+
+	t.Setenv("FAKE_EXIT", "1")
+	err := tr.Transcode(ctx, "/tmp/src", "/tmp/dst.mp4")
+	if err == nil || !strings.Contains(err.Error(), "fake failure") {
+		t.Errorf("Transcode() error = %v, want ffmpeg's message in it", err)
+	}
+}
@@ -0,0 +1,67 @@
+package unfurl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// ErrBlockedAddress is returned for links that resolve to addresses the
+// server must not be tricked into calling, like its own network.
+var ErrBlockedAddress = errors.New("address is not publicly routable")
+
+// blockedPrefixes are the special-purpose ranges netip has no predicate
+// for.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, can reach IPv4 private ranges
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// isPublic reports whether addr is a unicast address on the public
+// internet.
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAddress is a net.Dialer Control function. It runs after DNS
+// resolution, right before connecting, so a host name can't be made to
+// point somewhere else between the check and the connection.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !isPublic(addr) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addr)
+	}
+	if port != "80" && port != "443" {
+		return fmt.Errorf("%w: port %s", ErrBlockedAddress, port)
+	}
+
+	return nil
+}
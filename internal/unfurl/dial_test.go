@@ -0,0 +1,68 @@
+package unfurl
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.215.14:443", true},
+		{"93.184.215.14:80", true},
+		{"[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:443", true},
+
+		// loopback
+		{"127.0.0.1:80", false},
+		{"127.5.5.5:443", false},
+		{"[::1]:443", false},
+		// RFC 1918
+		{"10.0.0.1:80", false},
+		{"172.16.5.4:443", false},
+		{"172.31.255.255:443", false},
+		{"192.168.1.1:80", false},
+		// link-local, including cloud metadata endpoints
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:443", false},
+		// unique local IPv6
+		{"[fd00::1]:443", false},
+		// IPv4-mapped IPv6 can't smuggle private addresses through
+		{"[::ffff:127.0.0.1]:80", false},
+		{"[::ffff:10.0.0.1]:443", false},
+		{"[::ffff:169.254.169.254]:80", false},
+		// NAT64 reaches IPv4 addresses too
+		{"[64:ff9b::a00:1]:443", false},
+		// special-purpose ranges
+		{"0.0.0.0:80", false},
+		{"100.64.0.1:443", false},
+		{"192.0.2.1:443", false},
+		{"198.18.0.1:80", false},
+		{"255.255.255.255:80", false},
+		{"224.0.0.1:80", false},
+		{"[::]:443", false},
+		// public addresses on other ports
+		{"93.184.215.14:22", false},
+		{"93.184.215.14:8080", false},
+		{"93.184.215.14:6379", false},
+	}
+
+	for _, tt := range tests {
+		err := checkAddress("tcp", tt.address, nil)
+		switch {
+		case tt.allowed && err != nil:
+			t.Errorf("checkAddress(%q) = %v, want allowed", tt.address, err)
+		case !tt.allowed && !errors.Is(err, ErrBlockedAddress):
+			t.Errorf("checkAddress(%q) = %v, want ErrBlockedAddress", tt.address, err)
+		}
+	}
+}
+
+func TestCheckAddressMalformed(t *testing.T) {
+	for _, address := range []string{"", "127.0.0.1", "localhost:80", "[::1:443"} {
+		if err := checkAddress("tcp", address, nil); err == nil {
+			t.Errorf("checkAddress(%q) = nil, want an error", address)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package unfurl
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// pageMeta is the preview metadata found in a page's head.
+type pageMeta struct {
+	title       string
+	description string
+	// og and twitter map og:* and twitter:* properties without the prefix
+	og      map[string]string
+	twitter map[string]string
+	// oembed is the page's oEmbed JSON discovery link
+	oembed string
+}
+
+// parseHead reads the page up to its body. Only the first value of a
+// property counts, as the OpenGraph protocol prescribes.
+func parseHead(r io.Reader) pageMeta {
+	meta := pageMeta{og: map[string]string{}, twitter: map[string]string{}}
+	z := html.NewTokenizer(r)
+
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			// end of the page, or of what we were willing to read
+			return meta
+
+		case html.TextToken:
+			if inTitle && meta.title == "" {
+				meta.title = strings.Join(strings.Fields(string(z.Text())), " ")
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				return meta
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := atom.Lookup(name)
+			switch tag {
+			case atom.Body:
+				return meta
+			case atom.Title:
+				inTitle = true
+				continue
+			case atom.Meta, atom.Link:
+			default:
+				continue
+			}
+
+			attrs := map[string]string{}
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+
+			if tag == atom.Link {
+				if strings.EqualFold(attrs["rel"], "alternate") &&
+					strings.EqualFold(attrs["type"], "application/json+oembed") && meta.oembed == "" {
+					meta.oembed = attrs["href"]
+				}
+				continue
+			}
+
+			// OpenGraph uses property, but name is common in the wild
+			key := strings.ToLower(first(attrs["property"], attrs["name"]))
+			content := attrs["content"]
+			switch {
+			case strings.HasPrefix(key, "og:"):
+				setOnce(meta.og, strings.TrimPrefix(key, "og:"), content)
+			case strings.HasPrefix(key, "twitter:"):
+				setOnce(meta.twitter, strings.TrimPrefix(key, "twitter:"), content)
+			case key == "description" && meta.description == "":
+				meta.description = strings.TrimSpace(content)
+			}
+		}
+	}
+}
+
+func setOnce(m map[string]string, key, value string) {
+	if _, ok := m[key]; !ok && strings.TrimSpace(value) != "" {
+		m[key] = strings.TrimSpace(value)
+	}
+}
@@ -0,0 +1,246 @@
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+var (
+	// ErrUnsupportedContent is returned for links to something other than
+	// an HTML page, which have nothing to preview.
+	ErrUnsupportedContent = errors.New("link is not an HTML page")
+	ErrNoPreview          = errors.New("page has no preview metadata")
+)
+
+// Preview is what a link card shows.
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+	Type        string
+}
+
+// Config bounds every fetch.
+type Config struct {
+	// Timeout covers a whole fetch, redirects and oEmbed included.
+	Timeout time.Duration
+	// MaxBodySize is how much of a page or oEmbed response is read.
+	MaxBodySize  int64
+	MaxRedirects int
+	UserAgent    string
+	// AllowPrivate lifts the restriction to public addresses and the
+	// standard ports, for development and tests against local servers.
+	AllowPrivate bool
+}
+
+// Unfurler fetches link previews from OpenGraph and Twitter card tags,
+// falling back to oEmbed and the plain HTML title and description.
+type Unfurler struct {
+	client *http.Client
+	cfg    Config
+}
+
+func New(cfg Config) *Unfurler {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = checkAddress
+	}
+
+	transport := &http.Transport{
+		// no proxy: it would make the connection, and the address checks,
+		// somewhere else
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", cfg.MaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("%w: redirect to %s", ErrUnsupportedContent, req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+
+	return &Unfurler{client: client, cfg: cfg}
+}
+
+// Unfurl fetches the page at link and returns its preview.
+func (u *Unfurler) Unfurl(ctx context.Context, link string) (*Preview, error) {
+	ctx, cancel := context.WithTimeout(ctx, u.cfg.Timeout)
+	defer cancel()
+
+	resp, err := u.get(ctx, link, "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContent, mediaType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, u.cfg.MaxBodySize), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	// relative URLs in the page are relative to where redirects ended up
+	base := resp.Request.URL
+	meta := parseHead(body)
+
+	p := &Preview{
+		URL:         link,
+		Title:       first(meta.og["title"], meta.twitter["title"], meta.title),
+		Description: first(meta.og["description"], meta.twitter["description"], meta.description),
+		ImageURL:    resolve(base, first(meta.og["image"], meta.og["image:url"], meta.og["image:secure_url"], meta.twitter["image"], meta.twitter["image:src"])),
+		SiteName:    meta.og["site_name"],
+		Type:        first(meta.og["type"], "website"),
+	}
+
+	// oEmbed providers often have better titles and thumbnails than the
+	// page, for videos especially
+	if meta.oembed != "" && (p.Title == "" || p.ImageURL == "") {
+		if oe, err := u.oembed(ctx, resolve(base, meta.oembed)); err == nil {
+			p.Title = first(p.Title, oe.Title)
+			p.ImageURL = first(p.ImageURL, resolve(base, oe.ThumbnailURL))
+			p.SiteName = first(p.SiteName, oe.ProviderName)
+			if oe.Type != "" && oe.Type != "link" {
+				p.Type = oe.Type
+			}
+		}
+	}
+
+	if p.Title == "" && p.Description == "" && p.ImageURL == "" {
+		return nil, ErrNoPreview
+	}
+
+	p.Title = truncate(p.Title, 300)
+	p.Description = truncate(p.Description, 1000)
+	p.SiteName = truncate(p.SiteName, 100)
+	p.Type = truncate(p.Type, 50)
+
+	return p, nil
+}
+
+type oembedResponse struct {
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (u *Unfurler) oembed(ctx context.Context, link string) (*oembedResponse, error) {
+	if link == "" {
+		return nil, ErrNoPreview
+	}
+
+	resp, err := u.get(ctx, link, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var oe oembedResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, u.cfg.MaxBodySize)).Decode(&oe); err != nil {
+		return nil, err
+	}
+
+	return &oe, nil
+}
+
+func (u *Unfurler) get(ctx context.Context, link, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", u.cfg.UserAgent)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{Code: resp.StatusCode}
+	}
+
+	return resp, nil
+}
+
+// StatusError is returned when a page answers with anything but 200 OK.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.Code)
+}
+
+// Permanent reports whether trying err's link again later is pointless.
+func Permanent(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		// the page may come back, or the rate limit lift
+		return statusErr.Code != http.StatusTooManyRequests && statusErr.Code < 500
+	}
+	return errors.Is(err, ErrBlockedAddress) ||
+		errors.Is(err, ErrUnsupportedContent) ||
+		errors.Is(err, ErrNoPreview)
+}
+
+// resolve makes ref absolute against base. Only http and https links are
+// kept, so previews never carry javascript: or data: URLs.
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.String()) > MaxURLLength {
+		return ""
+	}
+	return u.String()
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
@@ -0,0 +1,311 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		Timeout:      2 * time.Second,
+		MaxBodySize:  64 << 10,
+		MaxRedirects: 3,
+		UserAgent:    "unfurl-test",
+		AllowPrivate: true,
+	}
+}
+
+// serve starts a server answering each path with its handler.
+func serve(t *testing.T, routes map[string]http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	for path, h := range routes {
+		mux.HandleFunc(path, h)
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func page(head string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<!doctype html><html><head>%s</head><body><p>body</p></body></html>", head)
+	}
+}
+
+func TestUnfurlMetadata(t *testing.T) {
+	srv := serve(t, map[string]http.HandlerFunc{
+		"/og": page(`
+			<title>HTML title</title>
+			<meta property="og:title" content="OG title">
+			<meta property="og:title" content="second OG title">
+			<meta property="og:description" content=" OG description ">
+			<meta property="og:image" content="/images/card.png">
+			<meta property="og:site_name" content="Example">
+			<meta property="og:type" content="article">
+			<meta name="twitter:title" content="Twitter title">
+		`),
+		"/twitter": page(`
+			<title>HTML title</title>
+			<meta name="twitter:title" content="Twitter title">
+			<meta name="twitter:description" content="Twitter description">
+			<meta name="twitter:image:src" content="https://cdn.example.com/t.png">
+		`),
+		"/plain": page(`
+			<title>
+				Plain   title
+			</title>
+			<meta name="description" content="Plain description">
+		`),
+		"/hostile": page(`
+			<title>&lt;script&gt;alert(1)&lt;/script&gt;</title>
+			<meta property="og:image" content="javascript:alert(1)">
+			<meta name="twitter:image" content="data:image/png;base64,AAAA">
+		`),
+		"/empty": page(`<meta charset="utf-8">`),
+		"/late": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head><meta charset="utf-8"></head><body><meta property="og:title" content="too late"></body></html>`)
+		},
+	})
+
+	tests := []struct {
+		path string
+		want Preview
+		err  error
+	}{
+		{
+			path: "/og",
+			want: Preview{
+				Title:       "OG title",
+				Description: "OG description",
+				ImageURL:    srv.URL + "/images/card.png",
+				SiteName:    "Example",
+				Type:        "article",
+			},
+		},
+		{
+			path: "/twitter",
+			want: Preview{
+				Title:       "Twitter title",
+				Description: "Twitter description",
+				ImageURL:    "https://cdn.example.com/t.png",
+				Type:        "website",
+			},
+		},
+		{
+			path: "/plain",
+			want: Preview{
+				Title:       "Plain title",
+				Description: "Plain description",
+				Type:        "website",
+			},
+		},
+		{
+			// the title is returned as text for the client to escape, and
+			// script URLs never make it into a preview
+			path: "/hostile",
+			want: Preview{
+				Title: "<script>alert(1)</script>",
+				Type:  "website",
+			},
+		},
+		{path: "/empty", err: ErrNoPreview},
+		{path: "/late", err: ErrNoPreview},
+	}
+
+	u := New(testConfig())
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := u.Unfurl(context.Background(), srv.URL+tt.path)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.want.URL = srv.URL + tt.path
+			if *p != tt.want {
+				t.Errorf("got %+v\nwant %+v", *p, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnfurlOEmbed(t *testing.T) {
+	var srv *httptest.Server
+	srv = serve(t, map[string]http.HandlerFunc{
+		"/video": func(w http.ResponseWriter, r *http.Request) {
+			page(fmt.Sprintf(`<link rel="alternate" type="application/json+oembed" href="%s/oembed?url=video">`, srv.URL))(w, r)
+		},
+		"/oembed": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"type":"video","title":"A video","provider_name":"Tube","thumbnail_url":"/thumb.jpg"}`)
+		},
+	})
+
+	p, err := New(testConfig()).Unfurl(context.Background(), srv.URL+"/video")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Preview{
+		URL:      srv.URL + "/video",
+		Title:    "A video",
+		ImageURL: srv.URL + "/thumb.jpg",
+		SiteName: "Tube",
+		Type:     "video",
+	}
+	if *p != want {
+		t.Errorf("got %+v\nwant %+v", *p, want)
+	}
+}
+
+func TestUnfurlRedirects(t *testing.T) {
+	srv := serve(t, map[string]http.HandlerFunc{
+		"/old": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/articles/new", http.StatusMovedPermanently)
+		},
+		"/articles/new": page(`<meta property="og:title" content="Moved"><meta property="og:image" content="card.png">`),
+		"/loop": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		},
+		"/ftp": func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "ftp://example.com/file", http.StatusFound)
+		},
+	})
+
+	u := New(testConfig())
+
+	p, err := u.Unfurl(context.Background(), srv.URL+"/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.URL != srv.URL+"/old" {
+		t.Errorf("URL: got %q, want the link as posted", p.URL)
+	}
+	// relative URLs resolve against where the redirects ended up
+	if want := srv.URL + "/articles/card.png"; p.ImageURL != want {
+		t.Errorf("ImageURL: got %q, want %q", p.ImageURL, want)
+	}
+
+	if _, err := u.Unfurl(context.Background(), srv.URL+"/loop"); err == nil {
+		t.Error("redirect loop: got a preview, want an error")
+	}
+
+	if _, err := u.Unfurl(context.Background(), srv.URL+"/ftp"); !errors.Is(err, ErrUnsupportedContent) {
+		t.Errorf("redirect to ftp: got %v, want ErrUnsupportedContent", err)
+	}
+}
+
+func TestUnfurlLimits(t *testing.T) {
+	srv := serve(t, map[string]http.HandlerFunc{
+		"/image": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		},
+		"/json": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"title":"not a page"}`)
+		},
+		"/big": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			// the tags come after more than MaxBodySize of padding
+			fmt.Fprintf(w, "<html><head><!-- %s --><title>Too far</title></head></html>", strings.Repeat("x", 128<<10))
+		},
+		"/slow": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(2 * time.Second):
+			case <-r.Context().Done():
+			}
+			page(`<title>Slow</title>`)(w, r)
+		},
+		"/missing": http.NotFound,
+		"/error": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "oops", http.StatusBadGateway)
+		},
+	})
+
+	cfg := testConfig()
+	cfg.Timeout = 200 * time.Millisecond
+	u := New(cfg)
+
+	tests := []struct {
+		path      string
+		err       error
+		permanent bool
+	}{
+		{path: "/image", err: ErrUnsupportedContent, permanent: true},
+		{path: "/json", err: ErrUnsupportedContent, permanent: true},
+		{path: "/big", err: ErrNoPreview, permanent: true},
+		{path: "/slow", err: context.DeadlineExceeded},
+		{path: "/missing", permanent: true},
+		{path: "/error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			start := time.Now()
+			_, err := u.Unfurl(context.Background(), srv.URL+tt.path)
+			if err == nil {
+				t.Fatal("got a preview, want an error")
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+			if Permanent(err) != tt.permanent {
+				t.Errorf("Permanent(%v) = %v, want %v", err, !tt.permanent, tt.permanent)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("took %s, longer than the timeout allows", elapsed)
+			}
+		})
+	}
+}
+
+func TestUnfurlBlocksPrivateAddresses(t *testing.T) {
+	srv := serve(t, map[string]http.HandlerFunc{
+		"/": page(`<title>Internal</title>`),
+	})
+
+	cfg := testConfig()
+	cfg.AllowPrivate = false
+
+	_, err := New(cfg).Unfurl(context.Background(), srv.URL+"/")
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("got %v, want ErrBlockedAddress", err)
+	}
+	if !Permanent(err) {
+		t.Error("blocked addresses should not be retried")
+	}
+}
+
+func TestUnfurlCharset(t *testing.T) {
+	srv := serve(t, map[string]http.HandlerFunc{
+		"/latin1": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+			w.Write([]byte("<html><head><title>Caf\xe9</title></head></html>"))
+		},
+	})
+
+	p, err := New(testConfig()).Unfurl(context.Background(), srv.URL+"/latin1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "Café" {
+		t.Errorf("Title: got %q, want %q", p.Title, "Café")
+	}
+}
@@ -0,0 +1,89 @@
+package unfurl
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// MaxURLLength is the longest link that gets a preview.
+const MaxURLLength = 2048
+
+var urlRx = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+`)
+
+// ExtractURLs returns the distinct http and https links in text, in order
+// of appearance and normalised with Normalize, up to max of them.
+func ExtractURLs(text string, max int) []string {
+	seen := map[string]bool{}
+	urls := []string{}
+	for _, raw := range urlRx.FindAllString(text, -1) {
+		if len(urls) == max {
+			break
+		}
+
+		u, ok := Normalize(trimTrailing(raw))
+		if ok && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// trimTrailing drops the punctuation that ends the sentence a link sits in,
+// keeping a closing parenthesis that has its opening one inside the link.
+func trimTrailing(s string) string {
+	for len(s) > 0 {
+		last := s[len(s)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'\"", last) >= 0:
+			s = s[:len(s)-1]
+		case last == ')' && strings.Count(s, "(") < strings.Count(s, ")"):
+			s = s[:len(s)-1]
+		default:
+			return s
+		}
+	}
+	return s
+}
+
+// Normalize returns the form previews are cached under: lower-case scheme
+// and host, no default port and no fragment. ok is false for links that
+// can't be previewed, including ones carrying credentials.
+func Normalize(raw string) (string, bool) {
+	if len(raw) > MaxURLLength {
+		return "", false
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return "", false
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		// IPv6 literal
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host += ":" + port
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	return u.String(), true
+}
@@ -0,0 +1,227 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBusy          = errors.New("upload is being written by another request")
+	ErrMissingData   = errors.New("data received earlier for this upload is missing")
+	ErrInvalidUpload = errors.New("invalid upload id")
+)
+
+// Dir keeps the partial data of resumable uploads on disk, one file per
+// upload. Every API instance serving an upload needs to see the same
+// directory, on a filesystem where file locks are shared between the hosts
+// mounting it.
+type Dir struct {
+	path string
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+func NewDir(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &Dir{path: path, busy: map[string]bool{}}, nil
+}
+
+// Lock claims the upload for a single writer. It fails with ErrBusy while
+// another request holds it, in this process or any other sharing the
+// directory; the returned func releases it.
+func (d *Dir) Lock(id string) (func(), error) {
+	name, err := d.file(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.busy[id] {
+		return nil, ErrBusy
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	d.busy[id] = true
+
+	return func() {
+		d.mu.Lock()
+		delete(d.busy, id)
+		d.mu.Unlock()
+
+		// closing the file releases the lock
+		f.Close()
+	}, nil
+}
+
+// Append writes r to the upload at offset, discarding anything stored past
+// it by an earlier request that wasn't acknowledged. At most max bytes are
+// accepted: when r holds more, nothing is kept and ErrTooLarge is returned.
+// Otherwise the number of bytes written is returned even when reading r
+// failed part way, so a broken connection doesn't lose what did arrive.
+func (d *Dir) Append(id string, offset int64, r io.Reader, max int64) (int64, error) {
+	name, err := d.file(id)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < offset {
+		return 0, ErrMissingData
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, copyErr := io.Copy(f, io.LimitReader(r, max))
+	if copyErr == nil && n == max {
+		// the body must end exactly at the limit
+		var probe [1]byte
+		if m, _ := r.Read(probe[:]); m > 0 {
+			if err := f.Truncate(offset); err != nil {
+				return 0, err
+			}
+			return 0, fmt.Errorf("%w of %d bytes", ErrTooLarge, max)
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+
+	return n, copyErr
+}
+
+// Open returns the data received for an upload.
+func (d *Dir) Open(id string) (*os.File, error) {
+	name, err := d.file(id)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrMissingData
+	}
+	return f, err
+}
+
+// Remove deletes an upload's data. Removing an upload that has none is not
+// an error.
+func (d *Dir) Remove(id string) error {
+	name, err := d.file(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Prune removes the data of uploads that haven't been written to for
+// longer than maxAge, and returns how many it removed.
+func (d *Dir) Prune(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(d.path)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || d.isBusy(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return removed, err
+		}
+		if info.ModTime().After(cutoff) {
+			continue
+		}
+
+		ok, err := d.removeUnlocked(filepath.Join(d.path, entry.Name()))
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// removeUnlocked removes the file unless another instance has it locked,
+// and reports whether it did.
+func (d *Dir) removeUnlocked(name string) (bool, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		if errors.Is(err, ErrBusy) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *Dir) isBusy(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.busy[id]
+}
+
+func (d *Dir) file(id string) (string, error) {
+	if id == "" || id == "." || id == ".." || filepath.Base(id) != id {
+		return "", ErrInvalidUpload
+	}
+	return filepath.Join(d.path, id), nil
+}
@@ -0,0 +1,138 @@
+package upload
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDirLock(t *testing.T) {
+	path := t.TempDir()
+
+	d, err := NewDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second instance sharing the directory
+	other, err := NewDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := d.Lock("a")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	if _, err := d.Lock("a"); !errors.Is(err, ErrBusy) {
+		t.Errorf("Lock held in the same instance: got %v, want ErrBusy", err)
+	}
+	if _, err := other.Lock("a"); !errors.Is(err, ErrBusy) {
+		t.Errorf("Lock held by another instance: got %v, want ErrBusy", err)
+	}
+
+	unlockB, err := other.Lock("b")
+	if err != nil {
+		t.Fatalf("Lock of another upload: %v", err)
+	}
+	unlockB()
+
+	unlock()
+
+	unlock, err = other.Lock("a")
+	if err != nil {
+		t.Fatalf("Lock after release: %v", err)
+	}
+	unlock()
+}
+
+func TestDirLockInvalidID(t *testing.T) {
+	d, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"", ".", "..", "../a", "a/b"} {
+		if _, err := d.Lock(id); !errors.Is(err, ErrInvalidUpload) {
+			t.Errorf("Lock(%q): got %v, want ErrInvalidUpload", id, err)
+		}
+	}
+}
+
+func TestDirAppend(t *testing.T) {
+	d, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := d.Append("a", 0, strings.NewReader("hello"), 10); err != nil || n != 5 {
+		t.Fatalf("Append: got %d, %v", n, err)
+	}
+
+	// a retry from an earlier offset replaces what came after it
+	if n, err := d.Append("a", 3, strings.NewReader("p!"), 7); err != nil || n != 2 {
+		t.Fatalf("Append at 3: got %d, %v", n, err)
+	}
+
+	if _, err := d.Append("a", 9, strings.NewReader("x"), 1); !errors.Is(err, ErrMissingData) {
+		t.Errorf("Append past the data: got %v, want ErrMissingData", err)
+	}
+
+	if _, err := d.Append("a", 5, strings.NewReader("too long"), 3); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Append over the limit: got %v, want ErrTooLarge", err)
+	}
+
+	f, err := d.Open("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var buf strings.Builder
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "help!" {
+		t.Errorf("data: got %q, want %q", got, "help!")
+	}
+}
+
+func TestDirPruneSkipsLocked(t *testing.T) {
+	path := t.TempDir()
+
+	d, err := NewDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewDir(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if _, err := d.Append(id, 0, strings.NewReader("data"), 4); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unlock, err := d.Lock("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	removed, err := other.Prune(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("Prune removed %d uploads, want 1", removed)
+	}
+
+	if _, err := d.Open("a"); err != nil {
+		t.Errorf("locked upload was pruned: %v", err)
+	}
+	if _, err := d.Open("b"); !errors.Is(err, ErrMissingData) {
+		t.Errorf("unlocked upload was kept: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package upload
+
+import "os"
+
+// lockFile does nothing where flock isn't available. Uploads are then only
+// locked within this process, so a single instance may serve them.
+func lockFile(f *os.File) error {
+	return nil
+}
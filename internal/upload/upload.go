@@ -0,0 +1,178 @@
+package upload
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+var (
+	ErrTooLarge = errors.New("upload exceeds the size limit")
+	ErrNoFile   = errors.New("no file in the upload")
+	// ErrInvalidForm is a multipart body this package refuses to read on,
+	// such as one with two files.
+	ErrInvalidForm = errors.New("invalid upload form")
+)
+
+// sniffLen is how much net/http's content sniffing looks at.
+const sniffLen = 512
+
+// Reader streams an upload. It sniffs the content type from the first bytes,
+// fails with ErrTooLarge as soon as more than the limit has been read, and
+// hashes the content on the way through, so nothing has to be buffered.
+type Reader struct {
+	br          *bufio.Reader
+	hash        hash.Hash
+	n           int64
+	limit       int64
+	contentType string
+}
+
+func NewReader(r io.Reader, limit int64) (*Reader, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if len(head) == 0 {
+		return nil, ErrNoFile
+	}
+
+	return &Reader{
+		br:          br,
+		hash:        sha256.New(),
+		limit:       limit,
+		contentType: http.DetectContentType(head),
+	}, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.br.Read(p)
+	r.n += int64(n)
+	if r.n > r.limit {
+		return 0, fmt.Errorf("%w of %d bytes", ErrTooLarge, r.limit)
+	}
+	r.hash.Write(p[:n])
+	return n, err
+}
+
+// ContentType is the type sniffed from the content, never the one the
+// client claimed.
+func (r *Reader) ContentType() string {
+	return r.contentType
+}
+
+// Size is the number of bytes read so far.
+func (r *Reader) Size() int64 {
+	return r.n
+}
+
+// SHA256 is the hex digest of everything read so far; it covers the whole
+// upload once the reader hit EOF.
+func (r *Reader) SHA256() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// maxFieldBytes caps the plain form fields sent along with a file.
+const maxFieldBytes = 64 << 10
+
+// ReadMultipart walks a multipart/form-data body part by part without
+// ParseMultipartForm. The part named fileField is passed to fn as a Reader
+// while the body is still arriving; every other part is collected as a
+// plain field. ErrNoFile is returned when the body carries no file.
+func ReadMultipart(r *http.Request, fileField string, limit int64, fn func(filename string, file *Reader) error) (url.Values, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := url.Values{}
+	found := false
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() == fileField && part.FileName() != "" {
+			if found {
+				part.Close()
+				return nil, fmt.Errorf("%w: only one %q part is allowed", ErrInvalidForm, fileField)
+			}
+			found = true
+
+			file, err := NewReader(part, limit)
+			if err != nil {
+				part.Close()
+				return nil, err
+			}
+			if err := fn(part.FileName(), file); err != nil {
+				part.Close()
+				return nil, err
+			}
+			part.Close()
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxFieldBytes+1))
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(value) > maxFieldBytes {
+			return nil, fmt.Errorf("%w: form field %q is too large", ErrInvalidForm, part.FormName())
+		}
+		fields.Add(part.FormName(), string(value))
+	}
+
+	if !found {
+		return nil, ErrNoFile
+	}
+
+	return fields, nil
+}
+
+// Spool copies r into a temporary file and rewinds it, for consumers that
+// need to seek. The caller removes the file with Remove.
+func Spool(r io.Reader) (*os.File, error) {
+	f, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		Remove(f)
+		return nil, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		Remove(f)
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Remove closes and deletes a file made by Spool.
+func Remove(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// IsMultipart reports whether the request carries a multipart/form-data body.
+func IsMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
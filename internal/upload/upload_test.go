@@ -0,0 +1,170 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pngHeader is enough of a PNG for content sniffing.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestReader(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), 4*sniffLen)
+
+	tests := []struct {
+		name        string
+		content     []byte
+		limit       int64
+		contentType string
+		err         error
+	}{
+		{name: "empty", content: nil, limit: 10, err: ErrNoFile},
+		{name: "text", content: []byte("hello"), limit: 10, contentType: "text/plain; charset=utf-8"},
+		{name: "png", content: pngHeader, limit: 100, contentType: "image/png"},
+		{name: "binary", content: []byte{0, 1, 2, 3}, limit: 10, contentType: "application/octet-stream"},
+		{name: "exactly the limit", content: []byte("12345"), limit: 5, contentType: "text/plain; charset=utf-8"},
+		{name: "over the limit", content: []byte("123456"), limit: 5, err: ErrTooLarge},
+		{name: "longer than the sniffed head", content: large, limit: int64(len(large)), contentType: "text/plain; charset=utf-8"},
+		{name: "over the limit after the head", content: large, limit: int64(len(large)) - 1, err: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(tt.content), tt.limit)
+			var got []byte
+			if err == nil {
+				got, err = io.ReadAll(r)
+			}
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.ContentType() != tt.contentType {
+				t.Errorf("ContentType() = %q, want %q", r.ContentType(), tt.contentType)
+			}
+			if !bytes.Equal(got, tt.content) {
+				t.Errorf("read %d bytes, want %d", len(got), len(tt.content))
+			}
+			if r.Size() != int64(len(tt.content)) {
+				t.Errorf("Size() = %d, want %d", r.Size(), len(tt.content))
+			}
+			sum := sha256.Sum256(tt.content)
+			if want := hex.EncodeToString(sum[:]); r.SHA256() != want {
+				t.Errorf("SHA256() = %s, want %s", r.SHA256(), want)
+			}
+		})
+	}
+}
+
+func TestReadMultipart(t *testing.T) {
+	type part struct {
+		field, filename, content string
+	}
+
+	tests := []struct {
+		name   string
+		parts  []part
+		files  []string
+		fields map[string]string
+		err    error
+	}{
+		{
+			name:   "file and fields",
+			parts:  []part{{field: "alt", content: "a cat"}, {field: "file", filename: "cat.png", content: "png"}},
+			files:  []string{"cat.png"},
+			fields: map[string]string{"alt": "a cat"},
+		},
+		{
+			name:  "no file",
+			parts: []part{{field: "alt", content: "a cat"}},
+			err:   ErrNoFile,
+		},
+		{
+			name:  "file field without a filename",
+			parts: []part{{field: "file", content: "png"}},
+			err:   ErrNoFile,
+		},
+		{
+			name:  "two files",
+			parts: []part{{field: "file", filename: "a.png", content: "a"}, {field: "file", filename: "b.png", content: "b"}},
+			err:   ErrInvalidForm,
+		},
+		{
+			name:  "field too large",
+			parts: []part{{field: "alt", content: strings.Repeat("x", maxFieldBytes+1)}, {field: "file", filename: "a.png", content: "a"}},
+			err:   ErrInvalidForm,
+		},
+		{
+			name:  "empty file",
+			parts: []part{{field: "file", filename: "a.png"}},
+			err:   ErrNoFile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			for _, p := range tt.parts {
+				var w io.Writer
+				var err error
+				if p.filename != "" {
+					w, err = mw.CreateFormFile(p.field, p.filename)
+				} else {
+					w, err = mw.CreateFormField(p.field)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.WriteString(w, p.content)
+			}
+			mw.Close()
+
+			r := httptest.NewRequest("POST", "/", &body)
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+			if !IsMultipart(r) {
+				t.Fatal("IsMultipart() = false")
+			}
+
+			var files []string
+			fields, err := ReadMultipart(r, "file", 1<<20, func(filename string, file *Reader) error {
+				files = append(files, filename)
+				_, err := io.Copy(io.Discard, file)
+				return err
+			})
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Join(files, ",") != strings.Join(tt.files, ",") {
+				t.Errorf("files = %v, want %v", files, tt.files)
+			}
+			for k, v := range tt.fields {
+				if fields.Get(k) != v {
+					t.Errorf("field %q = %q, want %q", k, fields.Get(k), v)
+				}
+			}
+		})
+	}
+}